@@ -5,9 +5,23 @@ TILE_PROXY_PORT=9000
 echo "Read .env file"
 source .env
 
+MAPPINGS=(
+	"hillshade:https://api.maptiler.com/tiles/hillshade/{z}/{x}/{y}.webp?key=$MAP_TILER_API_KEY"
+	"contours:https://api.maptiler.com/tiles/contours/{z}/{x}/{y}.pbf?key=$MAP_TILER_API_KEY"
+)
+
+# Relief layers computed from the elevation tiles of MapTiler
+TERRAIN_RGB="terrain-rgb:https://api.maptiler.com/tiles/terrain-rgb-v2/{z}/{x}/{y}.webp?key=$MAP_TILER_API_KEY"
+MAPPINGS+=("terrain-hillshade:hillshade:$TERRAIN_RGB" "terrain-slope:slope:$TERRAIN_RGB" "terrain-contours:contours:$TERRAIN_RGB")
+
+if [ -n "$DEM" ]
+then
+	echo "Serve hillshade, slope and contour tiles of DEM $DEM"
+	MAPPINGS+=("local-hillshade:hillshade:$(realpath "$DEM")" "slope:slope:$(realpath "$DEM")" "local-contours:contours:$(realpath "$DEM")")
+fi
+
 echo "Start tile-proxy on port $TILE_PROXY_PORT"
 cd tool
 go run main.go -d tile-proxy \
 	-p $TILE_PROXY_PORT \
-	"hillshade:https://api.maptiler.com/tiles/hillshade/{z}/{x}/{y}.webp?key=$MAP_TILER_API_KEY" \
-	"contours:https://api.maptiler.com/tiles/contours/{z}/{x}/{y}.pbf?key=$MAP_TILER_API_KEY"
\ No newline at end of file
+	"${MAPPINGS[@]}"
\ No newline at end of file
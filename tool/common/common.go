@@ -4,9 +4,12 @@ import (
 	"encoding/xml"
 	"github.com/hauke96/sigolo"
 	"github.com/paulmach/osm"
+	"math"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -52,28 +55,96 @@ func ToWayNode(node osm.Node) osm.WayNode {
 	}
 }
 
+// IsHikingRoute returns true for hiking route relations as well as superroutes combining several hiking routes (e.g.
+// the stages of a long-distance trail).
+func IsHikingRoute(relation *osm.Relation) bool {
+	relationType := relation.Tags.Find("type")
+	return (relationType == "route" || relationType == "superroute") && relation.Tags.Find("route") == "hiking"
+}
+
+// WriteOsmToPbf writes the given OSM data as sorted OSM-PBF file. The objects of the given OSM data are sorted in place.
 func WriteOsmToPbf(outputFileName string, outputOsm *osm.OSM) {
+	sigolo.Debug("Sort %d nodes, %d ways and %d relations by ID", len(outputOsm.Nodes), len(outputOsm.Ways), len(outputOsm.Relations))
+	sort.Slice(outputOsm.Nodes, func(i, j int) bool { return outputOsm.Nodes[i].ID < outputOsm.Nodes[j].ID })
+	sort.Slice(outputOsm.Ways, func(i, j int) bool { return outputOsm.Ways[i].ID < outputOsm.Ways[j].ID })
+	sort.Slice(outputOsm.Relations, func(i, j int) bool { return outputOsm.Relations[i].ID < outputOsm.Relations[j].ID })
+
+	bounds := GetBounds(outputOsm.Nodes)
+
+	sigolo.Debug("Write OSM-PBF file %s", outputFileName)
+	writer, err := NewPbfWriter(outputFileName, bounds)
+	sigolo.FatalCheck(err)
+
+	for _, node := range outputOsm.Nodes {
+		err = writer.WriteNode(node)
+		sigolo.FatalCheck(err)
+	}
+	for _, way := range outputOsm.Ways {
+		err = writer.WriteWay(way)
+		sigolo.FatalCheck(err)
+	}
+	for _, relation := range outputOsm.Relations {
+		err = writer.WriteRelation(relation)
+		sigolo.FatalCheck(err)
+	}
+
+	err = writer.Close()
+	sigolo.FatalCheck(err)
+
+	sigolo.Info("OSM data successfully written to %s", outputFileName)
+}
+
+// WriteOsmToPbfUsingOsmium writes the given OSM data as OSM-XML into a temporary folder and uses "osmium sort" to turn
+// it into a sorted OSM-PBF file. This is a fallback in case the native OSM-PBF writer causes problems.
+func WriteOsmToPbfUsingOsmium(outputFileName string, outputOsm *osm.OSM) {
 	sigolo.Debug("Convert result to OSM XML")
 	outputXml, err := xml.Marshal(outputOsm)
 	sigolo.FatalCheck(err)
 
-	osmXmlOutputFile := "features-unsorted.osm"
+	tempDir, err := os.MkdirTemp("", "outdoor-map-")
+	sigolo.FatalCheck(err)
+	defer os.RemoveAll(tempDir)
+
+	osmXmlOutputFile := filepath.Join(tempDir, "features-unsorted.osm")
 	sigolo.Debug("Write result to temp file %s", osmXmlOutputFile)
 	err = os.WriteFile(osmXmlOutputFile, outputXml, 0644)
 	sigolo.FatalCheck(err)
 
-	outputFileNameUnsorted := "features-unsorted.osm.pbf"
-	sigolo.Debug("Convert written OSM-XML file to sorted OSM-PBF file %s", outputFileNameUnsorted)
-	commandOsmiumCat := exec.Command("osmium", "sort", osmXmlOutputFile, "-o", outputFileName, "--overwrite")
-	RunWithOutputRedirect(commandOsmiumCat)
-
-	sigolo.Debug("Remove temp file %s", osmXmlOutputFile)
-	err = os.Remove(osmXmlOutputFile)
-	sigolo.FatalCheck(err)
+	sigolo.Debug("Convert written OSM-XML file to sorted OSM-PBF file %s", outputFileName)
+	commandOsmiumSort := exec.Command("osmium", "sort", osmXmlOutputFile, "-o", outputFileName, "--overwrite")
+	RunWithOutputRedirect(commandOsmiumSort)
 
 	sigolo.Info("OSM data successfully written to %s", outputFileName)
 }
 
+// GetBounds returns the bounding box of all given nodes or nil if there are no nodes.
+func GetBounds(nodes osm.Nodes) *osm.Bounds {
+	var bounds *osm.Bounds
+	for _, node := range nodes {
+		bounds = ExtendBounds(bounds, node.Lon, node.Lat)
+	}
+	return bounds
+}
+
+// ExtendBounds extends the given bounds so that they contain the given location. New bounds are created if the given
+// bounds are nil.
+func ExtendBounds(bounds *osm.Bounds, lon float64, lat float64) *osm.Bounds {
+	if bounds == nil {
+		return &osm.Bounds{
+			MinLat: lat,
+			MaxLat: lat,
+			MinLon: lon,
+			MaxLon: lon,
+		}
+	}
+
+	bounds.MinLat = math.Min(bounds.MinLat, lat)
+	bounds.MaxLat = math.Max(bounds.MaxLat, lat)
+	bounds.MinLon = math.Min(bounds.MinLon, lon)
+	bounds.MaxLon = math.Max(bounds.MaxLon, lon)
+	return bounds
+}
+
 func RunWithOutputRedirect(command *exec.Cmd) {
 	sigolo.Debug("Run command: %s", command.String())
 	command.Stdout = os.Stdout
@@ -97,10 +168,3 @@ func GenerateVectorTiles(pbfFileName string) {
 	err = command.Run()
 	sigolo.FatalCheck(err)
 }
-
-func GetTimestamp() time.Time {
-	// Osmium only supports this format, so we basically make the time less accurate so that no millis are serialized
-	timestamp, err := time.Parse(time.RFC3339, time.Now().UTC().Format(time.RFC3339))
-	sigolo.FatalCheck(err)
-	return timestamp
-}
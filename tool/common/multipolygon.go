@@ -0,0 +1,139 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/osm"
+	"math"
+)
+
+// MultipolygonWay is a member way of a multipolygon relation together with the locations of its nodes.
+type MultipolygonWay struct {
+	Role    string
+	NodeIds []osm.NodeID
+	Points  []orb.Point
+}
+
+// ring is a (possibly not yet closed) sequence of node IDs and their locations.
+type ring struct {
+	nodeIds []osm.NodeID
+	points  []orb.Point
+}
+
+func (r *ring) isClosed() bool {
+	return len(r.nodeIds) >= 4 && r.nodeIds[0] == r.nodeIds[len(r.nodeIds)-1]
+}
+
+// AssembleMultipolygon builds the geometry of a multipolygon relation from its member ways. Ways split into several
+// parts are stitched together into closed rings. Inner rings are assigned to the smallest outer ring containing them.
+// Rings that can't be closed are ignored. An error is returned when no closed outer ring exists.
+func AssembleMultipolygon(ways []MultipolygonWay) (orb.MultiPolygon, error) {
+	var outerWays []MultipolygonWay
+	var innerWays []MultipolygonWay
+	for _, way := range ways {
+		if len(way.NodeIds) < 2 || len(way.NodeIds) != len(way.Points) {
+			continue
+		}
+
+		if way.Role == "inner" {
+			innerWays = append(innerWays, way)
+		} else {
+			outerWays = append(outerWays, way)
+		}
+	}
+
+	outerRings := buildRings(outerWays)
+	if len(outerRings) == 0 {
+		return nil, errors.New(fmt.Sprintf("No closed outer ring found in %d member ways", len(ways)))
+	}
+	innerRings := buildRings(innerWays)
+
+	multiPolygon := make(orb.MultiPolygon, len(outerRings))
+	outerRingAreas := make([]float64, len(outerRings))
+	for i, outerRing := range outerRings {
+		if outerRing.Orientation() != orb.CCW {
+			outerRing.Reverse()
+		}
+		multiPolygon[i] = orb.Polygon{outerRing}
+		outerRingAreas[i] = math.Abs(planar.Area(outerRing))
+	}
+
+	for _, innerRing := range innerRings {
+		if innerRing.Orientation() != orb.CW {
+			innerRing.Reverse()
+		}
+
+		containingPolygon := -1
+		for i, outerRing := range outerRings {
+			if !planar.RingContains(outerRing, innerRing[0]) {
+				continue
+			}
+			if containingPolygon == -1 || outerRingAreas[i] < outerRingAreas[containingPolygon] {
+				containingPolygon = i
+			}
+		}
+
+		if containingPolygon != -1 {
+			multiPolygon[containingPolygon] = append(multiPolygon[containingPolygon], innerRing)
+		}
+	}
+
+	return multiPolygon, nil
+}
+
+// buildRings stitches the given ways together into closed rings. Ways are connected via their first and last node.
+func buildRings(ways []MultipolygonWay) []orb.Ring {
+	used := make([]bool, len(ways))
+	var rings []orb.Ring
+
+	for i, way := range ways {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+
+		currentRing := &ring{
+			nodeIds: append([]osm.NodeID{}, way.NodeIds...),
+			points:  append([]orb.Point{}, way.Points...),
+		}
+
+		for !currentRing.isClosed() {
+			lastNodeId := currentRing.nodeIds[len(currentRing.nodeIds)-1]
+			found := false
+
+			for j, otherWay := range ways {
+				if used[j] {
+					continue
+				}
+
+				if otherWay.NodeIds[0] == lastNodeId {
+					currentRing.nodeIds = append(currentRing.nodeIds, otherWay.NodeIds[1:]...)
+					currentRing.points = append(currentRing.points, otherWay.Points[1:]...)
+				} else if otherWay.NodeIds[len(otherWay.NodeIds)-1] == lastNodeId {
+					for k := len(otherWay.NodeIds) - 2; k >= 0; k-- {
+						currentRing.nodeIds = append(currentRing.nodeIds, otherWay.NodeIds[k])
+						currentRing.points = append(currentRing.points, otherWay.Points[k])
+					}
+				} else {
+					continue
+				}
+
+				used[j] = true
+				found = true
+				break
+			}
+
+			if !found {
+				break
+			}
+		}
+
+		if currentRing.isClosed() {
+			rings = append(rings, currentRing.points)
+		}
+	}
+
+	return rings
+}
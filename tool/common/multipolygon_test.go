@@ -0,0 +1,52 @@
+package common
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"testing"
+)
+
+func TestAssembleMultipolygon_splitOuterRingWithInnerRing(t *testing.T) {
+	ways := []MultipolygonWay{
+		{Role: "outer", NodeIds: []osm.NodeID{1, 2, 3}, Points: []orb.Point{{0, 0}, {10, 0}, {10, 10}}},
+		{Role: "inner", NodeIds: []osm.NodeID{5, 6, 7, 5}, Points: []orb.Point{{2, 2}, {4, 2}, {4, 4}, {2, 2}}},
+		// Reversed direction
+		{Role: "outer", NodeIds: []osm.NodeID{1, 4, 3}, Points: []orb.Point{{0, 0}, {0, 10}, {10, 10}}},
+		// Outer ring that can't be closed
+		{Role: "outer", NodeIds: []osm.NodeID{8, 9}, Points: []orb.Point{{20, 20}, {30, 30}}},
+	}
+
+	// Act
+	multiPolygon, err := AssembleMultipolygon(ways)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(multiPolygon) != 1 {
+		t.Fatalf("Expected 1 polygon but got %d", len(multiPolygon))
+	}
+	if len(multiPolygon[0]) != 2 {
+		t.Fatalf("Expected 2 rings but got %d", len(multiPolygon[0]))
+	}
+	if len(multiPolygon[0][0]) != 5 || multiPolygon[0][0].Orientation() != orb.CCW {
+		t.Errorf("Wrong outer ring: %v", multiPolygon[0][0])
+	}
+	if multiPolygon[0][1].Orientation() != orb.CW {
+		t.Errorf("Wrong orientation of inner ring: %v", multiPolygon[0][1])
+	}
+}
+
+func TestAssembleMultipolygon_noClosedRing(t *testing.T) {
+	ways := []MultipolygonWay{
+		{Role: "outer", NodeIds: []osm.NodeID{1, 2, 3}, Points: []orb.Point{{0, 0}, {10, 0}, {10, 10}}},
+	}
+
+	// Act
+	_, err := AssembleMultipolygon(ways)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected error")
+	}
+}
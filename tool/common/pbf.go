@@ -0,0 +1,477 @@
+package common
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/paulmach/osm"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"os"
+	"time"
+)
+
+const (
+	// Maximum number of entities per primitive block. This is the same value osmium uses.
+	pbfEntitiesPerBlock = 8000
+	// Granularity of coordinates in nanodegrees. This is the default value of the OSM-PBF format (~1cm precision).
+	pbfGranularity = 100
+	// Granularity of timestamps in milliseconds, which means timestamps are stored in seconds.
+	pbfDateGranularity = 1000
+
+	pbfWritingProgram = "qgis-outdoor-map-tool"
+)
+
+// PbfWriter writes OSM objects as OSM-PBF file. The objects must be written sorted by their type (nodes, then ways,
+// then relations) and their ID. Objects are collected into primitive blocks, which are written to disk as soon as they
+// are full, so that only one block is kept in memory at a time.
+type PbfWriter struct {
+	file *os.File
+
+	currentType osm.Type
+	lastId      int64
+	hasLastId   bool
+
+	nodes     []*osm.Node
+	ways      []*osm.Way
+	relations []*osm.Relation
+}
+
+// NewPbfWriter creates the given output file and writes the OSM-PBF header with the given bounds into it. The bounds
+// may be nil, in which case the header contains no bbox.
+func NewPbfWriter(outputFileName string, bounds *osm.Bounds) (*PbfWriter, error) {
+	file, err := os.Create(outputFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &PbfWriter{
+		file:        file,
+		currentType: osm.TypeNode,
+	}
+
+	err = writer.writeBlob("OSMHeader", encodeHeaderBlock(bounds))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+func (w *PbfWriter) WriteNode(node *osm.Node) error {
+	err := w.checkOrder(osm.TypeNode, int64(node.ID))
+	if err != nil {
+		return err
+	}
+
+	w.nodes = append(w.nodes, node)
+	if len(w.nodes) >= pbfEntitiesPerBlock {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *PbfWriter) WriteWay(way *osm.Way) error {
+	err := w.checkOrder(osm.TypeWay, int64(way.ID))
+	if err != nil {
+		return err
+	}
+
+	w.ways = append(w.ways, way)
+	if len(w.ways) >= pbfEntitiesPerBlock {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *PbfWriter) WriteRelation(relation *osm.Relation) error {
+	err := w.checkOrder(osm.TypeRelation, int64(relation.ID))
+	if err != nil {
+		return err
+	}
+
+	w.relations = append(w.relations, relation)
+	if len(w.relations) >= pbfEntitiesPerBlock {
+		return w.flush()
+	}
+	return nil
+}
+
+// WriteObject writes the given node, way or relation. Other objects are ignored.
+func (w *PbfWriter) WriteObject(obj osm.Object) error {
+	switch osmObj := obj.(type) {
+	case *osm.Node:
+		return w.WriteNode(osmObj)
+	case *osm.Way:
+		return w.WriteWay(osmObj)
+	case *osm.Relation:
+		return w.WriteRelation(osmObj)
+	}
+	return nil
+}
+
+// Close writes all remaining objects and closes the underlying file.
+func (w *PbfWriter) Close() error {
+	err := w.flush()
+	if err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// checkOrder ensures that objects are written in the order "nodes, ways, relations" and sorted by ID within each type.
+// When the type changes, the current block is flushed so that each block only contains one type of object.
+func (w *PbfWriter) checkOrder(objType osm.Type, id int64) error {
+	if objType != w.currentType {
+		if typeOrder(objType) < typeOrder(w.currentType) {
+			return errors.New(fmt.Sprintf("Cannot write %s %d after objects of type %s were written", objType, id, w.currentType))
+		}
+
+		err := w.flush()
+		if err != nil {
+			return err
+		}
+		w.currentType = objType
+		w.hasLastId = false
+	}
+
+	if w.hasLastId && id <= w.lastId {
+		return errors.New(fmt.Sprintf("Cannot write %s %d after %s %d, objects must be sorted by ID", objType, id, objType, w.lastId))
+	}
+	w.lastId = id
+	w.hasLastId = true
+
+	return nil
+}
+
+// CompareObjectIds compares the given object IDs by the order they have in a sorted OSM-PBF file. The result is
+// negative if a comes before b, positive if b comes before a and 0 if both are equal.
+func CompareObjectIds(a osm.ObjectID, b osm.ObjectID) int {
+	if typeOrder(a.Type()) != typeOrder(b.Type()) {
+		return typeOrder(a.Type()) - typeOrder(b.Type())
+	}
+	if a.Ref() < b.Ref() {
+		return -1
+	} else if a.Ref() > b.Ref() {
+		return 1
+	}
+	return 0
+}
+
+func typeOrder(objType osm.Type) int {
+	switch objType {
+	case osm.TypeNode:
+		return 0
+	case osm.TypeWay:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (w *PbfWriter) flush() error {
+	var block []byte
+	if len(w.nodes) > 0 {
+		block = encodeNodeBlock(w.nodes)
+		w.nodes = w.nodes[:0]
+	} else if len(w.ways) > 0 {
+		block = encodeWayBlock(w.ways)
+		w.ways = w.ways[:0]
+	} else if len(w.relations) > 0 {
+		block = encodeRelationBlock(w.relations)
+		w.relations = w.relations[:0]
+	} else {
+		return nil
+	}
+
+	return w.writeBlob("OSMData", block)
+}
+
+// writeBlob compresses the given data and writes it as file block (size, blob header and blob) to the file.
+func (w *PbfWriter) writeBlob(blobType string, data []byte) error {
+	var compressedData bytes.Buffer
+	zlibWriter := zlib.NewWriter(&compressedData)
+	_, err := zlibWriter.Write(data)
+	if err != nil {
+		return err
+	}
+	err = zlibWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	var blob []byte
+	blob = protowire.AppendTag(blob, 2, protowire.VarintType)
+	blob = protowire.AppendVarint(blob, uint64(len(data)))
+	blob = protowire.AppendTag(blob, 3, protowire.BytesType)
+	blob = protowire.AppendBytes(blob, compressedData.Bytes())
+
+	var blobHeader []byte
+	blobHeader = protowire.AppendTag(blobHeader, 1, protowire.BytesType)
+	blobHeader = protowire.AppendString(blobHeader, blobType)
+	blobHeader = protowire.AppendTag(blobHeader, 3, protowire.VarintType)
+	blobHeader = protowire.AppendVarint(blobHeader, uint64(len(blob)))
+
+	blobHeaderSize := make([]byte, 4)
+	binary.BigEndian.PutUint32(blobHeaderSize, uint32(len(blobHeader)))
+
+	for _, b := range [][]byte{blobHeaderSize, blobHeader, blob} {
+		_, err = w.file.Write(b)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeHeaderBlock(bounds *osm.Bounds) []byte {
+	var header []byte
+
+	if bounds != nil {
+		var bbox []byte
+		bbox = protowire.AppendTag(bbox, 1, protowire.VarintType)
+		bbox = protowire.AppendVarint(bbox, protowire.EncodeZigZag(toNanoDegrees(bounds.MinLon)))
+		bbox = protowire.AppendTag(bbox, 2, protowire.VarintType)
+		bbox = protowire.AppendVarint(bbox, protowire.EncodeZigZag(toNanoDegrees(bounds.MaxLon)))
+		bbox = protowire.AppendTag(bbox, 3, protowire.VarintType)
+		bbox = protowire.AppendVarint(bbox, protowire.EncodeZigZag(toNanoDegrees(bounds.MaxLat)))
+		bbox = protowire.AppendTag(bbox, 4, protowire.VarintType)
+		bbox = protowire.AppendVarint(bbox, protowire.EncodeZigZag(toNanoDegrees(bounds.MinLat)))
+
+		header = protowire.AppendTag(header, 1, protowire.BytesType)
+		header = protowire.AppendBytes(header, bbox)
+	}
+
+	for _, feature := range []string{"OsmSchema-V0.6", "DenseNodes"} {
+		header = protowire.AppendTag(header, 4, protowire.BytesType)
+		header = protowire.AppendString(header, feature)
+	}
+
+	header = protowire.AppendTag(header, 5, protowire.BytesType)
+	header = protowire.AppendString(header, "Sort.Type_then_ID")
+
+	header = protowire.AppendTag(header, 16, protowire.BytesType)
+	header = protowire.AppendString(header, pbfWritingProgram)
+
+	return header
+}
+
+// stringTable collects all strings of one primitive block. The index 0 is reserved and always contains an empty string.
+type stringTable struct {
+	strings []string
+	indices map[string]int
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{
+		strings: []string{""},
+		indices: map[string]int{},
+	}
+}
+
+func (t *stringTable) index(s string) int {
+	if i, ok := t.indices[s]; ok {
+		return i
+	}
+	t.strings = append(t.strings, s)
+	t.indices[s] = len(t.strings) - 1
+	return len(t.strings) - 1
+}
+
+func (t *stringTable) encode() []byte {
+	var table []byte
+	for _, s := range t.strings {
+		table = protowire.AppendTag(table, 1, protowire.BytesType)
+		table = protowire.AppendString(table, s)
+	}
+	return table
+}
+
+// encodePrimitiveBlock wraps the given primitive group into a primitive block with the given string table.
+func encodePrimitiveBlock(strings *stringTable, group []byte) []byte {
+	var block []byte
+	block = protowire.AppendTag(block, 1, protowire.BytesType)
+	block = protowire.AppendBytes(block, strings.encode())
+	block = protowire.AppendTag(block, 2, protowire.BytesType)
+	block = protowire.AppendBytes(block, group)
+	block = protowire.AppendTag(block, 17, protowire.VarintType)
+	block = protowire.AppendVarint(block, pbfGranularity)
+	block = protowire.AppendTag(block, 18, protowire.VarintType)
+	block = protowire.AppendVarint(block, pbfDateGranularity)
+	return block
+}
+
+func encodeNodeBlock(nodes []*osm.Node) []byte {
+	strings := newStringTable()
+
+	var ids, lats, lons, keysVals []byte
+	var versions, timestamps, changesets, uids, userSids []byte
+	var lastId, lastLat, lastLon, lastTimestamp, lastChangeset int64
+	var lastUid, lastUserSid int64
+
+	for _, node := range nodes {
+		lat := toCoordinate(node.Lat)
+		lon := toCoordinate(node.Lon)
+		timestamp := toPbfTimestamp(node.Timestamp)
+		userSid := int64(strings.index(node.User))
+
+		ids = protowire.AppendVarint(ids, protowire.EncodeZigZag(int64(node.ID)-lastId))
+		lats = protowire.AppendVarint(lats, protowire.EncodeZigZag(lat-lastLat))
+		lons = protowire.AppendVarint(lons, protowire.EncodeZigZag(lon-lastLon))
+
+		versions = protowire.AppendVarint(versions, uint64(node.Version))
+		timestamps = protowire.AppendVarint(timestamps, protowire.EncodeZigZag(timestamp-lastTimestamp))
+		changesets = protowire.AppendVarint(changesets, protowire.EncodeZigZag(int64(node.ChangesetID)-lastChangeset))
+		uids = protowire.AppendVarint(uids, protowire.EncodeZigZag(int64(node.UserID)-lastUid))
+		userSids = protowire.AppendVarint(userSids, protowire.EncodeZigZag(userSid-lastUserSid))
+
+		for _, tag := range node.Tags {
+			keysVals = protowire.AppendVarint(keysVals, uint64(strings.index(tag.Key)))
+			keysVals = protowire.AppendVarint(keysVals, uint64(strings.index(tag.Value)))
+		}
+		keysVals = protowire.AppendVarint(keysVals, 0)
+
+		lastId = int64(node.ID)
+		lastLat = lat
+		lastLon = lon
+		lastTimestamp = timestamp
+		lastChangeset = int64(node.ChangesetID)
+		lastUid = int64(node.UserID)
+		lastUserSid = userSid
+	}
+
+	var denseInfo []byte
+	denseInfo = appendPacked(denseInfo, 1, versions)
+	denseInfo = appendPacked(denseInfo, 2, timestamps)
+	denseInfo = appendPacked(denseInfo, 3, changesets)
+	denseInfo = appendPacked(denseInfo, 4, uids)
+	denseInfo = appendPacked(denseInfo, 5, userSids)
+
+	var dense []byte
+	dense = appendPacked(dense, 1, ids)
+	dense = protowire.AppendTag(dense, 5, protowire.BytesType)
+	dense = protowire.AppendBytes(dense, denseInfo)
+	dense = appendPacked(dense, 8, lats)
+	dense = appendPacked(dense, 9, lons)
+	dense = appendPacked(dense, 10, keysVals)
+
+	var group []byte
+	group = protowire.AppendTag(group, 2, protowire.BytesType)
+	group = protowire.AppendBytes(group, dense)
+
+	return encodePrimitiveBlock(strings, group)
+}
+
+func encodeWayBlock(ways []*osm.Way) []byte {
+	strings := newStringTable()
+
+	var group []byte
+	for _, way := range ways {
+		var refs []byte
+		var lastRef int64
+		for _, wayNode := range way.Nodes {
+			refs = protowire.AppendVarint(refs, protowire.EncodeZigZag(int64(wayNode.ID)-lastRef))
+			lastRef = int64(wayNode.ID)
+		}
+
+		var encodedWay []byte
+		encodedWay = protowire.AppendTag(encodedWay, 1, protowire.VarintType)
+		encodedWay = protowire.AppendVarint(encodedWay, uint64(way.ID))
+		encodedWay = appendTags(encodedWay, strings, way.Tags)
+		encodedWay = appendInfo(encodedWay, strings, way.Version, way.Timestamp, int64(way.ChangesetID), int64(way.UserID), way.User)
+		encodedWay = appendPacked(encodedWay, 8, refs)
+
+		group = protowire.AppendTag(group, 3, protowire.BytesType)
+		group = protowire.AppendBytes(group, encodedWay)
+	}
+
+	return encodePrimitiveBlock(strings, group)
+}
+
+func encodeRelationBlock(relations []*osm.Relation) []byte {
+	strings := newStringTable()
+
+	var group []byte
+	for _, relation := range relations {
+		var roles, memberIds, memberTypes []byte
+		var lastMemberId int64
+		for _, member := range relation.Members {
+			roles = protowire.AppendVarint(roles, uint64(strings.index(member.Role)))
+			memberIds = protowire.AppendVarint(memberIds, protowire.EncodeZigZag(member.Ref-lastMemberId))
+			memberTypes = protowire.AppendVarint(memberTypes, uint64(typeOrder(member.Type)))
+			lastMemberId = member.Ref
+		}
+
+		var encodedRelation []byte
+		encodedRelation = protowire.AppendTag(encodedRelation, 1, protowire.VarintType)
+		encodedRelation = protowire.AppendVarint(encodedRelation, uint64(relation.ID))
+		encodedRelation = appendTags(encodedRelation, strings, relation.Tags)
+		encodedRelation = appendInfo(encodedRelation, strings, relation.Version, relation.Timestamp, int64(relation.ChangesetID), int64(relation.UserID), relation.User)
+		encodedRelation = appendPacked(encodedRelation, 8, roles)
+		encodedRelation = appendPacked(encodedRelation, 9, memberIds)
+		encodedRelation = appendPacked(encodedRelation, 10, memberTypes)
+
+		group = protowire.AppendTag(group, 4, protowire.BytesType)
+		group = protowire.AppendBytes(group, encodedRelation)
+	}
+
+	return encodePrimitiveBlock(strings, group)
+}
+
+func appendTags(b []byte, strings *stringTable, tags osm.Tags) []byte {
+	var keys, values []byte
+	for _, tag := range tags {
+		keys = protowire.AppendVarint(keys, uint64(strings.index(tag.Key)))
+		values = protowire.AppendVarint(values, uint64(strings.index(tag.Value)))
+	}
+	b = appendPacked(b, 2, keys)
+	b = appendPacked(b, 3, values)
+	return b
+}
+
+func appendInfo(b []byte, strings *stringTable, version int, timestamp time.Time, changeset int64, uid int64, user string) []byte {
+	var info []byte
+	info = protowire.AppendTag(info, 1, protowire.VarintType)
+	info = protowire.AppendVarint(info, uint64(version))
+	info = protowire.AppendTag(info, 2, protowire.VarintType)
+	info = protowire.AppendVarint(info, uint64(toPbfTimestamp(timestamp)))
+	info = protowire.AppendTag(info, 3, protowire.VarintType)
+	info = protowire.AppendVarint(info, uint64(changeset))
+	info = protowire.AppendTag(info, 4, protowire.VarintType)
+	info = protowire.AppendVarint(info, uint64(uid))
+	info = protowire.AppendTag(info, 5, protowire.VarintType)
+	info = protowire.AppendVarint(info, uint64(strings.index(user)))
+
+	b = protowire.AppendTag(b, 4, protowire.BytesType)
+	b = protowire.AppendBytes(b, info)
+	return b
+}
+
+// appendPacked appends the given already encoded values as packed repeated field. Nothing is appended for empty values.
+func appendPacked(b []byte, fieldNumber protowire.Number, values []byte) []byte {
+	if len(values) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, fieldNumber, protowire.BytesType)
+	return protowire.AppendBytes(b, values)
+}
+
+func toCoordinate(degrees float64) int64 {
+	return int64(math.Round(degrees * 1e9 / pbfGranularity))
+}
+
+func toNanoDegrees(degrees float64) int64 {
+	return int64(math.Round(degrees * 1e9))
+}
+
+func toPbfTimestamp(timestamp time.Time) int64 {
+	if timestamp.IsZero() {
+		return 0
+	}
+	return timestamp.UnixMilli() / pbfDateGranularity
+}
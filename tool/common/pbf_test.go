@@ -0,0 +1,127 @@
+package common
+
+import (
+	"context"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteOsmToPbf_roundTrip(t *testing.T) {
+	timestamp := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	inputOsm := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 3, Version: 1, Timestamp: timestamp, Lat: 53.5, Lon: 9.9, Tags: osm.Tags{{Key: "amenity", Value: "shelter"}}},
+			{ID: 1, Version: 2, Timestamp: timestamp, Lat: 53.4, Lon: 9.8, User: "foo", UserID: 42},
+			{ID: 2, Version: 1, Timestamp: timestamp, Lat: -53.6, Lon: -10.1},
+		},
+		Ways: osm.Ways{
+			{ID: 11, Version: 1, Timestamp: timestamp, Nodes: osm.WayNodes{{ID: 1}, {ID: 3}}, Tags: osm.Tags{{Key: "highway", Value: "path"}}},
+			{ID: 10, Version: 1, Timestamp: timestamp, Nodes: osm.WayNodes{{ID: 3}, {ID: 2}, {ID: 1}}},
+		},
+		Relations: osm.Relations{
+			{ID: 20, Version: 1, Timestamp: timestamp, Members: osm.Members{
+				{Type: osm.TypeWay, Ref: 11, Role: "outer"},
+				{Type: osm.TypeNode, Ref: 1},
+			}, Tags: osm.Tags{{Key: "type", Value: "route"}}},
+		},
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "output.osm.pbf")
+	WriteOsmToPbf(outputFile, inputOsm)
+
+	f, err := os.Open(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := osmpbf.New(context.Background(), f, 1)
+	defer scanner.Close()
+
+	header, err := scanner.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Bounds == nil || !almostEqual(header.Bounds.MinLat, -53.6) || !almostEqual(header.Bounds.MaxLat, 53.5) || !almostEqual(header.Bounds.MinLon, -10.1) || !almostEqual(header.Bounds.MaxLon, 9.9) {
+		t.Errorf("Wrong bounds in header: %#v", header.Bounds)
+	}
+
+	var objects []osm.Object
+	for scanner.Scan() {
+		objects = append(objects, scanner.Object())
+	}
+	if scanner.Err() != nil {
+		t.Fatal(scanner.Err())
+	}
+
+	expectedIds := []osm.ObjectID{
+		osm.NodeID(1).ObjectID(1),
+		osm.NodeID(2).ObjectID(1),
+		osm.NodeID(3).ObjectID(1),
+		osm.WayID(10).ObjectID(1),
+		osm.WayID(11).ObjectID(1),
+		osm.RelationID(20).ObjectID(1),
+	}
+	if len(objects) != len(expectedIds) {
+		t.Fatalf("Expected %d objects but got %d", len(expectedIds), len(objects))
+	}
+	for i, obj := range objects {
+		// The version is not part of this comparison
+		if obj.ObjectID().Type() != expectedIds[i].Type() || obj.ObjectID().Ref() != expectedIds[i].Ref() {
+			t.Errorf("Expected object %s at position %d but got %s", expectedIds[i], i, obj.ObjectID())
+		}
+	}
+
+	node := objects[0].(*osm.Node)
+	if !almostEqual(node.Lat, 53.4) || !almostEqual(node.Lon, 9.8) || node.Version != 2 || node.User != "foo" || node.UserID != 42 || !node.Timestamp.Equal(timestamp) {
+		t.Errorf("Wrong node data: %#v", node)
+	}
+	if objects[2].(*osm.Node).Tags.Find("amenity") != "shelter" {
+		t.Errorf("Wrong node tags: %#v", objects[2].(*osm.Node).Tags)
+	}
+
+	way := objects[3].(*osm.Way)
+	if len(way.Nodes) != 3 || way.Nodes[0].ID != 3 || way.Nodes[1].ID != 2 || way.Nodes[2].ID != 1 {
+		t.Errorf("Wrong way nodes: %#v", way.Nodes)
+	}
+	if objects[4].(*osm.Way).Tags.Find("highway") != "path" {
+		t.Errorf("Wrong way tags: %#v", objects[4].(*osm.Way).Tags)
+	}
+
+	relation := objects[5].(*osm.Relation)
+	if len(relation.Members) != 2 || relation.Members[0].Type != osm.TypeWay || relation.Members[0].Ref != 11 || relation.Members[0].Role != "outer" || relation.Members[1].Type != osm.TypeNode || relation.Members[1].Ref != 1 {
+		t.Errorf("Wrong relation members: %#v", relation.Members)
+	}
+}
+
+func TestPbfWriter_unsortedInput(t *testing.T) {
+	writer, err := NewPbfWriter(filepath.Join(t.TempDir(), "output.osm.pbf"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	err = writer.WriteWay(&osm.Way{ID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writer.WriteWay(&osm.Way{ID: 1})
+	if err == nil {
+		t.Errorf("Expected error for unsorted way IDs")
+	}
+
+	err = writer.WriteNode(&osm.Node{ID: 5})
+	if err == nil {
+		t.Errorf("Expected error for node after ways")
+	}
+}
+
+func almostEqual(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-7
+}
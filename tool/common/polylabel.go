@@ -0,0 +1,125 @@
+package common
+
+import (
+	"container/heap"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+	"math"
+)
+
+// cell is a square area of the polygon used to search the pole of inaccessibility.
+type cell struct {
+	center orb.Point
+	// Half the size of the cell
+	halfSize float64
+	// Distance from the center to the polygon outline, negative if the center is outside the polygon
+	distance float64
+	// Maximum possible distance to the polygon outline of any point within the cell
+	maxDistance float64
+}
+
+func newCell(center orb.Point, halfSize float64, polygon orb.Polygon) *cell {
+	distance := signedDistanceToPolygon(center, polygon)
+	return &cell{
+		center:      center,
+		halfSize:    halfSize,
+		distance:    distance,
+		maxDistance: distance + halfSize*math.Sqrt2,
+	}
+}
+
+// cellQueue is a priority queue of cells with the most promising cell (highest maxDistance) first.
+type cellQueue []*cell
+
+func (q cellQueue) Len() int           { return len(q) }
+func (q cellQueue) Less(i, j int) bool { return q[i].maxDistance > q[j].maxDistance }
+func (q cellQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *cellQueue) Push(value any)    { *q = append(*q, value.(*cell)) }
+func (q *cellQueue) Pop() (result any) {
+	old := *q
+	result = old[len(old)-1]
+	*q = old[:len(old)-1]
+	return result
+}
+
+// PoleOfInaccessibility returns the point inside the polygon with the largest distance to its outline (including
+// holes), which is the best place for a label. Unlike the centroid, this point is always inside the polygon, even for
+// concave polygons. The "polylabel" algorithm is used, the result is accurate up to the given precision.
+func PoleOfInaccessibility(polygon orb.Polygon, precision float64) orb.Point {
+	if len(polygon) == 0 || len(polygon[0]) == 0 {
+		return orb.Point{}
+	}
+
+	bound := polygon[0].Bound()
+	width := bound.Max.X() - bound.Min.X()
+	height := bound.Max.Y() - bound.Min.Y()
+	cellSize := math.Min(width, height)
+	if cellSize == 0 {
+		return bound.Min
+	}
+	halfSize := cellSize / 2
+
+	// Cover the polygon with initial cells
+	queue := &cellQueue{}
+	for x := bound.Min.X(); x < bound.Max.X(); x += cellSize {
+		for y := bound.Min.Y(); y < bound.Max.Y(); y += cellSize {
+			heap.Push(queue, newCell(orb.Point{x + halfSize, y + halfSize}, halfSize, polygon))
+		}
+	}
+
+	// The centroid and the center of the bound are good first guesses
+	centroid, _ := planar.CentroidArea(polygon)
+	bestCell := newCell(centroid, 0, polygon)
+	boundCell := newCell(bound.Center(), 0, polygon)
+	if boundCell.distance > bestCell.distance {
+		bestCell = boundCell
+	}
+
+	for queue.Len() > 0 {
+		currentCell := heap.Pop(queue).(*cell)
+
+		if currentCell.distance > bestCell.distance {
+			bestCell = currentCell
+		}
+
+		// Skip cells that can't contain a better solution
+		if currentCell.maxDistance-bestCell.distance <= precision {
+			continue
+		}
+
+		halfSize = currentCell.halfSize / 2
+		x := currentCell.center.X()
+		y := currentCell.center.Y()
+		heap.Push(queue, newCell(orb.Point{x - halfSize, y - halfSize}, halfSize, polygon))
+		heap.Push(queue, newCell(orb.Point{x + halfSize, y - halfSize}, halfSize, polygon))
+		heap.Push(queue, newCell(orb.Point{x - halfSize, y + halfSize}, halfSize, polygon))
+		heap.Push(queue, newCell(orb.Point{x + halfSize, y + halfSize}, halfSize, polygon))
+	}
+
+	return bestCell.center
+}
+
+// signedDistanceToPolygon returns the distance of the point to the outline of the polygon. The distance is negative
+// for points outside the polygon.
+func signedDistanceToPolygon(point orb.Point, polygon orb.Polygon) float64 {
+	inside := false
+	minDistanceSquared := math.Inf(1)
+
+	for _, ring := range polygon {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			a := ring[i]
+			b := ring[j]
+
+			if (a.Y() > point.Y()) != (b.Y() > point.Y()) && point.X() < (b.X()-a.X())*(point.Y()-a.Y())/(b.Y()-a.Y())+a.X() {
+				inside = !inside
+			}
+
+			minDistanceSquared = math.Min(minDistanceSquared, planar.DistanceFromSegmentSquared(a, b, point))
+		}
+	}
+
+	if inside {
+		return math.Sqrt(minDistanceSquared)
+	}
+	return -math.Sqrt(minDistanceSquared)
+}
@@ -0,0 +1,42 @@
+package common
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+	"testing"
+)
+
+func TestPoleOfInaccessibility_concavePolygon(t *testing.T) {
+	// U-shaped polygon, its centroid is outside
+	polygon := orb.Polygon{{{0, 0}, {10, 0}, {10, 10}, {8, 10}, {8, 2}, {2, 2}, {2, 10}, {0, 10}, {0, 0}}}
+	centroid, _ := planar.CentroidArea(polygon)
+	if planar.PolygonContains(polygon, centroid) {
+		t.Fatalf("Centroid of test polygon should be outside")
+	}
+
+	// Act
+	point := PoleOfInaccessibility(polygon, 0.01)
+
+	// Assert
+	if !planar.PolygonContains(polygon, point) {
+		t.Errorf("Point %v is outside the polygon", point)
+	}
+	if signedDistanceToPolygon(point, polygon) < 0.9 {
+		t.Errorf("Point %v is too close to the outline", point)
+	}
+}
+
+func TestPoleOfInaccessibility_polygonWithHole(t *testing.T) {
+	polygon := orb.Polygon{
+		{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}},
+		{{2, 2}, {2, 8}, {8, 8}, {8, 2}, {2, 2}},
+	}
+
+	// Act
+	point := PoleOfInaccessibility(polygon, 0.01)
+
+	// Assert
+	if !planar.PolygonContains(polygon, point) {
+		t.Errorf("Point %v is outside the polygon", point)
+	}
+}
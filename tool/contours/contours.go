@@ -0,0 +1,162 @@
+package contours
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hauke96/sigolo"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"math"
+	"strconv"
+	"strings"
+	"tool/common"
+	"tool/dem"
+	"tool/geopackage"
+)
+
+// The layer name and attributes of the GeoPackage output and of vector tiles are the same as in the contour vector tiles
+// of MapTiler, so that the style of the QGIS project can be used for all of them.
+const (
+	layerName        = "contour"
+	heightAttribute  = "height"
+	nthLineAttribute = "nth_line"
+	// Value of the "nth_line" attribute of index contours, which the style expects to be drawn every 100 m.
+	nthLineOfIndexContours = 10
+)
+
+// GenerateContours creates contour lines from the given GeoTIFF file and writes them either into a GeoPackage file
+// (".gpkg") or an OSM-PBF file (".osm.pbf"). The lines have the given elevation interval in meters and each
+// indexInterval-th line is an index contour. The lines are smoothed by the given number of iterations.
+func GenerateContours(demFile string, outputFile string, interval float64, indexInterval int, smoothing int) error {
+	if interval <= 0 {
+		return errors.New(fmt.Sprintf("Invalid interval %f, it must be greater than 0", interval))
+	}
+	if indexInterval < 0 {
+		return errors.New(fmt.Sprintf("Invalid index interval %d, it must not be negative", indexInterval))
+	}
+	if smoothing < 0 {
+		return errors.New(fmt.Sprintf("Invalid number of smoothing iterations %d, it must not be negative", smoothing))
+	}
+
+	isGeoPackage := strings.HasSuffix(outputFile, ".gpkg")
+	if !isGeoPackage && !strings.HasSuffix(outputFile, ".osm.pbf") {
+		return errors.New(fmt.Sprintf("Unsupported output file %s, it must be a .gpkg or .osm.pbf file", outputFile))
+	}
+
+	sigolo.Info("Read DEM from %s", demFile)
+	terrain, err := dem.ReadGeoTiff(demFile)
+	if err != nil {
+		return err
+	}
+
+	sigolo.Info("Trace contour lines with an interval of %s m", formatElevation(interval))
+	contours := Trace(terrain, interval, indexInterval)
+	for _, contour := range contours {
+		contour.Line = smooth(contour.Line, smoothing)
+	}
+	sigolo.Info("Created %d contour lines", len(contours))
+
+	sigolo.Info("Write contour lines to %s", outputFile)
+	if isGeoPackage {
+		return writeGeoPackage(outputFile, contours, interval)
+	}
+	return writeOsmPbf(outputFile, contours, terrain.Bound())
+}
+
+func writeGeoPackage(outputFile string, contours []*Contour, interval float64) error {
+	heightType := "REAL"
+	if interval == math.Trunc(interval) {
+		heightType = "INTEGER"
+	}
+
+	writer, err := geopackage.NewLineWriter(outputFile, layerName, []string{heightAttribute, nthLineAttribute}, map[string]string{
+		heightAttribute:  heightType,
+		nthLineAttribute: "INTEGER",
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, contour := range contours {
+		nthLine := "1"
+		if contour.Index {
+			nthLine = strconv.Itoa(nthLineOfIndexContours)
+		}
+
+		err = writer.Write(contour.Line, osm.Tags{
+			{Key: heightAttribute, Value: formatElevation(contour.Elevation)},
+			{Key: nthLineAttribute, Value: nthLine},
+		})
+		if err != nil {
+			writer.Close()
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// writeOsmPbf writes the contours as ways with the tags commonly used for contours in OSM based maps: "contour",
+// "ele" and "contour_ext" (either "elevation_major" for index contours or "elevation_minor"). Node and way IDs start at 1.
+func writeOsmPbf(outputFile string, contours []*Contour, bound orb.Bound) error {
+	writer, err := common.NewPbfWriter(outputFile, &osm.Bounds{
+		MinLat: bound.Min.Lat(),
+		MaxLat: bound.Max.Lat(),
+		MinLon: bound.Min.Lon(),
+		MaxLon: bound.Max.Lon(),
+	})
+	if err != nil {
+		return err
+	}
+
+	var nextNodeId osm.NodeID = 1
+	wayNodes := make([]osm.WayNodes, len(contours))
+	for i, contour := range contours {
+		closed := contour.Line[0] == contour.Line[len(contour.Line)-1]
+		for j, point := range contour.Line {
+			if closed && j == len(contour.Line)-1 {
+				wayNodes[i] = append(wayNodes[i], wayNodes[i][0])
+				continue
+			}
+
+			node := &osm.Node{ID: nextNodeId, Version: 1, Lon: point.Lon(), Lat: point.Lat()}
+			err = writer.WriteNode(node)
+			if err != nil {
+				writer.Close()
+				return err
+			}
+			wayNodes[i] = append(wayNodes[i], osm.WayNode{ID: node.ID, Lon: node.Lon, Lat: node.Lat})
+			nextNodeId++
+		}
+	}
+
+	for i, contour := range contours {
+		contourExt := "elevation_minor"
+		if contour.Index {
+			contourExt = "elevation_major"
+		}
+
+		err = writer.WriteWay(&osm.Way{
+			ID:      osm.WayID(i + 1),
+			Version: 1,
+			Nodes:   wayNodes[i],
+			Tags: osm.Tags{
+				{Key: "contour", Value: "elevation"},
+				{Key: "contour_ext", Value: contourExt},
+				{Key: "ele", Value: formatElevation(contour.Elevation)},
+			},
+		})
+		if err != nil {
+			writer.Close()
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// formatElevation returns the elevation without unnecessary decimal places, e.g. "100" or "12.5". Rounding errors of
+// multiples of the interval (like 0.30000000000000004) are removed as well.
+func formatElevation(elevation float64) string {
+	return strconv.FormatFloat(math.Round(elevation*1e6)/1e6, 'f', -1, 64)
+}
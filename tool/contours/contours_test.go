@@ -0,0 +1,236 @@
+package contours
+
+import (
+	"context"
+	"database/sql"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"tool/dem"
+	"tool/relief"
+)
+
+// A hill of 30 m in the middle of pixels of 0.01°
+var hillDem = dem.New(5, 5, orb.Bound{Min: orb.Point{10, 47}, Max: orb.Point{10.05, 47.05}}, []float32{
+	0, 0, 0, 0, 0,
+	0, 10, 10, 10, 0,
+	0, 10, 30, 10, 0,
+	0, 10, 10, 10, 0,
+	0, 0, 0, 0, 0,
+})
+
+func TestTrace_hill(t *testing.T) {
+	// Act
+	contours := Trace(hillDem, 10, 2)
+
+	// Assert
+	// No contour at exactly the elevation of the summit
+	if len(contours) != 2 {
+		t.Fatalf("Expected 2 contours but got %d", len(contours))
+	}
+	for i, contour := range contours {
+		expectedElevation := float64(i+1) * 10
+		if contour.Elevation != expectedElevation {
+			t.Errorf("Expected elevation %f but got %f", expectedElevation, contour.Elevation)
+		}
+		if contour.Index != (i == 1) {
+			t.Errorf("Wrong index flag of contour %f", contour.Elevation)
+		}
+		if contour.Line[0] != contour.Line[len(contour.Line)-1] {
+			t.Errorf("Contour %f should be closed", contour.Elevation)
+		}
+	}
+
+	// The 20 m contour is halfway between the center and its neighbors
+	for _, point := range contours[1].Line {
+		if !almostEqual(planar.Distance(point, orb.Point{10.025, 47.025}), 0.005) {
+			t.Errorf("Point %v of 20 m contour is not halfway to the center", point)
+		}
+	}
+}
+
+func TestTrace_openContourAtBorder(t *testing.T) {
+	terrain := dem.New(3, 2, orb.Bound{Min: orb.Point{10, 47}, Max: orb.Point{10.03, 47.02}}, []float32{
+		0, 10, 20,
+		0, 10, 20,
+	})
+
+	// Act
+	contours := Trace(terrain, 15, 0)
+
+	// Assert
+	if len(contours) != 1 || len(contours[0].Line) != 2 || contours[0].Index {
+		t.Fatalf("Expected one unclosed contour but got %#v", contours)
+	}
+	if !almostEqual(contours[0].Line[0].Lon(), 10.02) || !almostEqual(contours[0].Line[1].Lon(), 10.02) {
+		t.Errorf("Expected contour between the second and third column but got %v", contours[0].Line)
+	}
+}
+
+func TestTrace_noData(t *testing.T) {
+	nan := float32(math.NaN())
+	terrain := dem.New(3, 3, orb.Bound{Min: orb.Point{10, 47}, Max: orb.Point{10.03, 47.03}}, []float32{
+		0, 0, 0,
+		0, 20, nan,
+		0, 0, 0,
+	})
+
+	// Act
+	contours := Trace(terrain, 10, 0)
+
+	// Assert
+	if len(contours) != 1 || contours[0].Line[0] == contours[0].Line[len(contours[0].Line)-1] {
+		t.Fatalf("Expected one contour interrupted by the missing pixel but got %#v", contours)
+	}
+}
+
+func TestSmooth(t *testing.T) {
+	closedLine := orb.LineString{{0, 0}, {4, 0}, {4, 4}, {0, 0}}
+	openLine := orb.LineString{{0, 0}, {4, 0}, {4, 4}}
+
+	// Act
+	smoothedClosedLine := smooth(closedLine, 2)
+	smoothedOpenLine := smooth(openLine, 1)
+
+	// Assert
+	if len(smoothedClosedLine) != 13 || smoothedClosedLine[0] != smoothedClosedLine[12] {
+		t.Errorf("Wrong smoothed closed line %v", smoothedClosedLine)
+	}
+	expected := orb.LineString{{0, 0}, {1, 0}, {3, 0}, {4, 1}, {4, 3}, {4, 4}}
+	if !smoothedOpenLine.Equal(expected) {
+		t.Errorf("Expected %v but got %v", expected, smoothedOpenLine)
+	}
+}
+
+func TestWriteGeoPackage(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "contours.gpkg")
+	contours := Trace(hillDem, 10, 2)
+
+	// Act
+	err := writeGeoPackage(outputFile, contours, 10)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM contour WHERE height = 20 AND nth_line = 10").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("Expected one index contour with height 20 but got %d", count)
+	}
+}
+
+func TestWriteOsmPbf(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "contours.osm.pbf")
+	contours := Trace(hillDem, 10, 2)
+
+	// Act
+	err := writeOsmPbf(outputFile, contours, hillDem.Bound())
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var ways []*osm.Way
+	nodeIds := map[osm.NodeID]bool{}
+	scanner := osmpbf.New(context.Background(), file, 1)
+	for scanner.Scan() {
+		switch obj := scanner.Object().(type) {
+		case *osm.Node:
+			nodeIds[obj.ID] = true
+		case *osm.Way:
+			ways = append(ways, obj)
+		}
+	}
+	if scanner.Err() != nil {
+		t.Fatal(scanner.Err())
+	}
+
+	if len(ways) != 2 {
+		t.Fatalf("Expected 2 ways but got %d", len(ways))
+	}
+	if ways[1].Tags.Find("ele") != "20" || ways[1].Tags.Find("contour_ext") != "elevation_major" || ways[0].Tags.Find("contour_ext") != "elevation_minor" {
+		t.Errorf("Wrong tags %v and %v", ways[0].Tags, ways[1].Tags)
+	}
+	for _, way := range ways {
+		if way.Nodes[0].ID != way.Nodes[len(way.Nodes)-1].ID {
+			t.Errorf("Way %d should be closed", way.ID)
+		}
+		for _, wayNode := range way.Nodes {
+			if !nodeIds[wayNode.ID] {
+				t.Errorf("Node %d of way %d doesn't exist", wayNode.ID, way.ID)
+			}
+		}
+	}
+}
+
+func TestVectorTile(t *testing.T) {
+	// The hill with the summit in the middle of a tile of 3x3 pixels
+	var elevations []float64
+	for y := 0; y < hillDem.Height(); y++ {
+		for x := 0; x < hillDem.Width(); x++ {
+			elevation, _ := hillDem.At(x, y)
+			elevations = append(elevations, elevation)
+		}
+	}
+	grid := relief.NewGrid(12, 1433, 3, elevations)
+
+	// Act
+	tileBytes, err := VectorTile(grid, 10, 2, 0)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := mvt.Unmarshal(tileBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 || layers[0].Name != "contour" || len(layers[0].Features) != 2 {
+		t.Fatalf("Expected one layer 'contour' with 2 contours but got %v", layers)
+	}
+
+	indexContour := layers[0].Features[1]
+	if indexContour.Properties.MustFloat64(heightAttribute) != 20 || indexContour.Properties.MustFloat64(nthLineAttribute) != 10 {
+		t.Errorf("Wrong properties of index contour %v", indexContour.Properties)
+	}
+	// The 20 m contour is half a pixel (4096/3/2 tile units) around the center of the tile
+	for _, point := range indexContour.Geometry.(orb.LineString) {
+		if math.Abs(planar.Distance(point, orb.Point{2048, 2048})-4096.0/6) > 1 {
+			t.Errorf("Point %v of 20 m contour is not half a pixel away from the center", point)
+		}
+	}
+}
+
+func TestFormatElevation(t *testing.T) {
+	if formatElevation(3*0.1) != "0.3" || formatElevation(100) != "100" || formatElevation(-12.5) != "-12.5" {
+		t.Errorf("Wrong formatted elevations")
+	}
+}
+
+func almostEqual(a float64, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
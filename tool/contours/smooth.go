@@ -0,0 +1,32 @@
+package contours
+
+import "github.com/paulmach/orb"
+
+// smooth applies the given number of iterations of Chaikin's corner cutting algorithm: Each segment is replaced by two
+// points at 1/4 and 3/4 of its length. The ends of unclosed lines stay where they are, so that contours still end at
+// the border of the DEM.
+func smooth(line orb.LineString, iterations int) orb.LineString {
+	for i := 0; i < iterations && len(line) > 2; i++ {
+		closed := line[0] == line[len(line)-1]
+
+		smoothedLine := make(orb.LineString, 0, 2*len(line))
+		if !closed {
+			smoothedLine = append(smoothedLine, line[0])
+		}
+		for j := 0; j < len(line)-1; j++ {
+			a, b := line[j], line[j+1]
+			smoothedLine = append(smoothedLine,
+				orb.Point{0.75*a.Lon() + 0.25*b.Lon(), 0.75*a.Lat() + 0.25*b.Lat()},
+				orb.Point{0.25*a.Lon() + 0.75*b.Lon(), 0.25*a.Lat() + 0.75*b.Lat()},
+			)
+		}
+		if closed {
+			smoothedLine = append(smoothedLine, smoothedLine[0])
+		} else {
+			smoothedLine = append(smoothedLine, line[len(line)-1])
+		}
+
+		line = smoothedLine
+	}
+	return line
+}
@@ -0,0 +1,48 @@
+package contours
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"math"
+	"tool/relief"
+)
+
+// VectorTile creates a Mapbox vector tile with the contour lines of the grid. The layer and attributes are the same as
+// in the GeoPackage output. Lines are traced including the border pixels of the grid and clipped with a small buffer
+// around the tile, so that they continue seamlessly in the neighboring tiles.
+func VectorTile(grid *relief.Grid, interval float64, indexInterval int, smoothing int) ([]byte, error) {
+	contours := Trace(grid.TilePixelDem(), interval, indexInterval)
+
+	// Coordinates of the DEM are tile pixels with negative rows, see TilePixelDem
+	scale := float64(mvt.DefaultExtent) / float64(grid.Size())
+
+	collection := geojson.NewFeatureCollection()
+	for _, contour := range contours {
+		line := smooth(contour.Line, smoothing)
+		for i, point := range line {
+			line[i] = orb.Point{point.X() * scale, -point.Y() * scale}
+		}
+
+		nthLine := 1
+		if contour.Index {
+			nthLine = nthLineOfIndexContours
+		}
+
+		feature := geojson.NewFeature(line)
+		feature.Properties[nthLineAttribute] = nthLine
+		if interval == math.Trunc(interval) {
+			feature.Properties[heightAttribute] = int(math.Round(contour.Elevation))
+		} else {
+			feature.Properties[heightAttribute] = math.Round(contour.Elevation*1e6) / 1e6
+		}
+		collection.Append(feature)
+	}
+
+	layer := mvt.NewLayer(layerName, collection)
+	layer.Version = 2
+	layer.Clip(mvt.MapboxGLDefaultExtentBound)
+	layer.RemoveEmpty(0, 0)
+
+	return mvt.Marshal(mvt.Layers{layer})
+}
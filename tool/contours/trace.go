@@ -0,0 +1,216 @@
+package contours
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+	"math"
+	"slices"
+	"sort"
+	"tool/dem"
+)
+
+// Contour is a contour line of the given elevation. Closed contours have the same first and last point.
+type Contour struct {
+	Elevation float64
+	// True for index contours, which are usually drawn thicker and labelled.
+	Index bool
+	Line  orb.LineString
+}
+
+// segment is a part of a contour within one cell of the marching squares algorithm. Both ends are on edges between two
+// pixel centers, see edgeId.
+type segment struct {
+	from int64
+	to   int64
+}
+
+// Trace creates the contour lines of the DEM using the marching squares algorithm on the pixel centers. Contours are
+// created for all multiples of the interval, every indexInterval-th contour is an index contour (none if 0). Contours
+// end at the border of the DEM and at pixels without data.
+func Trace(terrain *dem.Dem, interval float64, indexInterval int) []*Contour {
+	// Segments of all contours by their level (the elevation divided by the interval)
+	segmentsByLevel := map[int64][]segment{}
+
+	for y := 0; y < terrain.Height()-1; y++ {
+		for x := 0; x < terrain.Width()-1; x++ {
+			topLeft, ok1 := terrain.At(x, y)
+			topRight, ok2 := terrain.At(x+1, y)
+			bottomRight, ok3 := terrain.At(x+1, y+1)
+			bottomLeft, ok4 := terrain.At(x, y+1)
+			if !ok1 || !ok2 || !ok3 || !ok4 {
+				continue
+			}
+
+			minElevation := math.Min(math.Min(topLeft, topRight), math.Min(bottomRight, bottomLeft))
+			maxElevation := math.Max(math.Max(topLeft, topRight), math.Max(bottomRight, bottomLeft))
+
+			// Only levels with pixels above (or exactly at) and below them cross this cell
+			for level := int64(math.Floor(minElevation/interval)) + 1; float64(level)*interval <= maxElevation; level++ {
+				elevation := float64(level) * interval
+				segmentsByLevel[level] = appendCellSegments(segmentsByLevel[level], terrain.Width(), x, y, elevation, topLeft, topRight, bottomRight, bottomLeft)
+			}
+		}
+	}
+
+	var levels []int64
+	for level := range segmentsByLevel {
+		levels = append(levels, level)
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i] < levels[j]
+	})
+
+	var contours []*Contour
+	for _, level := range levels {
+		elevation := float64(level) * interval
+		for _, edges := range stitchSegments(segmentsByLevel[level]) {
+			line := make(orb.LineString, len(edges))
+			for i, edge := range edges {
+				line[i] = edgePoint(terrain, edge, elevation)
+			}
+			if planar.Length(line) == 0 {
+				// Contours at exactly the elevation of a summit pixel collapse into one point
+				continue
+			}
+
+			contours = append(contours, &Contour{
+				Elevation: elevation,
+				Index:     indexInterval > 0 && level%int64(indexInterval) == 0,
+				Line:      line,
+			})
+		}
+	}
+
+	return contours
+}
+
+// edgeId returns the ID of the edge from the pixel center x,y to the center of the pixel to the right of it or (for
+// vertical edges) below it.
+func edgeId(width int, x int, y int, vertical bool) int64 {
+	id := 2 * (int64(y)*int64(width) + int64(x))
+	if vertical {
+		id++
+	}
+	return id
+}
+
+// edgePoint returns the location on the given edge with the given elevation by linear interpolation of the elevations
+// of both pixels.
+func edgePoint(terrain *dem.Dem, edge int64, elevation float64) orb.Point {
+	x := int((edge / 2) % int64(terrain.Width()))
+	y := int((edge / 2) / int64(terrain.Width()))
+	x2, y2 := x+1, y
+	if edge%2 == 1 {
+		x2, y2 = x, y+1
+	}
+
+	// Both pixels have data, otherwise there would be no segment ending at this edge
+	elevation1, _ := terrain.At(x, y)
+	elevation2, _ := terrain.At(x2, y2)
+	t := (elevation - elevation1) / (elevation2 - elevation1)
+
+	point1 := terrain.PixelCenter(x, y)
+	point2 := terrain.PixelCenter(x2, y2)
+	return orb.Point{
+		point1.Lon() + t*(point2.Lon()-point1.Lon()),
+		point1.Lat() + t*(point2.Lat()-point1.Lat()),
+	}
+}
+
+// appendCellSegments appends the segments of the contour with the given elevation within the cell between the pixel
+// x,y and its right and lower neighbors.
+func appendCellSegments(segments []segment, width int, x int, y int, elevation float64, topLeft float64, topRight float64, bottomRight float64, bottomLeft float64) []segment {
+	top := edgeId(width, x, y, false)
+	right := edgeId(width, x+1, y, true)
+	bottom := edgeId(width, x, y+1, false)
+	left := edgeId(width, x, y, true)
+
+	cellCase := 0
+	for _, cornerElevation := range []float64{topLeft, topRight, bottomRight, bottomLeft} {
+		cellCase <<= 1
+		if cornerElevation >= elevation {
+			cellCase |= 1
+		}
+	}
+
+	switch cellCase {
+	case 0b0000, 0b1111:
+		return segments
+	case 0b1000, 0b0111:
+		return append(segments, segment{left, top})
+	case 0b0100, 0b1011:
+		return append(segments, segment{top, right})
+	case 0b0010, 0b1101:
+		return append(segments, segment{right, bottom})
+	case 0b0001, 0b1110:
+		return append(segments, segment{bottom, left})
+	case 0b1100, 0b0011:
+		return append(segments, segment{left, right})
+	case 0b0110, 0b1001:
+		return append(segments, segment{top, bottom})
+	}
+
+	// Saddle with two opposite corners above the elevation. The average of all corners decides whether these corners
+	// are connected through the middle of the cell or separated.
+	centerIsAbove := (topLeft+topRight+bottomRight+bottomLeft)/4 >= elevation
+	topLeftIsAbove := cellCase == 0b1010
+	if centerIsAbove == topLeftIsAbove {
+		// Top left and bottom right corner are connected
+		return append(segments, segment{top, right}, segment{bottom, left})
+	}
+	return append(segments, segment{left, top}, segment{right, bottom})
+}
+
+// stitchSegments joins the segments of one contour level into lines of edge IDs. Each edge is shared by at most two
+// segments, so the lines are unambiguous.
+func stitchSegments(segments []segment) [][]int64 {
+	segmentsByEdge := map[int64][]int{}
+	for i, s := range segments {
+		segmentsByEdge[s.from] = append(segmentsByEdge[s.from], i)
+		segmentsByEdge[s.to] = append(segmentsByEdge[s.to], i)
+	}
+
+	used := make([]bool, len(segments))
+
+	// nextEdge returns the other end of an unused segment at the given edge and marks this segment as used.
+	nextEdge := func(edge int64) (int64, bool) {
+		for _, i := range segmentsByEdge[edge] {
+			if used[i] {
+				continue
+			}
+			used[i] = true
+			if segments[i].from == edge {
+				return segments[i].to, true
+			}
+			return segments[i].from, true
+		}
+		return 0, false
+	}
+
+	var lines [][]int64
+	for i, s := range segments {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+
+		line := []int64{s.from, s.to}
+		for edge, ok := nextEdge(s.to); ok; edge, ok = nextEdge(edge) {
+			line = append(line, edge)
+		}
+
+		if line[len(line)-1] != line[0] {
+			// Not closed, so the line might continue at its start
+			var head []int64
+			for edge, ok := nextEdge(s.from); ok; edge, ok = nextEdge(edge) {
+				head = append(head, edge)
+			}
+			slices.Reverse(head)
+			line = append(head, line...)
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
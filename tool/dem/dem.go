@@ -0,0 +1,145 @@
+package dem
+
+import (
+	"github.com/paulmach/orb"
+	"math"
+)
+
+// Approximate length of one degree latitude in meters.
+const metersPerDegree = 111_320.0
+
+// Dem is a digital elevation model in WGS84 coordinates with elevations in meters. The pixels are stored row by row
+// starting with the northernmost row. Pixels without data are NaN.
+type Dem struct {
+	width      int
+	height     int
+	elevations []float32
+	// The upper left corner of the upper left pixel
+	minLon float64
+	maxLat float64
+	// Size of a pixel in degrees
+	pixelWidth  float64
+	pixelHeight float64
+
+	// Used to mark visited pixels when searching through the DEM without clearing the whole array each time, see visit.
+	visited      []uint32
+	visitedStamp uint32
+}
+
+// New creates a DEM covering the given bound with the given elevations (row by row, starting in the north).
+func New(width int, height int, bound orb.Bound, elevations []float32) *Dem {
+	return &Dem{
+		width:       width,
+		height:      height,
+		elevations:  elevations,
+		minLon:      bound.Min.Lon(),
+		maxLat:      bound.Max.Lat(),
+		pixelWidth:  (bound.Max.Lon() - bound.Min.Lon()) / float64(width),
+		pixelHeight: (bound.Max.Lat() - bound.Min.Lat()) / float64(height),
+	}
+}
+
+func (d *Dem) Width() int {
+	return d.width
+}
+
+func (d *Dem) Height() int {
+	return d.height
+}
+
+func (d *Dem) Bound() orb.Bound {
+	return orb.Bound{
+		Min: orb.Point{d.minLon, d.maxLat - float64(d.height)*d.pixelHeight},
+		Max: orb.Point{d.minLon + float64(d.width)*d.pixelWidth, d.maxLat},
+	}
+}
+
+// At returns the elevation of the given pixel. False is returned for pixels outside the DEM or without data.
+func (d *Dem) At(x int, y int) (float64, bool) {
+	if x < 0 || y < 0 || x >= d.width || y >= d.height {
+		return 0, false
+	}
+	elevation := d.elevations[y*d.width+x]
+	if math.IsNaN(float64(elevation)) {
+		return 0, false
+	}
+	return float64(elevation), true
+}
+
+// PixelOf returns the pixel containing the given location. False is returned for locations outside the DEM.
+func (d *Dem) PixelOf(location orb.Point) (int, int, bool) {
+	x := int(math.Floor((location.Lon() - d.minLon) / d.pixelWidth))
+	y := int(math.Floor((d.maxLat - location.Lat()) / d.pixelHeight))
+	if x < 0 || y < 0 || x >= d.width || y >= d.height {
+		return 0, 0, false
+	}
+	return x, y, true
+}
+
+// PixelCenter returns the location of the center of the given pixel.
+func (d *Dem) PixelCenter(x int, y int) orb.Point {
+	return orb.Point{
+		d.minLon + (float64(x)+0.5)*d.pixelWidth,
+		d.maxLat - (float64(y)+0.5)*d.pixelHeight,
+	}
+}
+
+// Elevation returns the bilinear interpolated elevation at the given location. False is returned for locations outside
+// the DEM or without data.
+func (d *Dem) Elevation(location orb.Point) (float64, bool) {
+	// Position relative to the centers of the pixels
+	fx := (location.Lon()-d.minLon)/d.pixelWidth - 0.5
+	fy := (d.maxLat-location.Lat())/d.pixelHeight - 0.5
+	if fx < -0.5 || fy < -0.5 || fx > float64(d.width)-0.5 || fy > float64(d.height)-0.5 {
+		return 0, false
+	}
+
+	// Clamp to the outermost pixel centers, so that the border area of the DEM uses the nearest pixels
+	fx = math.Max(0, math.Min(fx, float64(d.width-1)))
+	fy = math.Max(0, math.Min(fy, float64(d.height-1)))
+	x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+	x1, y1 := min(x0+1, d.width-1), min(y0+1, d.height-1)
+	dx, dy := fx-float64(x0), fy-float64(y0)
+
+	e00, ok00 := d.At(x0, y0)
+	e10, ok10 := d.At(x1, y0)
+	e01, ok01 := d.At(x0, y1)
+	e11, ok11 := d.At(x1, y1)
+	if !ok00 || !ok10 || !ok01 || !ok11 {
+		// Fall back to the nearest pixel
+		return d.At(int(math.Round(fx)), int(math.Round(fy)))
+	}
+
+	top := e00*(1-dx) + e10*dx
+	bottom := e01*(1-dx) + e11*dx
+	return top*(1-dy) + bottom*dy, true
+}
+
+// PixelSizeInMeters returns the approximate width and height of a pixel in meters in the given row.
+func (d *Dem) PixelSizeInMeters(y int) (float64, float64) {
+	lat := d.maxLat - (float64(y)+0.5)*d.pixelHeight
+	return d.pixelWidth * metersPerDegree * math.Cos(lat*math.Pi/180), d.pixelHeight * metersPerDegree
+}
+
+// startVisit prepares the marking of visited pixels for a new search.
+func (d *Dem) startVisit() {
+	if d.visited == nil {
+		d.visited = make([]uint32, d.width*d.height)
+	}
+	d.visitedStamp++
+	if d.visitedStamp == 0 {
+		// Overflow, so old stamps might be mistaken as current ones
+		clear(d.visited)
+		d.visitedStamp = 1
+	}
+}
+
+// visit marks the given pixel as visited and returns false if it has already been visited since startVisit.
+func (d *Dem) visit(x int, y int) bool {
+	index := y*d.width + x
+	if d.visited[index] == d.visitedStamp {
+		return false
+	}
+	d.visited[index] = d.visitedStamp
+	return true
+}
@@ -0,0 +1,438 @@
+package dem
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/hauke96/sigolo"
+	"golang.org/x/image/tiff/lzw"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TIFF and GeoTIFF tags, see https://www.awaresystems.be/imaging/tiff/tifftags.html and
+// http://geotiff.maptools.org/spec/geotiff2.4.html
+const (
+	tagImageWidth                = 256
+	tagImageLength               = 257
+	tagBitsPerSample             = 258
+	tagCompression               = 259
+	tagStripOffsets              = 273
+	tagSamplesPerPixel           = 277
+	tagRowsPerStrip              = 278
+	tagStripByteCounts           = 279
+	tagPlanarConfiguration       = 284
+	tagPredictor                 = 317
+	tagTileWidth                 = 322
+	tagTileLength                = 323
+	tagTileOffsets               = 324
+	tagTileByteCounts            = 325
+	tagSampleFormat              = 339
+	tagModelPixelScale           = 33550
+	tagModelTiepoint             = 33922
+	tagModelTransformation       = 34264
+	tagGeoKeyDirectory           = 34735
+	tagGdalNoData                = 42113
+	geoKeyModelType              = 1024
+	geoKeyRasterType             = 1025
+	modelTypeGeographic          = 2
+	rasterTypePixelIsPoint       = 2
+	compressionNone              = 1
+	compressionLzw               = 5
+	compressionDeflate           = 8
+	compressionDeflateObsolete   = 32946
+	predictorNone                = 1
+	predictorHorizontal          = 2
+	predictorFloatingPoint       = 3
+	sampleFormatUnsignedInteger  = 1
+	sampleFormatSignedInteger    = 2
+	sampleFormatFloatingPoint    = 3
+	planarConfigurationContigous = 1
+)
+
+// Sizes in bytes of the TIFF field types
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// ReadGeoTiff reads the first band of the given GeoTIFF file as DEM. Only files in geographic coordinates (e.g.
+// EPSG:4326) are supported, other files can be converted using e.g. "gdalwarp -t_srs EPSG:4326 in.tif out.tif". The
+// data may be stored in strips or tiles and be uncompressed, LZW or deflate compressed.
+func ReadGeoTiff(fileName string) (*Dem, error) {
+	sigolo.Debug("Read GeoTIFF file %s", fileName)
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	dem, err := parseGeoTiff(data)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error reading GeoTIFF file %s: %s", fileName, err.Error()))
+	}
+
+	sigolo.Debug("Read DEM with %dx%d pixels covering %v", dem.width, dem.height, dem.Bound())
+	return dem, nil
+}
+
+type tiffReader struct {
+	data      []byte
+	byteOrder binary.ByteOrder
+	// All numeric values of the first IFD
+	values map[uint16][]float64
+	// All ASCII values of the first IFD
+	strings map[uint16]string
+}
+
+func parseGeoTiff(data []byte) (*Dem, error) {
+	if len(data) < 8 {
+		return nil, errors.New("File too short")
+	}
+
+	r := &tiffReader{
+		data:    data,
+		values:  map[uint16][]float64{},
+		strings: map[uint16]string{},
+	}
+	switch string(data[0:2]) {
+	case "II":
+		r.byteOrder = binary.LittleEndian
+	case "MM":
+		r.byteOrder = binary.BigEndian
+	default:
+		return nil, errors.New("Not a TIFF file")
+	}
+	if magic := r.byteOrder.Uint16(data[2:4]); magic != 42 {
+		return nil, errors.New(fmt.Sprintf("Unsupported TIFF version %d (BigTIFF is not supported)", magic))
+	}
+
+	err := r.readIfd(int(r.byteOrder.Uint32(data[4:8])))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.readDem()
+}
+
+// readIfd reads all entries of the image file directory at the given offset.
+func (r *tiffReader) readIfd(offset int) error {
+	if offset+2 > len(r.data) {
+		return errors.New("Invalid IFD offset")
+	}
+	numberOfEntries := int(r.byteOrder.Uint16(r.data[offset:]))
+
+	for i := 0; i < numberOfEntries; i++ {
+		entryOffset := offset + 2 + i*12
+		if entryOffset+12 > len(r.data) {
+			return errors.New("IFD exceeds file")
+		}
+		entry := r.data[entryOffset : entryOffset+12]
+		tag := r.byteOrder.Uint16(entry[0:2])
+		fieldType := r.byteOrder.Uint16(entry[2:4])
+		count := int(r.byteOrder.Uint32(entry[4:8]))
+
+		typeSize, ok := tiffTypeSizes[fieldType]
+		if !ok {
+			// Unknown types (e.g. of private tags) are irrelevant here
+			continue
+		}
+
+		valueData := entry[8:12]
+		if typeSize*count > 4 {
+			valueOffset := int(r.byteOrder.Uint32(entry[8:12]))
+			if valueOffset+typeSize*count > len(r.data) {
+				return errors.New(fmt.Sprintf("Value of tag %d exceeds file", tag))
+			}
+			valueData = r.data[valueOffset : valueOffset+typeSize*count]
+		}
+
+		if fieldType == 2 {
+			r.strings[tag] = strings.TrimRight(string(valueData[:count]), "\x00")
+			continue
+		}
+
+		values := make([]float64, count)
+		for j := range values {
+			values[j] = r.decodeValue(fieldType, valueData[j*typeSize:])
+		}
+		r.values[tag] = values
+	}
+
+	return nil
+}
+
+func (r *tiffReader) decodeValue(fieldType uint16, data []byte) float64 {
+	switch fieldType {
+	case 1, 7:
+		return float64(data[0])
+	case 6:
+		return float64(int8(data[0]))
+	case 3:
+		return float64(r.byteOrder.Uint16(data))
+	case 8:
+		return float64(int16(r.byteOrder.Uint16(data)))
+	case 4:
+		return float64(r.byteOrder.Uint32(data))
+	case 9:
+		return float64(int32(r.byteOrder.Uint32(data)))
+	case 5:
+		return float64(r.byteOrder.Uint32(data)) / float64(r.byteOrder.Uint32(data[4:]))
+	case 10:
+		return float64(int32(r.byteOrder.Uint32(data))) / float64(int32(r.byteOrder.Uint32(data[4:])))
+	case 11:
+		return float64(math.Float32frombits(r.byteOrder.Uint32(data)))
+	case 12:
+		return math.Float64frombits(r.byteOrder.Uint64(data))
+	}
+	return 0
+}
+
+// value returns the first value of the given tag or the default value if the tag doesn't exist.
+func (r *tiffReader) value(tag uint16, defaultValue int) int {
+	values := r.values[tag]
+	if len(values) == 0 {
+		return defaultValue
+	}
+	return int(values[0])
+}
+
+func (r *tiffReader) readDem() (*Dem, error) {
+	width := r.value(tagImageWidth, 0)
+	height := r.value(tagImageLength, 0)
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("Image has no size")
+	}
+
+	if r.value(tagSamplesPerPixel, 1) != 1 && r.value(tagPlanarConfiguration, planarConfigurationContigous) == planarConfigurationContigous {
+		return nil, errors.New("Only files with one band or separate planes are supported")
+	}
+
+	dem := &Dem{
+		width:      width,
+		height:     height,
+		elevations: make([]float32, width*height),
+	}
+
+	err := r.readGeoReference(dem)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.readPixels(dem)
+	if err != nil {
+		return nil, err
+	}
+
+	if noDataValue, ok := r.strings[tagGdalNoData]; ok {
+		noData, err := strconv.ParseFloat(strings.TrimSpace(noDataValue), 64)
+		if err == nil {
+			for i, elevation := range dem.elevations {
+				if float64(elevation) == float64(float32(noData)) {
+					dem.elevations[i] = float32(math.NaN())
+				}
+			}
+		}
+	}
+
+	return dem, nil
+}
+
+// readGeoReference determines the location and pixel size of the DEM.
+func (r *tiffReader) readGeoReference(dem *Dem) error {
+	geoKeys := map[int]int{}
+	if directory := r.values[tagGeoKeyDirectory]; len(directory) >= 4 {
+		numberOfKeys := int(directory[3])
+		for i := 0; i < numberOfKeys && 4+i*4+3 < len(directory); i++ {
+			key := directory[4+i*4:]
+			// Only keys with the value stored directly in the directory (location 0) are relevant here
+			if key[1] == 0 {
+				geoKeys[int(key[0])] = int(key[3])
+			}
+		}
+	}
+	if modelType, ok := geoKeys[geoKeyModelType]; ok && modelType != modelTypeGeographic {
+		return errors.New("Only geographic coordinates (e.g. EPSG:4326) are supported, use e.g. gdalwarp to reproject the file")
+	}
+
+	scale := r.values[tagModelPixelScale]
+	tiepoint := r.values[tagModelTiepoint]
+	transformation := r.values[tagModelTransformation]
+	if len(scale) >= 2 && len(tiepoint) >= 6 {
+		dem.pixelWidth = scale[0]
+		dem.pixelHeight = scale[1]
+		dem.minLon = tiepoint[3] - tiepoint[0]*scale[0]
+		dem.maxLat = tiepoint[4] + tiepoint[1]*scale[1]
+	} else if len(transformation) >= 8 && transformation[1] == 0 && transformation[4] == 0 {
+		dem.pixelWidth = transformation[0]
+		dem.pixelHeight = -transformation[5]
+		dem.minLon = transformation[3]
+		dem.maxLat = transformation[7]
+	} else {
+		return errors.New("No supported georeference found (pixel scale and tiepoint or a transformation without rotation)")
+	}
+	if dem.pixelWidth <= 0 || dem.pixelHeight <= 0 {
+		return errors.New("Only north-up images are supported")
+	}
+
+	if geoKeys[geoKeyRasterType] == rasterTypePixelIsPoint {
+		// The coordinates refer to the center of the upper left pixel
+		dem.minLon -= dem.pixelWidth / 2
+		dem.maxLat += dem.pixelHeight / 2
+	}
+
+	return nil
+}
+
+// readPixels decodes all strips or tiles into the elevations of the DEM.
+func (r *tiffReader) readPixels(dem *Dem) error {
+	chunkWidth := r.value(tagTileWidth, dem.width)
+	chunkHeight := r.value(tagTileLength, r.value(tagRowsPerStrip, dem.height))
+	offsets := r.values[tagTileOffsets]
+	byteCounts := r.values[tagTileByteCounts]
+	if offsets == nil {
+		offsets = r.values[tagStripOffsets]
+		byteCounts = r.values[tagStripByteCounts]
+		chunkHeight = min(chunkHeight, dem.height)
+	}
+	if len(offsets) == 0 || len(offsets) != len(byteCounts) {
+		return errors.New("No strips or tiles found")
+	}
+
+	bitsPerSample := r.value(tagBitsPerSample, 1)
+	sampleFormat := r.value(tagSampleFormat, sampleFormatUnsignedInteger)
+	decodeSample, err := r.sampleDecoder(bitsPerSample, sampleFormat)
+	if err != nil {
+		return err
+	}
+	bytesPerSample := bitsPerSample / 8
+	compression := r.value(tagCompression, compressionNone)
+	predictor := r.value(tagPredictor, predictorNone)
+
+	chunksPerRow := (dem.width + chunkWidth - 1) / chunkWidth
+	chunksPerColumn := (dem.height + chunkHeight - 1) / chunkHeight
+	if len(offsets) < chunksPerRow*chunksPerColumn {
+		return errors.New(fmt.Sprintf("Expected %d strips or tiles but found %d", chunksPerRow*chunksPerColumn, len(offsets)))
+	}
+
+	for i := 0; i < chunksPerRow*chunksPerColumn; i++ {
+		offset, byteCount := int(offsets[i]), int(byteCounts[i])
+		if offset+byteCount > len(r.data) {
+			return errors.New(fmt.Sprintf("Strip or tile %d exceeds file", i))
+		}
+
+		chunk, err := decompress(r.data[offset:offset+byteCount], compression)
+		if err != nil {
+			return err
+		}
+		if len(chunk) < chunkWidth*chunkHeight*bytesPerSample {
+			// The last strip might be shorter
+			chunk = append(chunk, make([]byte, chunkWidth*chunkHeight*bytesPerSample-len(chunk))...)
+		}
+
+		byteOrder := r.byteOrder
+		switch predictor {
+		case predictorNone:
+		case predictorHorizontal:
+			undoHorizontalPredictor(chunk, chunkWidth, chunkHeight, bytesPerSample, r.byteOrder)
+		case predictorFloatingPoint:
+			chunk = undoFloatingPointPredictor(chunk, chunkWidth, chunkHeight, bytesPerSample)
+			byteOrder = binary.LittleEndian
+		default:
+			return errors.New(fmt.Sprintf("Unsupported predictor %d", predictor))
+		}
+
+		chunkX := (i % chunksPerRow) * chunkWidth
+		chunkY := (i / chunksPerRow) * chunkHeight
+		for y := 0; y < chunkHeight && chunkY+y < dem.height; y++ {
+			for x := 0; x < chunkWidth && chunkX+x < dem.width; x++ {
+				sampleOffset := (y*chunkWidth + x) * bytesPerSample
+				dem.elevations[(chunkY+y)*dem.width+chunkX+x] = decodeSample(chunk[sampleOffset:], byteOrder)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *tiffReader) sampleDecoder(bitsPerSample int, sampleFormat int) (func(data []byte, byteOrder binary.ByteOrder) float32, error) {
+	switch {
+	case bitsPerSample == 8 && sampleFormat == sampleFormatUnsignedInteger:
+		return func(data []byte, _ binary.ByteOrder) float32 { return float32(data[0]) }, nil
+	case bitsPerSample == 8 && sampleFormat == sampleFormatSignedInteger:
+		return func(data []byte, _ binary.ByteOrder) float32 { return float32(int8(data[0])) }, nil
+	case bitsPerSample == 16 && sampleFormat == sampleFormatUnsignedInteger:
+		return func(data []byte, o binary.ByteOrder) float32 { return float32(o.Uint16(data)) }, nil
+	case bitsPerSample == 16 && sampleFormat == sampleFormatSignedInteger:
+		return func(data []byte, o binary.ByteOrder) float32 { return float32(int16(o.Uint16(data))) }, nil
+	case bitsPerSample == 32 && sampleFormat == sampleFormatUnsignedInteger:
+		return func(data []byte, o binary.ByteOrder) float32 { return float32(o.Uint32(data)) }, nil
+	case bitsPerSample == 32 && sampleFormat == sampleFormatSignedInteger:
+		return func(data []byte, o binary.ByteOrder) float32 { return float32(int32(o.Uint32(data))) }, nil
+	case bitsPerSample == 32 && sampleFormat == sampleFormatFloatingPoint:
+		return func(data []byte, o binary.ByteOrder) float32 { return math.Float32frombits(o.Uint32(data)) }, nil
+	case bitsPerSample == 64 && sampleFormat == sampleFormatFloatingPoint:
+		return func(data []byte, o binary.ByteOrder) float32 { return float32(math.Float64frombits(o.Uint64(data))) }, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unsupported sample type with %d bits and format %d", bitsPerSample, sampleFormat))
+}
+
+func decompress(data []byte, compression int) ([]byte, error) {
+	switch compression {
+	case compressionNone:
+		return data, nil
+	case compressionLzw:
+		return io.ReadAll(lzw.NewReader(bytes.NewReader(data), lzw.MSB, 8))
+	case compressionDeflate, compressionDeflateObsolete:
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+	return nil, errors.New(fmt.Sprintf("Unsupported compression %d", compression))
+}
+
+// undoHorizontalPredictor turns the differences between neighboring samples of each row back into the actual values.
+func undoHorizontalPredictor(data []byte, width int, height int, bytesPerSample int, byteOrder binary.ByteOrder) {
+	for y := 0; y < height; y++ {
+		row := data[y*width*bytesPerSample : (y+1)*width*bytesPerSample]
+		for x := 1; x < width; x++ {
+			previous, current := row[(x-1)*bytesPerSample:], row[x*bytesPerSample:]
+			switch bytesPerSample {
+			case 1:
+				current[0] += previous[0]
+			case 2:
+				byteOrder.PutUint16(current, byteOrder.Uint16(current)+byteOrder.Uint16(previous))
+			case 4:
+				byteOrder.PutUint32(current, byteOrder.Uint32(current)+byteOrder.Uint32(previous))
+			case 8:
+				byteOrder.PutUint64(current, byteOrder.Uint64(current)+byteOrder.Uint64(previous))
+			}
+		}
+	}
+}
+
+// undoFloatingPointPredictor reverses the floating point predictor of TIFF files written by e.g. GDAL: The bytes of each
+// row are stored as differences and grouped by their significance (all most significant bytes first). The result is in
+// little endian byte order.
+func undoFloatingPointPredictor(data []byte, width int, height int, bytesPerSample int) []byte {
+	result := make([]byte, len(data))
+	rowSize := width * bytesPerSample
+	for y := 0; y < height; y++ {
+		row := data[y*rowSize : (y+1)*rowSize]
+		for i := 1; i < rowSize; i++ {
+			row[i] += row[i-1]
+		}
+
+		resultRow := result[y*rowSize : (y+1)*rowSize]
+		for x := 0; x < width; x++ {
+			for b := 0; b < bytesPerSample; b++ {
+				resultRow[x*bytesPerSample+b] = row[(bytesPerSample-b-1)*width+x]
+			}
+		}
+	}
+	return result
+}
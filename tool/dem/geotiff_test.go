@@ -0,0 +1,246 @@
+package dem
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testTiffEntry struct {
+	tag       uint16
+	fieldType uint16
+	values    []float64
+	text      string
+}
+
+// writeTestGeoTiff writes a little endian GeoTIFF file with 16-bit signed integer samples. The sample data must already
+// be encoded according to the given compression and predictor.
+func writeTestGeoTiff(t *testing.T, width int, height int, chunks [][]byte, tiled bool, compression int, predictor int, extraEntries []testTiffEntry) string {
+	buffer := &bytes.Buffer{}
+	buffer.WriteString("II")
+	binary.Write(buffer, binary.LittleEndian, uint16(42))
+	binary.Write(buffer, binary.LittleEndian, uint32(0)) // IFD offset, set below
+
+	var offsets, byteCounts []float64
+	for _, chunk := range chunks {
+		offsets = append(offsets, float64(buffer.Len()))
+		byteCounts = append(byteCounts, float64(len(chunk)))
+		buffer.Write(chunk)
+	}
+
+	entries := []testTiffEntry{
+		{tag: tagImageWidth, fieldType: 4, values: []float64{float64(width)}},
+		{tag: tagImageLength, fieldType: 4, values: []float64{float64(height)}},
+		{tag: tagBitsPerSample, fieldType: 3, values: []float64{16}},
+		{tag: tagCompression, fieldType: 3, values: []float64{float64(compression)}},
+		{tag: tagSamplesPerPixel, fieldType: 3, values: []float64{1}},
+		{tag: tagPredictor, fieldType: 3, values: []float64{float64(predictor)}},
+		{tag: tagSampleFormat, fieldType: 3, values: []float64{sampleFormatSignedInteger}},
+		{tag: tagModelPixelScale, fieldType: 12, values: []float64{0.5, 0.25, 0}},
+		{tag: tagModelTiepoint, fieldType: 12, values: []float64{0, 0, 0, 10, 54, 0}},
+		{tag: tagGeoKeyDirectory, fieldType: 3, values: []float64{1, 1, 0, 2, geoKeyModelType, 0, 1, modelTypeGeographic, 2048, 0, 1, 4326}},
+	}
+	if tiled {
+		entries = append(entries,
+			testTiffEntry{tag: tagTileWidth, fieldType: 3, values: []float64{2}},
+			testTiffEntry{tag: tagTileLength, fieldType: 3, values: []float64{2}},
+			testTiffEntry{tag: tagTileOffsets, fieldType: 4, values: offsets},
+			testTiffEntry{tag: tagTileByteCounts, fieldType: 4, values: byteCounts})
+	} else {
+		entries = append(entries,
+			testTiffEntry{tag: tagStripOffsets, fieldType: 4, values: offsets},
+			testTiffEntry{tag: tagRowsPerStrip, fieldType: 3, values: []float64{float64(height / len(chunks))}},
+			testTiffEntry{tag: tagStripByteCounts, fieldType: 4, values: byteCounts})
+	}
+	entries = append(entries, extraEntries...)
+
+	// Values not fitting into the entries are written in front of the IFD
+	var entryData [][]byte
+	for _, entry := range entries {
+		data := &bytes.Buffer{}
+		if entry.fieldType == 2 {
+			data.WriteString(entry.text + "\x00")
+		}
+		for _, value := range entry.values {
+			switch entry.fieldType {
+			case 3:
+				binary.Write(data, binary.LittleEndian, uint16(value))
+			case 4:
+				binary.Write(data, binary.LittleEndian, uint32(value))
+			case 12:
+				binary.Write(data, binary.LittleEndian, value)
+			}
+		}
+		if data.Len() > 4 {
+			offset := buffer.Len()
+			buffer.Write(data.Bytes())
+			data.Reset()
+			binary.Write(data, binary.LittleEndian, uint32(offset))
+		}
+		for data.Len() < 4 {
+			data.WriteByte(0)
+		}
+		entryData = append(entryData, data.Bytes())
+	}
+
+	ifdOffset := buffer.Len()
+	binary.Write(buffer, binary.LittleEndian, uint16(len(entries)))
+	for i, entry := range entries {
+		count := len(entry.values)
+		if entry.fieldType == 2 {
+			count = len(entry.text) + 1
+		}
+		binary.Write(buffer, binary.LittleEndian, entry.tag)
+		binary.Write(buffer, binary.LittleEndian, entry.fieldType)
+		binary.Write(buffer, binary.LittleEndian, uint32(count))
+		buffer.Write(entryData[i])
+	}
+	binary.Write(buffer, binary.LittleEndian, uint32(0))
+
+	data := buffer.Bytes()
+	binary.LittleEndian.PutUint32(data[4:], uint32(ifdOffset))
+
+	fileName := filepath.Join(t.TempDir(), "dem.tif")
+	err := os.WriteFile(fileName, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func encodeInt16(values ...int16) []byte {
+	buffer := &bytes.Buffer{}
+	binary.Write(buffer, binary.LittleEndian, values)
+	return buffer.Bytes()
+}
+
+func deflate(t *testing.T, data []byte) []byte {
+	buffer := &bytes.Buffer{}
+	writer := zlib.NewWriter(buffer)
+	_, err := writer.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func verifyTestDem(t *testing.T, dem *Dem) {
+	if dem.Width() != 4 || dem.Height() != 2 {
+		t.Fatalf("Wrong size %dx%d", dem.Width(), dem.Height())
+	}
+
+	bound := dem.Bound()
+	if bound.Min.Lon() != 10 || bound.Max.Lon() != 12 || bound.Min.Lat() != 53.5 || bound.Max.Lat() != 54 {
+		t.Errorf("Wrong bound %v", bound)
+	}
+
+	expected := []float64{100, 200, -300, 400, 500, 600, 700, 800}
+	for i, expectedElevation := range expected {
+		elevation, ok := dem.At(i%4, i/4)
+		if !ok || elevation != expectedElevation {
+			t.Errorf("Expected elevation %f at pixel %d but got %f", expectedElevation, i, elevation)
+		}
+	}
+}
+
+func TestReadGeoTiff_strips(t *testing.T) {
+	fileName := writeTestGeoTiff(t, 4, 2, [][]byte{
+		encodeInt16(100, 200, -300, 400),
+		encodeInt16(500, 600, 700, 800),
+	}, false, compressionNone, predictorNone, nil)
+
+	// Act
+	dem, err := ReadGeoTiff(fileName)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyTestDem(t, dem)
+}
+
+func TestReadGeoTiff_deflateTilesWithPredictor(t *testing.T) {
+	// Two 2x2 tiles with differences of horizontal neighbors
+	fileName := writeTestGeoTiff(t, 4, 2, [][]byte{
+		deflate(t, encodeInt16(100, 100, 500, 100)),
+		deflate(t, encodeInt16(-300, 700, 700, 100)),
+	}, true, compressionDeflate, predictorHorizontal, nil)
+
+	// Act
+	dem, err := ReadGeoTiff(fileName)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyTestDem(t, dem)
+}
+
+func TestReadGeoTiff_noData(t *testing.T) {
+	fileName := writeTestGeoTiff(t, 4, 2, [][]byte{
+		encodeInt16(100, -9999, 300, 400, 500, 600, 700, 800),
+	}, false, compressionNone, predictorNone, []testTiffEntry{
+		{tag: tagGdalNoData, fieldType: 2, text: "-9999"},
+	})
+
+	// Act
+	dem, err := ReadGeoTiff(fileName)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dem.At(1, 0); ok {
+		t.Errorf("Expected no data at pixel 1")
+	}
+	if elevation, ok := dem.At(2, 0); !ok || elevation != 300 {
+		t.Errorf("Expected elevation at pixel 2 but got %f", elevation)
+	}
+}
+
+func TestReadGeoTiff_projected(t *testing.T) {
+	fileName := writeTestGeoTiff(t, 4, 2, [][]byte{
+		encodeInt16(100, 200, 300, 400, 500, 600, 700, 800),
+	}, false, compressionNone, predictorNone, []testTiffEntry{
+		// Replaces the geographic model type
+		{tag: tagGeoKeyDirectory, fieldType: 3, values: []float64{1, 1, 0, 1, geoKeyModelType, 0, 1, 1}},
+	})
+
+	// Act
+	_, err := ReadGeoTiff(fileName)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected error for projected coordinates")
+	}
+}
+
+func TestUndoFloatingPointPredictor(t *testing.T) {
+	values := []float32{1.5, -2.25}
+	// Bytes grouped by significance (most significant first) and stored as differences
+	var shuffled []byte
+	for b := 3; b >= 0; b-- {
+		for _, value := range values {
+			shuffled = append(shuffled, byte(math.Float32bits(value)>>(8*b)))
+		}
+	}
+	for i := len(shuffled) - 1; i > 0; i-- {
+		shuffled[i] -= shuffled[i-1]
+	}
+
+	// Act
+	result := undoFloatingPointPredictor(shuffled, 2, 1, 4)
+
+	// Assert
+	for i, value := range values {
+		actual := math.Float32frombits(binary.LittleEndian.Uint32(result[i*4:]))
+		if actual != value {
+			t.Errorf("Expected %f but got %f", value, actual)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package dem
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Offsets of the eight neighbors of a pixel
+var neighborOffsets = [][2]int{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}}
+
+// HighestPixelNear returns the highest pixel within the given radius in meters around the given pixel. This is used to
+// find the actual summit of peaks, whose location in OSM usually doesn't exactly match the DEM.
+func (d *Dem) HighestPixelNear(x int, y int, radius float64) (int, int) {
+	pixelWidth, pixelHeight := d.PixelSizeInMeters(y)
+	radiusX := int(math.Ceil(radius / pixelWidth))
+	radiusY := int(math.Ceil(radius / pixelHeight))
+
+	bestX, bestY := x, y
+	bestElevation, _ := d.At(x, y)
+	for dy := -radiusY; dy <= radiusY; dy++ {
+		for dx := -radiusX; dx <= radiusX; dx++ {
+			if math.Hypot(float64(dx)*pixelWidth, float64(dy)*pixelHeight) > radius {
+				continue
+			}
+			elevation, ok := d.At(x+dx, y+dy)
+			if ok && elevation > bestElevation {
+				bestX, bestY, bestElevation = x+dx, y+dy, elevation
+			}
+		}
+	}
+
+	return bestX, bestY
+}
+
+// Prominence returns the topographic prominence in meters of the peak at the given pixel. This is the height of the peak
+// above the highest col (saddle) connecting it with higher terrain. Starting at the peak, always the highest pixel next
+// to the already visited ones is visited, until higher terrain is reached. The lowest visited pixel on the way is the
+// col.
+//
+// False is returned if there's no higher terrain within the DEM. The returned value is then the height above the
+// lowest pixel connected to the peak and therefore only a lower bound.
+func (d *Dem) Prominence(x int, y int) (float64, bool) {
+	peakElevation, ok := d.At(x, y)
+	if !ok {
+		return 0, false
+	}
+
+	d.startVisit()
+	d.visit(x, y)
+	queue := &pixelQueue{{x, y, peakElevation}}
+	colElevation := peakElevation
+
+	for queue.Len() > 0 {
+		p := heap.Pop(queue).(pixel)
+		if p.elevation > peakElevation {
+			return peakElevation - colElevation, true
+		}
+		colElevation = math.Min(colElevation, p.elevation)
+
+		for _, offset := range neighborOffsets {
+			nx, ny := p.x+offset[0], p.y+offset[1]
+			elevation, ok := d.At(nx, ny)
+			if ok && d.visit(nx, ny) {
+				heap.Push(queue, pixel{nx, ny, elevation})
+			}
+		}
+	}
+
+	return peakElevation - colElevation, false
+}
+
+// Isolation returns the distance in meters from the given pixel to the nearest pixel with a higher elevation. The
+// pixels are searched in growing squares around the given pixel until no closer pixel can be found.
+//
+// False is returned if there's no higher pixel within the DEM. The returned value is then the distance to the farthest
+// border of the DEM and therefore only a lower bound.
+func (d *Dem) Isolation(x int, y int) (float64, bool) {
+	peakElevation, ok := d.At(x, y)
+	if !ok {
+		return 0, false
+	}
+
+	pixelWidth, pixelHeight := d.PixelSizeInMeters(y)
+	minPixelSize := math.Min(pixelWidth, pixelHeight)
+	maxRadius := max(x, y, d.width-1-x, d.height-1-y)
+
+	bestDistance := math.Inf(1)
+	for r := 1; r <= maxRadius; r++ {
+		if float64(r)*minPixelSize > bestDistance {
+			// All remaining pixels are farther away
+			break
+		}
+
+		for dy := -r; dy <= r; dy++ {
+			// Only the pixels on the border of the square, all others have been visited before
+			step := 1
+			if dy != -r && dy != r {
+				step = 2 * r
+			}
+			for dx := -r; dx <= r; dx += step {
+				elevation, ok := d.At(x+dx, y+dy)
+				if !ok || elevation <= peakElevation {
+					continue
+				}
+
+				distance := math.Hypot(float64(dx)*pixelWidth, float64(dy)*pixelHeight)
+				bestDistance = math.Min(bestDistance, distance)
+			}
+		}
+	}
+
+	if math.IsInf(bestDistance, 1) {
+		return float64(maxRadius) * minPixelSize, false
+	}
+	return bestDistance, true
+}
+
+// SaddleProminence returns the height in meters of the lower of the two terrain parts connected by the saddle at the
+// given pixel above the saddle. Only terrain within the given radius in meters is considered. False is returned if the
+// pixel is no saddle within the DEM, e.g. because the location of the saddle doesn't match the DEM exactly.
+func (d *Dem) SaddleProminence(x int, y int, radius float64) (float64, bool) {
+	saddleElevation, ok := d.At(x, y)
+	if !ok {
+		return 0, false
+	}
+
+	pixelWidth, pixelHeight := d.PixelSizeInMeters(y)
+	isInRadius := func(px int, py int) bool {
+		return math.Hypot(float64(px-x)*pixelWidth, float64(py-y)*pixelHeight) <= radius
+	}
+
+	d.startVisit()
+	d.visit(x, y)
+
+	// Each neighbor higher than the saddle, which is not connected to the previous ones, is part of a different terrain
+	// part (e.g. the two ridges next to the saddle). The highest pixel of each part is determined by a flood fill.
+	var highestElevations []float64
+	for _, offset := range neighborOffsets {
+		startX, startY := x+offset[0], y+offset[1]
+		elevation, ok := d.At(startX, startY)
+		if !ok || elevation <= saddleElevation || !d.visit(startX, startY) {
+			continue
+		}
+
+		highestElevation := elevation
+		stack := [][2]int{{startX, startY}}
+		for len(stack) > 0 {
+			p := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			for _, neighborOffset := range neighborOffsets {
+				nx, ny := p[0]+neighborOffset[0], p[1]+neighborOffset[1]
+				elevation, ok := d.At(nx, ny)
+				if !ok || elevation <= saddleElevation || !isInRadius(nx, ny) || !d.visit(nx, ny) {
+					continue
+				}
+				highestElevation = math.Max(highestElevation, elevation)
+				stack = append(stack, [2]int{nx, ny})
+			}
+		}
+		highestElevations = append(highestElevations, highestElevation)
+	}
+
+	if len(highestElevations) < 2 {
+		return 0, false
+	}
+
+	// The second-highest part determines the prominence
+	highest, secondHighest := math.Inf(-1), math.Inf(-1)
+	for _, elevation := range highestElevations {
+		if elevation > highest {
+			highest, secondHighest = elevation, highest
+		} else if elevation > secondHighest {
+			secondHighest = elevation
+		}
+	}
+	return secondHighest - saddleElevation, true
+}
+
+type pixel struct {
+	x         int
+	y         int
+	elevation float64
+}
+
+// pixelQueue is a priority queue returning the highest pixel first.
+type pixelQueue []pixel
+
+func (q pixelQueue) Len() int {
+	return len(q)
+}
+
+func (q pixelQueue) Less(i, j int) bool {
+	return q[i].elevation > q[j].elevation
+}
+
+func (q pixelQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *pixelQueue) Push(x any) {
+	*q = append(*q, x.(pixel))
+}
+
+func (q *pixelQueue) Pop() any {
+	old := *q
+	p := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return p
+}
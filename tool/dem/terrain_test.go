@@ -0,0 +1,109 @@
+package dem
+
+import (
+	"github.com/paulmach/orb"
+	"math"
+	"testing"
+)
+
+// createTestDem creates a DEM of 0.01° pixels from the given rows of elevations.
+func createTestDem(rows [][]float32) *Dem {
+	var elevations []float32
+	for _, row := range rows {
+		elevations = append(elevations, row...)
+	}
+	width, height := len(rows[0]), len(rows)
+	return New(width, height, orb.Bound{
+		Min: orb.Point{10, 47},
+		Max: orb.Point{10 + float64(width)*0.01, 47 + float64(height)*0.01},
+	}, elevations)
+}
+
+// Two peaks (1000 m and 1500 m) connected by a saddle at 700 m
+var twoPeaksDem = [][]float32{
+	{100, 100, 100, 100, 100, 100, 100},
+	{100, 500, 600, 500, 600, 500, 100},
+	{100, 600, 1000, 700, 1500, 600, 100},
+	{100, 500, 600, 500, 600, 500, 100},
+	{100, 100, 100, 100, 100, 100, 100},
+}
+
+func TestElevation_bilinear(t *testing.T) {
+	dem := createTestDem([][]float32{
+		{100, 200},
+		{300, 400},
+	})
+
+	elevation, ok := dem.Elevation(dem.PixelCenter(0, 0))
+	if !ok || math.Abs(elevation-100) > 0.001 {
+		t.Errorf("Expected elevation 100 at pixel center but got %f", elevation)
+	}
+
+	elevation, ok = dem.Elevation(orb.Point{10.01, 47.01})
+	if !ok || math.Abs(elevation-250) > 0.001 {
+		t.Errorf("Expected elevation 250 between pixel centers but got %f", elevation)
+	}
+
+	_, ok = dem.Elevation(orb.Point{10.03, 47.01})
+	if ok {
+		t.Errorf("Expected no elevation outside the DEM")
+	}
+}
+
+func TestProminence(t *testing.T) {
+	dem := createTestDem(twoPeaksDem)
+
+	prominence, ok := dem.Prominence(2, 2)
+	if !ok || prominence != 300 {
+		t.Errorf("Expected prominence 300 of lower peak but got %f (%v)", prominence, ok)
+	}
+
+	// The highest peak has no higher terrain, so the lowest point of the DEM is used
+	prominence, ok = dem.Prominence(4, 2)
+	if ok || prominence != 1400 {
+		t.Errorf("Expected prominence 1400 of highest peak but got %f (%v)", prominence, ok)
+	}
+}
+
+func TestIsolation(t *testing.T) {
+	dem := createTestDem(twoPeaksDem)
+	pixelWidth, _ := dem.PixelSizeInMeters(2)
+
+	isolation, ok := dem.Isolation(2, 2)
+	if !ok || math.Abs(isolation-2*pixelWidth) > 0.001 {
+		t.Errorf("Expected isolation of two pixels (%f m) but got %f (%v)", 2*pixelWidth, isolation, ok)
+	}
+
+	_, ok = dem.Isolation(4, 2)
+	if ok {
+		t.Errorf("Expected no higher terrain for highest peak")
+	}
+}
+
+func TestSaddleProminence(t *testing.T) {
+	dem := createTestDem(twoPeaksDem)
+
+	prominence, ok := dem.SaddleProminence(3, 2, 5000)
+	if !ok || prominence != 300 {
+		t.Errorf("Expected saddle prominence 300 but got %f (%v)", prominence, ok)
+	}
+
+	_, ok = dem.SaddleProminence(2, 2, 5000)
+	if ok {
+		t.Errorf("Peak should not be a saddle")
+	}
+}
+
+func TestHighestPixelNear(t *testing.T) {
+	dem := createTestDem(twoPeaksDem)
+
+	x, y := dem.HighestPixelNear(3, 3, 1500)
+	if x != 4 || y != 2 {
+		t.Errorf("Expected highest pixel 4,2 but got %d,%d", x, y)
+	}
+
+	x, y = dem.HighestPixelNear(1, 2, 900)
+	if x != 2 || y != 2 {
+		t.Errorf("Expected highest pixel 2,2 but got %d,%d", x, y)
+	}
+}
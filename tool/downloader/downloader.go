@@ -0,0 +1,308 @@
+package downloader
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hauke96/sigolo"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBaseUrl = "https://download.geofabrik.de"
+	manifestFile   = "manifest.json"
+	partFileSuffix = ".part"
+	// Suffix of the file next to the ".part" file containing the remote MD5 hash of the file being downloaded
+	partMd5FileSuffix = ".part.md5"
+)
+
+// manifestEntry describes a completely downloaded and verified file.
+type manifestEntry struct {
+	Url          string    `json:"url"`
+	Md5          string    `json:"md5"`
+	Size         int64     `json:"size"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// manifest maps the file names within the download folder to information about their download.
+type manifest map[string]manifestEntry
+
+// Download downloads the file of the given region path (e.g. "europe/germany/hamburg-latest.osm.pbf") from the given
+// base URL into the download folder, unless an up-to-date version of this file already exists. The file is verified
+// using the ".md5" file provided next to it on the server. Partially downloaded files are resumed using HTTP range
+// requests, unless the remote file has changed since then. The path to the local file is returned.
+func Download(baseUrl string, regionPath string, downloadFolder string) (string, error) {
+	regionPath = strings.Trim(regionPath, "/")
+	fileUrl := strings.TrimSuffix(baseUrl, "/") + "/" + regionPath
+	fileName := path.Base(regionPath)
+	localFile := filepath.Join(downloadFolder, fileName)
+
+	err := os.MkdirAll(downloadFolder, os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+
+	sigolo.Info("Download %s", fileUrl)
+
+	remoteMd5, err := requestMd5(fileUrl + ".md5")
+	if err != nil {
+		return "", err
+	}
+	sigolo.Debug("Remote MD5 hash: %s", remoteMd5)
+
+	downloadManifest, err := readManifest(downloadFolder)
+	if err != nil {
+		return "", err
+	}
+
+	upToDate, manifestChanged := isUpToDate(downloadManifest, fileName, localFile, fileUrl, remoteMd5)
+	if manifestChanged {
+		err = writeManifest(downloadFolder, downloadManifest)
+		if err != nil {
+			return "", err
+		}
+	}
+	if upToDate {
+		sigolo.Info("Local file %s is up to date, skip download", localFile)
+		return localFile, nil
+	}
+
+	partFile := localFile + partFileSuffix
+	partMd5File := localFile + partMd5FileSuffix
+	err = preparePartFile(partFile, partMd5File, remoteMd5)
+	if err != nil {
+		return "", err
+	}
+
+	err = downloadToFile(fileUrl, partFile)
+	if err != nil {
+		return "", err
+	}
+
+	localMd5, err := getMd5OfFile(partFile)
+	if err != nil {
+		return "", err
+	}
+	if localMd5 != remoteMd5 {
+		// The partial file is broken, so the next download must start from scratch.
+		removePartFile(partFile, partMd5File)
+		return "", errors.New(fmt.Sprintf("MD5 hash %s of downloaded file does not match remote hash %s", localMd5, remoteMd5))
+	}
+
+	err = os.Rename(partFile, localFile)
+	if err != nil {
+		return "", err
+	}
+	removePartFile(partFile, partMd5File)
+
+	fileInfo, err := os.Stat(localFile)
+	if err != nil {
+		return "", err
+	}
+
+	downloadManifest[fileName] = manifestEntry{
+		Url:          fileUrl,
+		Md5:          remoteMd5,
+		Size:         fileInfo.Size(),
+		DownloadedAt: time.Now().UTC(),
+	}
+	err = writeManifest(downloadFolder, downloadManifest)
+	if err != nil {
+		return "", err
+	}
+
+	sigolo.Info("Successfully downloaded and verified %s", localFile)
+	return localFile, nil
+}
+
+// requestMd5 downloads the given .md5 file and returns the hash in it. The file has the same format as the output of
+// "md5sum", which is "<hash>  <file-name>".
+func requestMd5(md5Url string) (string, error) {
+	resp, err := http.Get(md5Url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(fmt.Sprintf("Requesting MD5 file %s failed with status %s", md5Url, resp.Status))
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 || len(fields[0]) != 32 {
+		return "", errors.New(fmt.Sprintf("Invalid MD5 file %s: %s", md5Url, string(content)))
+	}
+
+	return strings.ToLower(fields[0]), nil
+}
+
+// isUpToDate checks whether the local file exists and has the given hash. The manifest is used to avoid the expensive
+// hash calculation. Up-to-date files without manifest entry (e.g. downloaded manually) are hashed and added to the
+// manifest, which is indicated by the second return value, so that the manifest can be written.
+func isUpToDate(downloadManifest manifest, fileName string, localFile string, fileUrl string, remoteMd5 string) (bool, bool) {
+	fileInfo, err := os.Stat(localFile)
+	if err != nil {
+		return false, false
+	}
+
+	if entry, ok := downloadManifest[fileName]; ok {
+		return entry.Md5 == remoteMd5 && entry.Size == fileInfo.Size(), false
+	}
+
+	sigolo.Debug("Local file %s not in manifest, calculate its hash", localFile)
+	localMd5, err := getMd5OfFile(localFile)
+	if err != nil {
+		sigolo.Error("Error calculating hash of %s: %s", localFile, err.Error())
+		return false, false
+	}
+	if localMd5 != remoteMd5 {
+		return false, false
+	}
+
+	downloadManifest[fileName] = manifestEntry{
+		Url:          fileUrl,
+		Md5:          localMd5,
+		Size:         fileInfo.Size(),
+		DownloadedAt: fileInfo.ModTime().UTC(),
+	}
+	return true, true
+}
+
+// preparePartFile makes sure that an existing ".part" file belongs to the current version of the remote file, which is
+// identified by its MD5 hash. Otherwise (e.g. when a "-latest" file has been replaced on the server since the download
+// was interrupted), the ".part" file is removed, so that the download starts from the beginning.
+func preparePartFile(partFile string, partMd5File string, remoteMd5 string) error {
+	partMd5, err := os.ReadFile(partMd5File)
+	if err == nil && string(partMd5) == remoteMd5 {
+		return nil
+	}
+
+	if _, err = os.Stat(partFile); err == nil {
+		sigolo.Info("Remote file has changed since the download was interrupted, start download from the beginning")
+		err = os.Remove(partFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(partMd5File, []byte(remoteMd5), 0644)
+}
+
+// removePartFile removes the ".part" file and the file with its remote hash.
+func removePartFile(partFile string, partMd5File string) {
+	for _, file := range []string{partFile, partMd5File} {
+		err := os.Remove(file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			sigolo.Error("Error removing file %s: %s", file, err.Error())
+		}
+	}
+}
+
+// downloadToFile downloads the given URL into the given file. If the file already exists, only the remaining part is
+// requested. When the server doesn't support range requests, the whole file is downloaded again.
+func downloadToFile(fileUrl string, outputFile string) error {
+	var existingSize int64
+	if fileInfo, err := os.Stat(outputFile); err == nil {
+		existingSize = fileInfo.Size()
+	}
+
+	request, err := http.NewRequest(http.MethodGet, fileUrl, nil)
+	if err != nil {
+		return err
+	}
+	if existingSize > 0 {
+		sigolo.Info("Resume download at byte %d", existingSize)
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", existingSize))
+	}
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	fileFlags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		fileFlags |= os.O_APPEND
+	case http.StatusOK:
+		if existingSize > 0 {
+			sigolo.Info("Server does not support resuming downloads, start download from the beginning")
+		}
+		fileFlags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The file is already complete (or larger than the remote file, which is detected by the hash check).
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("Downloading %s failed with status %s", fileUrl, resp.Status))
+	}
+
+	file, err := os.OpenFile(outputFile, fileFlags, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, resp.Body)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error downloading %s, the download can be resumed: %s", fileUrl, err.Error()))
+	}
+
+	return nil
+}
+
+func getMd5OfFile(fileName string) (string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func readManifest(downloadFolder string) (manifest, error) {
+	downloadManifest := manifest{}
+
+	fileContent, err := os.ReadFile(filepath.Join(downloadFolder, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return downloadManifest, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(fileContent, &downloadManifest)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error reading download manifest: %s", err.Error()))
+	}
+
+	return downloadManifest, nil
+}
+
+func writeManifest(downloadFolder string, downloadManifest manifest) error {
+	fileContent, err := json.MarshalIndent(downloadManifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(downloadFolder, manifestFile), fileContent, 0644)
+}
@@ -0,0 +1,194 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testServer struct {
+	*httptest.Server
+	fileRequests  int
+	rangeRequests int
+}
+
+func newTestServer(fileContent []byte, md5FileContent string) *testServer {
+	server := &testServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/europe/foo-latest.osm.pbf.md5":
+			w.Write([]byte(md5FileContent))
+		case "/europe/foo-latest.osm.pbf":
+			server.fileRequests++
+			if r.Header.Get("Range") != "" {
+				server.rangeRequests++
+			}
+			http.ServeContent(w, r, "foo-latest.osm.pbf", time.Time{}, bytes.NewReader(fileContent))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+func md5FileContent(content []byte) string {
+	hash := md5.Sum(content)
+	return hex.EncodeToString(hash[:]) + "  foo-latest.osm.pbf\n"
+}
+
+func TestDownload(t *testing.T) {
+	fileContent := []byte("some test content of the file")
+	server := newTestServer(fileContent, md5FileContent(fileContent))
+	defer server.Close()
+	downloadFolder := t.TempDir()
+
+	localFile, err := Download(server.URL, "europe/foo-latest.osm.pbf", downloadFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if localFile != filepath.Join(downloadFolder, "foo-latest.osm.pbf") {
+		t.Errorf("Wrong local file %s", localFile)
+	}
+	downloadedContent, _ := os.ReadFile(localFile)
+	if !bytes.Equal(downloadedContent, fileContent) {
+		t.Errorf("Wrong file content: %s", string(downloadedContent))
+	}
+
+	downloadManifest, err := readManifest(downloadFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := downloadManifest["foo-latest.osm.pbf"]; entry.Size != int64(len(fileContent)) || entry.Url != server.URL+"/europe/foo-latest.osm.pbf" {
+		t.Errorf("Wrong manifest entry: %#v", entry)
+	}
+
+	// Second download must not request the file again
+	_, err = Download(server.URL, "europe/foo-latest.osm.pbf", downloadFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.fileRequests != 1 {
+		t.Errorf("Expected 1 file request but got %d", server.fileRequests)
+	}
+}
+
+func TestDownload_resume(t *testing.T) {
+	fileContent := []byte("some test content of the file")
+	server := newTestServer(fileContent, md5FileContent(fileContent))
+	defer server.Close()
+	downloadFolder := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(downloadFolder, "foo-latest.osm.pbf.part"), fileContent[:10], 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := md5.Sum(fileContent)
+	err = os.WriteFile(filepath.Join(downloadFolder, "foo-latest.osm.pbf.part.md5"), []byte(hex.EncodeToString(hash[:])), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	localFile, err := Download(server.URL, "europe/foo-latest.osm.pbf", downloadFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.rangeRequests != 1 {
+		t.Errorf("Expected 1 range request but got %d", server.rangeRequests)
+	}
+	downloadedContent, _ := os.ReadFile(localFile)
+	if !bytes.Equal(downloadedContent, fileContent) {
+		t.Errorf("Wrong file content: %s", string(downloadedContent))
+	}
+	if _, err = os.Stat(localFile + partFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("Part file should not exist anymore")
+	}
+	if _, err = os.Stat(localFile + partMd5FileSuffix); !os.IsNotExist(err) {
+		t.Errorf("Hash of part file should not exist anymore")
+	}
+}
+
+func TestDownload_resumeChangedRemoteFile(t *testing.T) {
+	fileContent := []byte("some test content of the file")
+	server := newTestServer(fileContent, md5FileContent(fileContent))
+	defer server.Close()
+	downloadFolder := t.TempDir()
+
+	// Beginning of an older version of the remote file
+	err := os.WriteFile(filepath.Join(downloadFolder, "foo-latest.osm.pbf.part"), []byte("old content"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldHash := md5.Sum([]byte("old content of the file"))
+	err = os.WriteFile(filepath.Join(downloadFolder, "foo-latest.osm.pbf.part.md5"), []byte(hex.EncodeToString(oldHash[:])), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	localFile, err := Download(server.URL, "europe/foo-latest.osm.pbf", downloadFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.rangeRequests != 0 {
+		t.Errorf("Expected no range request but got %d", server.rangeRequests)
+	}
+	downloadedContent, _ := os.ReadFile(localFile)
+	if !bytes.Equal(downloadedContent, fileContent) {
+		t.Errorf("Wrong file content: %s", string(downloadedContent))
+	}
+}
+
+func TestDownload_existingFileWithoutManifest(t *testing.T) {
+	fileContent := []byte("some test content of the file")
+	server := newTestServer(fileContent, md5FileContent(fileContent))
+	defer server.Close()
+	downloadFolder := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(downloadFolder, "foo-latest.osm.pbf"), fileContent, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Download(server.URL, "europe/foo-latest.osm.pbf", downloadFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.fileRequests != 0 {
+		t.Errorf("Expected no file request but got %d", server.fileRequests)
+	}
+	downloadManifest, err := readManifest(downloadFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := downloadManifest["foo-latest.osm.pbf"]; entry.Size != int64(len(fileContent)) || entry.Url != server.URL+"/europe/foo-latest.osm.pbf" {
+		t.Errorf("Expected existing file to be added to the manifest but got %#v", entry)
+	}
+}
+
+func TestDownload_wrongHash(t *testing.T) {
+	fileContent := []byte("some test content of the file")
+	server := newTestServer(fileContent, md5FileContent([]byte("other content")))
+	defer server.Close()
+	downloadFolder := t.TempDir()
+
+	_, err := Download(server.URL, "europe/foo-latest.osm.pbf", downloadFolder)
+	if err == nil {
+		t.Fatal("Expected error for wrong hash")
+	}
+
+	if _, err = os.Stat(filepath.Join(downloadFolder, "foo-latest.osm.pbf")); !os.IsNotExist(err) {
+		t.Errorf("File with wrong hash should not exist")
+	}
+	if _, err = os.Stat(filepath.Join(downloadFolder, "foo-latest.osm.pbf.part")); !os.IsNotExist(err) {
+		t.Errorf("Part file with wrong hash should not exist")
+	}
+}
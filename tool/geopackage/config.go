@@ -0,0 +1,230 @@
+package geopackage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/paulmach/osm"
+	"os"
+	"strings"
+)
+
+const (
+	layerPoints           = "points"
+	layerLines            = "lines"
+	layerMultipolygons    = "multipolygons"
+	layerMultilinestrings = "multilinestrings"
+)
+
+// config contains the parts of a GDAL osmconf.ini file that are relevant for the export.
+type config struct {
+	// Closed ways with one of these keys (or "key=value" tags) are polygons, all other ways are lines.
+	closedWaysArePolygons []string
+	layers                map[string]*layerConfig
+}
+
+type layerConfig struct {
+	name         string
+	osmId        bool
+	osmVersion   bool
+	osmTimestamp bool
+	osmUid       bool
+	osmUser      bool
+	osmChangeset bool
+	attributes   []string
+	// SQL types of attributes other than TEXT, configured via "<attribute>_type"
+	attributeTypes map[string]string
+	ignore         []string
+	unsignificant  []string
+	otherTags      bool
+	computed       []*computedAttribute
+}
+
+// computedAttribute is an attribute whose value is determined by an SQL statement. The statement may reference tag
+// values using "[key]".
+type computedAttribute struct {
+	name         string
+	sqlType      string
+	sqlStatement string
+}
+
+// readConfig reads the given osmconf.ini file. Unknown keys are ignored.
+func readConfig(configFile string) (*config, error) {
+	file, err := os.Open(configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	conf := &config{
+		layers: map[string]*layerConfig{},
+	}
+	for _, layerName := range []string{layerPoints, layerLines, layerMultipolygons, layerMultilinestrings} {
+		conf.layers[layerName] = &layerConfig{
+			name:      layerName,
+			otherTags: true,
+		}
+	}
+
+	var currentLayer *layerConfig
+	// Types of computed and normal attributes, configured via "<attribute>_type"
+	attributeTypes := map[string]string{}
+	computedStatements := map[string]string{}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			currentLayer = conf.layers[strings.Trim(line, "[]")]
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, errors.New(fmt.Sprintf("Invalid line %d in %s: %s", lineNumber, configFile, line))
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		if currentLayer == nil {
+			if key == "closed_ways_are_polygons" {
+				conf.closedWaysArePolygons = splitList(value)
+			}
+			continue
+		}
+
+		switch key {
+		case "osm_id":
+			currentLayer.osmId = value == "yes"
+		case "osm_version":
+			currentLayer.osmVersion = value == "yes"
+		case "osm_timestamp":
+			currentLayer.osmTimestamp = value == "yes"
+		case "osm_uid":
+			currentLayer.osmUid = value == "yes"
+		case "osm_user":
+			currentLayer.osmUser = value == "yes"
+		case "osm_changeset":
+			currentLayer.osmChangeset = value == "yes"
+		case "attributes":
+			currentLayer.attributes = splitList(value)
+		case "ignore":
+			currentLayer.ignore = splitList(value)
+		case "unsignificant":
+			currentLayer.unsignificant = splitList(value)
+		case "other_tags":
+			currentLayer.otherTags = value == "yes"
+		case "computed_attributes":
+			for _, name := range splitList(value) {
+				currentLayer.computed = append(currentLayer.computed, &computedAttribute{name: name})
+			}
+		default:
+			if strings.HasSuffix(key, "_type") {
+				attributeTypes[currentLayer.name+"/"+strings.TrimSuffix(key, "_type")] = value
+			} else if strings.HasSuffix(key, "_sql") {
+				computedStatements[currentLayer.name+"/"+strings.TrimSuffix(key, "_sql")] = strings.Trim(value, "\"")
+			}
+		}
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+
+	for _, layer := range conf.layers {
+		layer.attributeTypes = map[string]string{}
+		for _, attribute := range layer.attributes {
+			if configType, ok := attributeTypes[layer.name+"/"+attribute]; ok {
+				layer.attributeTypes[attribute] = toSqlType(configType)
+			}
+		}
+
+		for _, computed := range layer.computed {
+			computed.sqlType = toSqlType(attributeTypes[layer.name+"/"+computed.name])
+			computed.sqlStatement = computedStatements[layer.name+"/"+computed.name]
+			if computed.sqlStatement == "" {
+				return nil, errors.New(fmt.Sprintf("No SQL statement for computed attribute %s of layer %s", computed.name, layer.name))
+			}
+		}
+	}
+
+	return conf, nil
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+func toSqlType(configType string) string {
+	switch strings.ToLower(configType) {
+	case "integer":
+		return "INTEGER"
+	case "integer64":
+		return "INTEGER"
+	case "real":
+		return "REAL"
+	default:
+		return "TEXT"
+	}
+}
+
+// isPolygon determines whether the given closed way is a polygon according to the "closed_ways_are_polygons" setting
+// and the "area" tag.
+func (c *config) isPolygon(tags osm.Tags) bool {
+	if tags.Find("area") == "yes" {
+		return true
+	}
+	if tags.Find("area") == "no" {
+		return false
+	}
+
+	for _, entry := range c.closedWaysArePolygons {
+		key, value, hasValue := strings.Cut(entry, "=")
+		if tags.HasTag(key) && (!hasValue || tags.Find(key) == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIgnored returns true if the given key matches an entry of the ignore list. Entries ending with ":" are prefixes.
+func (l *layerConfig) isIgnored(key string) bool {
+	for _, ignoredKey := range l.ignore {
+		if key == ignoredKey || (strings.HasSuffix(ignoredKey, ":") && strings.HasPrefix(key, ignoredKey)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSignificantTags returns true if at least one tag is neither ignored nor unsignificant.
+func (l *layerConfig) hasSignificantTags(tags osm.Tags) bool {
+	for _, tag := range tags {
+		if !l.isIgnored(tag.Key) && !containsString(l.unsignificant, tag.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package geopackage
+
+import (
+	"context"
+	"github.com/hauke96/sigolo"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"os"
+	"strconv"
+	"time"
+	"tool/common"
+)
+
+// Export converts the given OSM-PBF file into a GeoPackage with the layers "points", "lines", "multipolygons" and
+// "multilinestrings". The layers and their attributes are configured by the given GDAL osmconf.ini file, so that the
+// result equals the output of "ogr2ogr -oo CONFIG_FILE=<configFile> -f GPKG <outputFile> <inputFile>" for all
+// attributes the QGIS project uses.
+//
+// The input file is read twice: First to collect the relevant relations, second to write all nodes and ways and to
+// collect the geometries of relation members.
+func Export(inputFile string, outputFile string, configFile string) error {
+	conf, err := readConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	sigolo.Debug("Start first pass: Collect relations")
+	var relations []*osm.Relation
+	memberWayIds := map[osm.WayID]bool{}
+	err = scanFile(inputFile, true, func(obj osm.Object) error {
+		relation, ok := obj.(*osm.Relation)
+		if !ok || relationLayer(relation) == "" {
+			return nil
+		}
+
+		relations = append(relations, relation)
+		for _, member := range relation.Members {
+			if member.Type == osm.TypeWay {
+				memberWayIds[osm.WayID(member.Ref)] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	writer, err := newGpkgWriter(outputFile, conf)
+	if err != nil {
+		return err
+	}
+
+	sigolo.Debug("Start second pass: Write nodes and ways")
+	nodeLocations := map[osm.NodeID]orb.Point{}
+	memberWays := map[osm.WayID]*common.MultipolygonWay{}
+	numberOfIncompleteWays := 0
+	err = scanFile(inputFile, false, func(obj osm.Object) error {
+		switch osmObj := obj.(type) {
+		case *osm.Node:
+			nodeLocations[osmObj.ID] = osmObj.Point()
+			if conf.layers[layerPoints].hasSignificantTags(osmObj.Tags) {
+				return writer.write(layerPoints, &feature{
+					geometry:  osmObj.Point(),
+					osmId:     strconv.FormatInt(int64(osmObj.ID), 10),
+					version:   osmObj.Version,
+					timestamp: toTimestamp(osmObj.Timestamp),
+					uid:       osmObj.UserID,
+					user:      osmObj.User,
+					changeset: osmObj.ChangesetID,
+					tags:      osmObj.Tags,
+				})
+			}
+		case *osm.Way:
+			nodeIds, points := getWayGeometry(osmObj, nodeLocations)
+			if len(points) < 2 {
+				numberOfIncompleteWays++
+				return nil
+			}
+			if memberWayIds[osmObj.ID] {
+				memberWays[osmObj.ID] = &common.MultipolygonWay{NodeIds: nodeIds, Points: points}
+			}
+			return writeWay(writer, conf, osmObj, nodeIds, points)
+		case *osm.Relation:
+			// All relevant relations have been collected in the first pass
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		writer.close()
+		return err
+	}
+	if numberOfIncompleteWays > 0 {
+		sigolo.Debug("Skipped %d ways with less than two known nodes", numberOfIncompleteWays)
+	}
+
+	sigolo.Debug("Write %d relations", len(relations))
+	numberOfInvalidRelations := 0
+	for _, relation := range relations {
+		var ok bool
+		ok, err = writeRelation(writer, relation, memberWays)
+		if err != nil {
+			writer.close()
+			return err
+		}
+		if !ok {
+			numberOfInvalidRelations++
+		}
+	}
+	if numberOfInvalidRelations > 0 {
+		sigolo.Debug("Skipped %d relations without valid geometry", numberOfInvalidRelations)
+	}
+
+	for _, layerName := range []string{layerPoints, layerLines, layerMultipolygons, layerMultilinestrings} {
+		sigolo.Info("Wrote %d features into layer %s", writer.layers[layerName].numberOfFeatures, layerName)
+	}
+
+	return writer.close()
+}
+
+// relationLayer returns the layer relations of the given type are written into. An empty string is returned for
+// relations not written into any layer.
+func relationLayer(relation *osm.Relation) string {
+	switch relation.Tags.Find("type") {
+	case "multipolygon", "boundary":
+		return layerMultipolygons
+	case "multilinestring", "route":
+		return layerMultilinestrings
+	}
+	return ""
+}
+
+// getWayGeometry returns the IDs and locations of all nodes of the way with a known location.
+func getWayGeometry(way *osm.Way, nodeLocations map[osm.NodeID]orb.Point) ([]osm.NodeID, []orb.Point) {
+	var nodeIds []osm.NodeID
+	var points []orb.Point
+	for _, wayNode := range way.Nodes {
+		location, ok := nodeLocations[wayNode.ID]
+		if !ok {
+			continue
+		}
+		nodeIds = append(nodeIds, wayNode.ID)
+		points = append(points, location)
+	}
+	return nodeIds, points
+}
+
+// writeWay writes the way into the multipolygon layer, if it's a closed area, or otherwise into the line layer. Ways
+// without significant tags (e.g. untagged members of multipolygons) are not written.
+func writeWay(writer *gpkgWriter, conf *config, way *osm.Way, nodeIds []osm.NodeID, points []orb.Point) error {
+	isClosed := len(nodeIds) >= 4 && nodeIds[0] == nodeIds[len(nodeIds)-1]
+
+	if isClosed && conf.isPolygon(way.Tags) {
+		if !conf.layers[layerMultipolygons].hasSignificantTags(way.Tags) {
+			return nil
+		}
+
+		// The points are copied, since they might be used for multipolygon relations as well and must therefore stay in
+		// the order of the node IDs.
+		polygon := orb.Polygon{append(orb.Ring{}, points...)}
+		if polygon[0].Orientation() != orb.CCW {
+			polygon[0].Reverse()
+		}
+		return writer.write(layerMultipolygons, &feature{
+			geometry:  orb.MultiPolygon{polygon},
+			osmWayId:  strconv.FormatInt(int64(way.ID), 10),
+			version:   way.Version,
+			timestamp: toTimestamp(way.Timestamp),
+			uid:       way.UserID,
+			user:      way.User,
+			changeset: way.ChangesetID,
+			tags:      way.Tags,
+		})
+	}
+
+	if !conf.layers[layerLines].hasSignificantTags(way.Tags) {
+		return nil
+	}
+
+	return writer.write(layerLines, &feature{
+		geometry:  orb.LineString(points),
+		osmId:     strconv.FormatInt(int64(way.ID), 10),
+		version:   way.Version,
+		timestamp: toTimestamp(way.Timestamp),
+		uid:       way.UserID,
+		user:      way.User,
+		changeset: way.ChangesetID,
+		tags:      way.Tags,
+	})
+}
+
+// writeRelation writes multipolygon and boundary relations into the multipolygon layer and routes into the
+// multilinestring layer. False is returned, when no valid geometry could be created.
+func writeRelation(writer *gpkgWriter, relation *osm.Relation, memberWays map[osm.WayID]*common.MultipolygonWay) (bool, error) {
+	var geometry orb.Geometry
+
+	layerName := relationLayer(relation)
+	switch layerName {
+	case layerMultipolygons:
+		var ways []common.MultipolygonWay
+		for _, member := range relation.Members {
+			way, ok := memberWays[osm.WayID(member.Ref)]
+			if member.Type != osm.TypeWay || !ok {
+				continue
+			}
+			ways = append(ways, common.MultipolygonWay{Role: member.Role, NodeIds: way.NodeIds, Points: way.Points})
+		}
+
+		multiPolygon, err := common.AssembleMultipolygon(ways)
+		if err != nil {
+			sigolo.Debug("Unable to create multipolygon of relation %d: %s", relation.ID, err.Error())
+			return false, nil
+		}
+		geometry = multiPolygon
+	case layerMultilinestrings:
+		var multiLineString orb.MultiLineString
+		for _, member := range relation.Members {
+			way, ok := memberWays[osm.WayID(member.Ref)]
+			if member.Type != osm.TypeWay || !ok {
+				continue
+			}
+			multiLineString = append(multiLineString, way.Points)
+		}
+
+		if len(multiLineString) == 0 {
+			return false, nil
+		}
+		geometry = multiLineString
+	}
+
+	return true, writer.write(layerName, &feature{
+		geometry:  geometry,
+		osmId:     strconv.FormatInt(int64(relation.ID), 10),
+		version:   relation.Version,
+		timestamp: toTimestamp(relation.Timestamp),
+		uid:       relation.UserID,
+		user:      relation.User,
+		changeset: relation.ChangesetID,
+		tags:      relation.Tags,
+	})
+}
+
+func toTimestamp(timestamp time.Time) string {
+	if timestamp.IsZero() {
+		return ""
+	}
+	return timestamp.UTC().Format(time.RFC3339)
+}
+
+// scanFile calls the given function for each object of the given OSM-PBF file. Nodes and ways are skipped when
+// onlyRelations is true.
+func scanFile(inputFile string, onlyRelations bool, handle func(obj osm.Object) error) error {
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := osmpbf.New(context.Background(), f, 1)
+	defer scanner.Close()
+	scanner.SkipNodes = onlyRelations
+	scanner.SkipWays = onlyRelations
+
+	for scanner.Scan() {
+		err = handle(scanner.Object())
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
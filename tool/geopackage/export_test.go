@@ -0,0 +1,156 @@
+package geopackage
+
+import (
+	"database/sql"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"path/filepath"
+	"testing"
+	"tool/common"
+)
+
+func TestExport(t *testing.T) {
+	inputOsm := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lat: 53.0, Lon: 10.0},
+			{ID: 2, Version: 1, Lat: 53.0, Lon: 10.2},
+			{ID: 3, Version: 1, Lat: 53.2, Lon: 10.2},
+			{ID: 4, Version: 1, Lat: 53.2, Lon: 10.0},
+			{ID: 5, Version: 1, Lat: 53.1, Lon: 10.1, Tags: osm.Tags{
+				{Key: "natural", Value: "peak"},
+				{Key: "ele", Value: "123"},
+			}},
+			{ID: 6, Version: 1, Lat: 53.1, Lon: 10.15, Tags: osm.Tags{
+				{Key: "created_by", Value: "foo"},
+			}},
+		},
+		Ways: osm.Ways{
+			// Outer ring of the multipolygon split into two parts
+			{ID: 10, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}}},
+			{ID: 11, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 4}, {ID: 3}}},
+			{ID: 12, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}, Tags: osm.Tags{
+				{Key: "highway", Value: "primary"},
+				{Key: "bridge", Value: "yes"},
+				{Key: "surface", Value: "asphalt"},
+			}},
+			{ID: 13, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 1}}, Tags: osm.Tags{
+				{Key: "building", Value: "yes"},
+			}},
+		},
+		Relations: osm.Relations{
+			{ID: 20, Version: 1, Members: osm.Members{
+				{Type: osm.TypeWay, Ref: 10, Role: "outer"},
+				{Type: osm.TypeWay, Ref: 11, Role: "outer"},
+			}, Tags: osm.Tags{
+				{Key: "type", Value: "multipolygon"},
+				{Key: "landuse", Value: "forest"},
+			}},
+			{ID: 21, Version: 1, Members: osm.Members{{Type: osm.TypeWay, Ref: 12}}, Tags: osm.Tags{
+				{Key: "type", Value: "route"},
+				{Key: "route", Value: "hiking"},
+				{Key: "network", Value: "lwn"},
+			}},
+		},
+	}
+
+	inputFile := filepath.Join(t.TempDir(), "input.osm.pbf")
+	common.WriteOsmToPbf(inputFile, inputOsm)
+	outputFile := filepath.Join(t.TempDir(), "output.gpkg")
+
+	// Act
+	err := Export(inputFile, outputFile, "../../data/osmconf.ini")
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var osmId, natural, ele string
+	err = db.QueryRow("SELECT osm_id, \"natural\", ele FROM points").Scan(&osmId, &natural, &ele)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if osmId != "5" || natural != "peak" || ele != "123" {
+		t.Errorf("Wrong point: %s, %s, %s", osmId, natural, ele)
+	}
+
+	var highway string
+	var zOrder int
+	err = db.QueryRow("SELECT osm_id, highway, z_order FROM lines").Scan(&osmId, &highway, &zOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if osmId != "12" || highway != "primary" || zOrder != 17 {
+		t.Errorf("Wrong line: %s, %s, %d", osmId, highway, zOrder)
+	}
+
+	var relationId, wayId sql.NullString
+	var building, landuse sql.NullString
+	rows, err := db.Query("SELECT osm_id, osm_way_id, building, landuse FROM multipolygons ORDER BY fid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var multipolygons []string
+	for rows.Next() {
+		err = rows.Scan(&relationId, &wayId, &building, &landuse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		multipolygons = append(multipolygons, relationId.String+"|"+wayId.String+"|"+building.String+"|"+landuse.String)
+	}
+	rows.Close()
+	if len(multipolygons) != 2 || multipolygons[0] != "|13|yes|" || multipolygons[1] != "20|||forest" {
+		t.Errorf("Wrong multipolygons: %v", multipolygons)
+	}
+
+	var route, otherTags string
+	err = db.QueryRow("SELECT osm_id, route, other_tags FROM multilinestrings").Scan(&osmId, &route, &otherTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if osmId != "21" || route != "hiking" || otherTags != `"network"=>"lwn"` {
+		t.Errorf("Wrong multilinestring: %s, %s, %s", osmId, route, otherTags)
+	}
+
+	var geometryType string
+	err = db.QueryRow("SELECT geometry_type_name FROM gpkg_geometry_columns WHERE table_name = 'multipolygons'").Scan(&geometryType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if geometryType != "MULTIPOLYGON" {
+		t.Errorf("Wrong geometry type: %s", geometryType)
+	}
+}
+
+func TestWriteWay_pointsOfClockwiseAreaUnchanged(t *testing.T) {
+	conf, err := readConfig("../../data/osmconf.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := newGpkgWriter(filepath.Join(t.TempDir(), "output.gpkg"), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.close()
+
+	way := &osm.Way{ID: 13, Tags: osm.Tags{{Key: "building", Value: "yes"}}}
+	nodeIds := []osm.NodeID{1, 4, 3, 1}
+	points := []orb.Point{{10.0, 53.0}, {10.0, 53.2}, {10.2, 53.2}, {10.0, 53.0}}
+
+	// Act
+	err = writeWay(writer, conf, way, nodeIds, points)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if points[1] != (orb.Point{10.0, 53.2}) || points[2] != (orb.Point{10.2, 53.2}) {
+		t.Errorf("Points must stay in the order of the node IDs but were %v", points)
+	}
+}
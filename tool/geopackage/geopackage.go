@@ -0,0 +1,454 @@
+package geopackage
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkb"
+	"github.com/paulmach/osm"
+	_ "modernc.org/sqlite"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const srsId = 4326
+
+// "GPKG" as 32-bit integer
+const applicationId = 0x47504B47
+
+// GeoPackage version 1.3
+const userVersion = 10300
+
+var tagReferenceRegex = regexp.MustCompile(`\[([^]]+)]`)
+
+// gpkgWriter writes features into a new GeoPackage file. All features are written within one transaction, which is
+// committed on close.
+type gpkgWriter struct {
+	db     *sql.DB
+	tx     *sql.Tx
+	layers map[string]*gpkgLayer
+}
+
+// gpkgLayer is one feature table of the GeoPackage.
+type gpkgLayer struct {
+	config             *layerConfig
+	geometryType       string
+	hasOsmWayId        bool
+	insertStatement    *sql.Stmt
+	computedStatements []*computedStatement
+	bound              *orb.Bound
+	numberOfFeatures   int
+	// The newest timestamp of all features, used as last change of the layer to not depend on the time of the export.
+	lastChange string
+}
+
+// computedStatement is a prepared statement of a computed attribute with the tag keys for its parameters.
+type computedStatement struct {
+	statement *sql.Stmt
+	keys      []string
+}
+
+func newGpkgWriter(fileName string, conf *config) (*gpkgWriter, error) {
+	writer, err := openGpkgWriter(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	layerGeometryTypes := map[string]string{
+		layerPoints:           "POINT",
+		layerLines:            "LINESTRING",
+		layerMultipolygons:    "MULTIPOLYGON",
+		layerMultilinestrings: "MULTILINESTRING",
+	}
+	for _, layerName := range []string{layerPoints, layerLines, layerMultipolygons, layerMultilinestrings} {
+		layer := &gpkgLayer{
+			config:       conf.layers[layerName],
+			geometryType: layerGeometryTypes[layerName],
+			hasOsmWayId:  layerName == layerMultipolygons,
+		}
+		err = writer.createLayer(layer)
+		if err != nil {
+			writer.abort()
+			return nil, err
+		}
+	}
+
+	return writer, nil
+}
+
+// openGpkgWriter creates a new GeoPackage file without any layers and starts the transaction for writing features.
+func openGpkgWriter(fileName string) (*gpkgWriter, error) {
+	err := os.Remove(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", fileName)
+	if err != nil {
+		return nil, err
+	}
+	// Only one connection, otherwise prepared statements might use a connection outside the transaction.
+	db.SetMaxOpenConns(1)
+
+	writer := &gpkgWriter{
+		db:     db,
+		layers: map[string]*gpkgLayer{},
+	}
+
+	err = writer.createMetadataTables()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	writer.tx, err = db.Begin()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+// abort discards all written features and closes the file.
+func (w *gpkgWriter) abort() {
+	w.tx.Rollback()
+	w.db.Close()
+}
+
+func (w *gpkgWriter) createMetadataTables() error {
+	statements := []string{
+		fmt.Sprintf("PRAGMA application_id = %d", applicationId),
+		fmt.Sprintf("PRAGMA user_version = %d", userVersion),
+		`CREATE TABLE gpkg_spatial_ref_sys (
+			srs_name TEXT NOT NULL,
+			srs_id INTEGER NOT NULL PRIMARY KEY,
+			organization TEXT NOT NULL,
+			organization_coordsys_id INTEGER NOT NULL,
+			definition TEXT NOT NULL,
+			description TEXT
+		)`,
+		`INSERT INTO gpkg_spatial_ref_sys VALUES
+			('Undefined cartesian SRS', -1, 'NONE', -1, 'undefined', 'undefined cartesian coordinate reference system'),
+			('Undefined geographic SRS', 0, 'NONE', 0, 'undefined', 'undefined geographic coordinate reference system'),
+			('WGS 84 geodetic', 4326, 'EPSG', 4326, 'GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]],AUTHORITY["EPSG","6326"]],PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AXIS["Latitude",NORTH],AXIS["Longitude",EAST],AUTHORITY["EPSG","4326"]]', 'longitude/latitude coordinates in decimal degrees on the WGS 84 spheroid')`,
+		`CREATE TABLE gpkg_contents (
+			table_name TEXT NOT NULL PRIMARY KEY,
+			data_type TEXT NOT NULL,
+			identifier TEXT UNIQUE,
+			description TEXT DEFAULT '',
+			last_change DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+			min_x DOUBLE,
+			min_y DOUBLE,
+			max_x DOUBLE,
+			max_y DOUBLE,
+			srs_id INTEGER,
+			CONSTRAINT fk_gc_r_srs_id FOREIGN KEY (srs_id) REFERENCES gpkg_spatial_ref_sys(srs_id)
+		)`,
+		`CREATE TABLE gpkg_geometry_columns (
+			table_name TEXT NOT NULL,
+			column_name TEXT NOT NULL,
+			geometry_type_name TEXT NOT NULL,
+			srs_id INTEGER NOT NULL,
+			z TINYINT NOT NULL,
+			m TINYINT NOT NULL,
+			CONSTRAINT pk_geom_cols PRIMARY KEY (table_name, column_name),
+			CONSTRAINT uk_gc_table_name UNIQUE (table_name),
+			CONSTRAINT fk_gc_tn FOREIGN KEY (table_name) REFERENCES gpkg_contents(table_name),
+			CONSTRAINT fk_gc_srs FOREIGN KEY (srs_id) REFERENCES gpkg_spatial_ref_sys (srs_id)
+		)`,
+	}
+
+	for _, statement := range statements {
+		_, err := w.db.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createLayer creates the feature table of the given layer, registers it in the GeoPackage metadata tables and prepares
+// the statements for inserting features. Features can then be written into the layer using its name.
+func (w *gpkgWriter) createLayer(layer *gpkgLayer) error {
+	columns := []string{"fid INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL", "geom " + layer.geometryType}
+	var insertColumns []string
+	for _, column := range layer.columns() {
+		columns = append(columns, quoteIdentifier(column.name)+" "+column.sqlType)
+		insertColumns = append(insertColumns, quoteIdentifier(column.name))
+	}
+
+	_, err := w.tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdentifier(layer.config.name), strings.Join(columns, ", ")))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.tx.Exec("INSERT INTO gpkg_contents (table_name, data_type, identifier, srs_id) VALUES (?, 'features', ?, ?)", layer.config.name, layer.config.name, srsId)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.tx.Exec("INSERT INTO gpkg_geometry_columns VALUES (?, 'geom', ?, ?, 0, 0)", layer.config.name, layer.geometryType, srsId)
+	if err != nil {
+		return err
+	}
+
+	placeholders := strings.Repeat(", ?", len(insertColumns))
+	layer.insertStatement, err = w.tx.Prepare(fmt.Sprintf("INSERT INTO %s (geom, %s) VALUES (?%s)", quoteIdentifier(layer.config.name), strings.Join(insertColumns, ", "), placeholders))
+	if err != nil {
+		return err
+	}
+
+	for _, computed := range layer.config.computed {
+		// Tag references like "[highway]" become parameters of the statement.
+		var keys []string
+		for _, match := range tagReferenceRegex.FindAllStringSubmatch(computed.sqlStatement, -1) {
+			keys = append(keys, match[1])
+		}
+
+		statement, err := w.tx.Prepare(tagReferenceRegex.ReplaceAllString(computed.sqlStatement, "?"))
+		if err != nil {
+			return err
+		}
+		layer.computedStatements = append(layer.computedStatements, &computedStatement{statement: statement, keys: keys})
+	}
+
+	w.layers[layer.config.name] = layer
+	return nil
+}
+
+type column struct {
+	name    string
+	sqlType string
+}
+
+// columns returns all attribute columns of the layer in the order of GDALs OSM driver.
+func (l *gpkgLayer) columns() []column {
+	var columns []column
+	if l.config.osmId {
+		columns = append(columns, column{"osm_id", "TEXT"})
+	}
+	if l.hasOsmWayId {
+		columns = append(columns, column{"osm_way_id", "TEXT"})
+	}
+	if l.config.osmVersion {
+		columns = append(columns, column{"osm_version", "INTEGER"})
+	}
+	if l.config.osmTimestamp {
+		columns = append(columns, column{"osm_timestamp", "DATETIME"})
+	}
+	if l.config.osmUid {
+		columns = append(columns, column{"osm_uid", "INTEGER"})
+	}
+	if l.config.osmUser {
+		columns = append(columns, column{"osm_user", "TEXT"})
+	}
+	if l.config.osmChangeset {
+		columns = append(columns, column{"osm_changeset", "INTEGER"})
+	}
+	for _, attribute := range l.config.attributes {
+		sqlType, ok := l.config.attributeTypes[attribute]
+		if !ok {
+			sqlType = "TEXT"
+		}
+		columns = append(columns, column{attribute, sqlType})
+	}
+	if l.config.otherTags {
+		columns = append(columns, column{"other_tags", "TEXT"})
+	}
+	for _, computed := range l.config.computed {
+		columns = append(columns, column{computed.name, computed.sqlType})
+	}
+	return columns
+}
+
+// feature is one object to write into a layer. Polygons created from closed ways only have an OSM way ID.
+type feature struct {
+	geometry  orb.Geometry
+	osmId     string
+	osmWayId  string
+	version   int
+	timestamp string
+	uid       osm.UserID
+	user      string
+	changeset osm.ChangesetID
+	tags      osm.Tags
+}
+
+func (w *gpkgWriter) write(layerName string, f *feature) error {
+	layer := w.layers[layerName]
+	if f.timestamp > layer.lastChange {
+		layer.lastChange = f.timestamp
+	}
+
+	geometryBlob, err := toGeometryBlob(f.geometry)
+	if err != nil {
+		return err
+	}
+
+	values := []any{geometryBlob}
+	if layer.config.osmId {
+		values = append(values, nullIfEmpty(f.osmId))
+	}
+	if layer.hasOsmWayId {
+		values = append(values, nullIfEmpty(f.osmWayId))
+	}
+	if layer.config.osmVersion {
+		values = append(values, f.version)
+	}
+	if layer.config.osmTimestamp {
+		values = append(values, nullIfEmpty(f.timestamp))
+	}
+	if layer.config.osmUid {
+		values = append(values, int64(f.uid))
+	}
+	if layer.config.osmUser {
+		values = append(values, nullIfEmpty(f.user))
+	}
+	if layer.config.osmChangeset {
+		values = append(values, int64(f.changeset))
+	}
+	for _, attribute := range layer.config.attributes {
+		values = append(values, nullIfEmpty(f.tags.Find(attribute)))
+	}
+	if layer.config.otherTags {
+		values = append(values, nullIfEmpty(layer.otherTags(f.tags)))
+	}
+	for _, computed := range layer.computedStatements {
+		var parameters []any
+		for _, key := range computed.keys {
+			parameters = append(parameters, nullIfEmpty(f.tags.Find(key)))
+		}
+
+		var value any
+		err = computed.statement.QueryRow(parameters...).Scan(&value)
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+
+	_, err = layer.insertStatement.Exec(values...)
+	if err != nil {
+		return err
+	}
+
+	bound := f.geometry.Bound()
+	if layer.bound == nil {
+		layer.bound = &bound
+	} else {
+		extendedBound := layer.bound.Union(bound)
+		layer.bound = &extendedBound
+	}
+	layer.numberOfFeatures++
+
+	return nil
+}
+
+// otherTags returns all tags without own column in the HSTORE format GDAL uses, e.g. "key1"=>"value1","key2"=>"value2".
+func (l *gpkgLayer) otherTags(tags osm.Tags) string {
+	var entries []string
+	for _, tag := range tags {
+		if containsString(l.config.attributes, tag.Key) || l.config.isIgnored(tag.Key) {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("%s=>%s", quoteHstore(tag.Key), quoteHstore(tag.Value)))
+	}
+	return strings.Join(entries, ",")
+}
+
+func quoteHstore(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "\"", "\\\"")
+	return "\"" + value + "\""
+}
+
+func quoteIdentifier(identifier string) string {
+	return "\"" + strings.ReplaceAll(identifier, "\"", "\"\"") + "\""
+}
+
+func nullIfEmpty(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// close stores the extent and last change of each layer and commits all written features.
+func (w *gpkgWriter) close() error {
+	var err error
+	for _, layer := range w.layers {
+		_, err = w.tx.Exec("UPDATE gpkg_contents SET last_change = ? WHERE table_name = ?", toLastChange(layer.lastChange), layer.config.name)
+		if err != nil {
+			break
+		}
+
+		if layer.bound == nil {
+			continue
+		}
+
+		_, err = w.tx.Exec("UPDATE gpkg_contents SET min_x = ?, min_y = ?, max_x = ?, max_y = ? WHERE table_name = ?",
+			layer.bound.Min.Lon(), layer.bound.Min.Lat(), layer.bound.Max.Lon(), layer.bound.Max.Lat(), layer.config.name)
+		if err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = w.tx.Commit()
+	} else {
+		w.tx.Rollback()
+	}
+
+	closeErr := w.db.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// toLastChange turns the given RFC 3339 timestamp into the format required for the last change of a layer. Layers
+// without timestamp get the Unix epoch.
+func toLastChange(timestamp string) string {
+	lastChange, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		lastChange = time.Unix(0, 0)
+	}
+	return lastChange.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// toGeometryBlob encodes the geometry in the GeoPackage binary format: A header with the SRS-ID and the envelope of the
+// geometry followed by the geometry as WKB.
+func toGeometryBlob(geometry orb.Geometry) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+
+	// Magic "GP", version 0 and flags: little endian, envelope with [minx, maxx, miny, maxy]
+	buffer.Write([]byte{'G', 'P', 0, 0b00000011})
+
+	bound := geometry.Bound()
+	values := []any{
+		int32(srsId),
+		bound.Min.Lon(),
+		bound.Max.Lon(),
+		bound.Min.Lat(),
+		bound.Max.Lat(),
+	}
+	for _, value := range values {
+		err := binary.Write(buffer, binary.LittleEndian, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	geometryWkb, err := wkb.Marshal(geometry, binary.LittleEndian)
+	if err != nil {
+		return nil, err
+	}
+	buffer.Write(geometryWkb)
+
+	return buffer.Bytes(), nil
+}
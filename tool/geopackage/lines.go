@@ -0,0 +1,54 @@
+package geopackage
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+)
+
+// LineWriter writes linestrings into a single layer of a new GeoPackage file, e.g. for data not coming from OSM like
+// contour lines.
+type LineWriter struct {
+	writer    *gpkgWriter
+	layerName string
+}
+
+// NewLineWriter creates the given GeoPackage file with one linestring layer. The layer has a column for each of the
+// given attributes, the attribute types (e.g. "INTEGER") default to TEXT.
+func NewLineWriter(fileName string, layerName string, attributes []string, attributeTypes map[string]string) (*LineWriter, error) {
+	writer, err := openGpkgWriter(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	layer := &gpkgLayer{
+		config: &layerConfig{
+			name:           layerName,
+			attributes:     attributes,
+			attributeTypes: attributeTypes,
+		},
+		geometryType: "LINESTRING",
+	}
+	err = writer.createLayer(layer)
+	if err != nil {
+		writer.abort()
+		return nil, err
+	}
+
+	return &LineWriter{
+		writer:    writer,
+		layerName: layerName,
+	}, nil
+}
+
+// Write adds the line to the layer. The attribute values are taken from the tags with the same keys.
+func (w *LineWriter) Write(line orb.LineString, attributes osm.Tags) error {
+	return w.writer.write(w.layerName, &feature{
+		geometry: line,
+		tags:     attributes,
+	})
+}
+
+// Close stores the extent of the layer and closes the file.
+func (w *LineWriter) Close() error {
+	return w.writer.close()
+}
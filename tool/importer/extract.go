@@ -0,0 +1,311 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hauke96/sigolo"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"os"
+	"tool/common"
+)
+
+// extractArea describes the area to extract. Points are first checked against the bound for performance reasons.
+type extractArea struct {
+	bound   orb.Bound
+	polygon orb.MultiPolygon
+}
+
+func newExtractArea(region *Region) (*extractArea, error) {
+	if region.Polygon == "" {
+		bbox := region.normalizedBbox()
+		return &extractArea{
+			bound: orb.Bound{Min: orb.Point{bbox[0], bbox[1]}, Max: orb.Point{bbox[2], bbox[3]}},
+		}, nil
+	}
+
+	polygon, err := readPolygon(region.Polygon)
+	if err != nil {
+		return nil, err
+	}
+
+	return &extractArea{
+		bound:   polygon.Bound(),
+		polygon: polygon,
+	}, nil
+}
+
+func (a *extractArea) contains(point orb.Point) bool {
+	if !a.bound.Contains(point) {
+		return false
+	}
+	return a.polygon == nil || planar.MultiPolygonContains(a.polygon, point)
+}
+
+// readPolygon reads the polygons of the given GeoJSON file. The file may contain a feature collection, a feature or a
+// plain geometry. All polygons and multipolygons in the file are combined into one multipolygon.
+func readPolygon(polygonFile string) (orb.MultiPolygon, error) {
+	fileContent, err := os.ReadFile(polygonFile)
+	if err != nil {
+		return nil, err
+	}
+
+	typeInfo := struct {
+		Type string `json:"type"`
+	}{}
+	err = json.Unmarshal(fileContent, &typeInfo)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error reading GeoJSON file %s: %s", polygonFile, err.Error()))
+	}
+
+	var geometries []orb.Geometry
+	switch typeInfo.Type {
+	case "FeatureCollection":
+		featureCollection, err := geojson.UnmarshalFeatureCollection(fileContent)
+		if err != nil {
+			return nil, err
+		}
+		for _, feature := range featureCollection.Features {
+			geometries = append(geometries, feature.Geometry)
+		}
+	case "Feature":
+		feature, err := geojson.UnmarshalFeature(fileContent)
+		if err != nil {
+			return nil, err
+		}
+		geometries = append(geometries, feature.Geometry)
+	default:
+		geometry, err := geojson.UnmarshalGeometry(fileContent)
+		if err != nil {
+			return nil, err
+		}
+		geometries = append(geometries, geometry.Geometry())
+	}
+
+	var multiPolygon orb.MultiPolygon
+	for _, geometry := range geometries {
+		switch g := geometry.(type) {
+		case orb.Polygon:
+			multiPolygon = append(multiPolygon, g)
+		case orb.MultiPolygon:
+			multiPolygon = append(multiPolygon, g...)
+		}
+	}
+
+	if len(multiPolygon) == 0 {
+		return nil, errors.New(fmt.Sprintf("GeoJSON file %s contains no polygon", polygonFile))
+	}
+
+	return multiPolygon, nil
+}
+
+// extractData extracts the data within the given area from the sorted input file into the output file. The same
+// "smart" strategy as osmium uses is applied:
+//   - All nodes inside the area are kept.
+//   - All ways with at least one node inside the area are kept completely, including their nodes outside the area.
+//   - All relations with at least one member in the extract are kept (without their members outside the extract).
+//   - Multipolygon relations in the extract are kept completely, including all member ways and their nodes.
+//   - Relations with kept relations as member are kept as well.
+//
+// Unlike osmium, relations with a member way that is only kept due to a completed multipolygon are kept as well,
+// independent of the order of the relations in the file.
+//
+// The input file is read three times: To determine the kept objects, to collect the nodes of all kept ways and to write
+// the kept objects. The relations are read again as long as completing multipolygons adds further ways.
+func extractData(area *extractArea, inputFile string, outputFile string) error {
+	nodeIds := map[osm.NodeID]bool{}
+	wayIds := map[osm.WayID]bool{}
+	relationIds := map[osm.RelationID]bool{}
+	// Relations that are members of other relations, needed to find parent relations of kept relations.
+	parentRelations := map[osm.RelationID][]osm.RelationID{}
+	// Number of ways added by completing multipolygons since the relations were last checked.
+	numberOfCompletedWays := 0
+
+	sigolo.Debug("Start first pass: Find objects within the extract")
+	err := scanFile(inputFile, func(obj osm.Object) {
+		switch osmObj := obj.(type) {
+		case *osm.Node:
+			if area.contains(osmObj.Point()) {
+				nodeIds[osmObj.ID] = true
+			}
+		case *osm.Way:
+			for _, wayNode := range osmObj.Nodes {
+				if nodeIds[wayNode.ID] {
+					wayIds[osmObj.ID] = true
+					break
+				}
+			}
+		case *osm.Relation:
+			for _, member := range osmObj.Members {
+				if member.Type == osm.TypeRelation {
+					parentRelations[osm.RelationID(member.Ref)] = append(parentRelations[osm.RelationID(member.Ref)], osmObj.ID)
+				}
+			}
+			numberOfCompletedWays += keepRelation(osmObj, nodeIds, wayIds, relationIds)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Relations before a completed multipolygon in the file haven't seen the added ways yet.
+	for numberOfCompletedWays > 0 {
+		sigolo.Debug("Find relations with %d ways of completed multipolygons", numberOfCompletedWays)
+		numberOfCompletedWays = 0
+		err = scanRelations(inputFile, func(relation *osm.Relation) {
+			numberOfCompletedWays += keepRelation(relation, nodeIds, wayIds, relationIds)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	addParentRelations(relationIds, parentRelations)
+
+	sigolo.Debug("Start second pass: Collect nodes of %d ways", len(wayIds))
+	err = scanFile(inputFile, func(obj osm.Object) {
+		if way, ok := obj.(*osm.Way); ok && wayIds[way.ID] {
+			for _, wayNode := range way.Nodes {
+				nodeIds[wayNode.ID] = true
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	sigolo.Debug("Start third pass: Write %d nodes, %d ways and %d relations", len(nodeIds), len(wayIds), len(relationIds))
+	writer, err := common.NewPbfWriter(outputFile, &osm.Bounds{
+		MinLon: area.bound.Min.Lon(),
+		MinLat: area.bound.Min.Lat(),
+		MaxLon: area.bound.Max.Lon(),
+		MaxLat: area.bound.Max.Lat(),
+	})
+	if err != nil {
+		return err
+	}
+
+	var writeErr error
+	err = scanFile(inputFile, func(obj osm.Object) {
+		if writeErr != nil {
+			return
+		}
+
+		keep := false
+		switch osmObj := obj.(type) {
+		case *osm.Node:
+			keep = nodeIds[osmObj.ID]
+		case *osm.Way:
+			keep = wayIds[osmObj.ID]
+		case *osm.Relation:
+			keep = relationIds[osmObj.ID]
+		}
+
+		if keep {
+			writeErr = writer.WriteObject(obj)
+		}
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		writer.Close()
+		return err
+	}
+
+	return writer.Close()
+}
+
+// keepRelation marks the given relation as kept when at least one of its node or way members is kept. Kept
+// multipolygons are completed by keeping all their member ways, their nodes are collected in the second pass. The
+// number of ways newly kept this way is returned.
+func keepRelation(relation *osm.Relation, nodeIds map[osm.NodeID]bool, wayIds map[osm.WayID]bool, relationIds map[osm.RelationID]bool) int {
+	if relationIds[relation.ID] {
+		return 0
+	}
+
+	for _, member := range relation.Members {
+		if (member.Type == osm.TypeNode && nodeIds[osm.NodeID(member.Ref)]) || (member.Type == osm.TypeWay && wayIds[osm.WayID(member.Ref)]) {
+			relationIds[relation.ID] = true
+			break
+		}
+	}
+
+	numberOfCompletedWays := 0
+	if relationIds[relation.ID] && relation.Tags.Find("type") == "multipolygon" {
+		for _, member := range relation.Members {
+			if member.Type == osm.TypeWay && !wayIds[osm.WayID(member.Ref)] {
+				wayIds[osm.WayID(member.Ref)] = true
+				numberOfCompletedWays++
+			}
+		}
+	}
+
+	return numberOfCompletedWays
+}
+
+// addParentRelations adds all relations having a kept relation as member. This is done recursively, so that parents
+// of parents are kept as well.
+func addParentRelations(relationIds map[osm.RelationID]bool, parentRelations map[osm.RelationID][]osm.RelationID) {
+	var relationsToCheck []osm.RelationID
+	for relationId := range relationIds {
+		relationsToCheck = append(relationsToCheck, relationId)
+	}
+
+	for len(relationsToCheck) > 0 {
+		relationId := relationsToCheck[len(relationsToCheck)-1]
+		relationsToCheck = relationsToCheck[:len(relationsToCheck)-1]
+
+		for _, parentId := range parentRelations[relationId] {
+			if !relationIds[parentId] {
+				relationIds[parentId] = true
+				relationsToCheck = append(relationsToCheck, parentId)
+			}
+		}
+	}
+}
+
+// scanFile calls the given function for each object of the given OSM-PBF file.
+func scanFile(inputFile string, handle func(obj osm.Object)) error {
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := osmpbf.New(context.Background(), f, 1)
+	defer scanner.Close()
+
+	for scanner.Scan() {
+		handle(scanner.Object())
+	}
+
+	return scanner.Err()
+}
+
+// scanRelations calls the given function for each relation of the given OSM-PBF file. Nodes and ways are skipped.
+func scanRelations(inputFile string, handle func(relation *osm.Relation)) error {
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := osmpbf.New(context.Background(), f, 1)
+	scanner.SkipNodes = true
+	scanner.SkipWays = true
+	defer scanner.Close()
+
+	for scanner.Scan() {
+		if relation, ok := scanner.Object().(*osm.Relation); ok {
+			handle(relation)
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,237 @@
+package importer
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"os"
+	"path/filepath"
+	"testing"
+	"tool/common"
+)
+
+func writeTestFile(t *testing.T, data *osm.OSM) string {
+	file := filepath.Join(t.TempDir(), "input.osm.pbf")
+	common.WriteOsmToPbf(file, data)
+	return file
+}
+
+func readTestFile(t *testing.T, file string) map[osm.ObjectID]osm.Object {
+	objects := map[osm.ObjectID]osm.Object{}
+	err := scanFile(file, func(obj osm.Object) {
+		objects[obj.ObjectID()] = obj
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objects
+}
+
+func TestExtractData(t *testing.T) {
+	inputFile := writeTestFile(t, &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lon: 0.5, Lat: 0.5},
+			{ID: 2, Version: 1, Lon: 1.5, Lat: 0.5},
+			{ID: 3, Version: 1, Lon: 2.5, Lat: 0.5},
+			{ID: 4, Version: 1, Lon: 2.5, Lat: 1.5},
+			{ID: 5, Version: 1, Lon: 3.5, Lat: 3.5},
+		},
+		Ways: osm.Ways{
+			// Crosses the border -> kept with node 2
+			{ID: 10, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+			// Outside but member of a multipolygon inside the extract -> kept with nodes 3 and 4
+			{ID: 11, Version: 1, Nodes: osm.WayNodes{{ID: 3}, {ID: 4}}},
+			// Outside
+			{ID: 12, Version: 1, Nodes: osm.WayNodes{{ID: 4}, {ID: 5}}},
+		},
+		Relations: osm.Relations{
+			{ID: 20, Version: 1, Tags: osm.Tags{{Key: "type", Value: "multipolygon"}}, Members: osm.Members{
+				{Type: osm.TypeWay, Ref: 10, Role: "outer"},
+				{Type: osm.TypeWay, Ref: 11, Role: "outer"},
+			}},
+			// Outside
+			{ID: 21, Version: 1, Tags: osm.Tags{{Key: "type", Value: "route"}}, Members: osm.Members{
+				{Type: osm.TypeWay, Ref: 12},
+			}},
+			// Parent of a relation in the extract
+			{ID: 22, Version: 1, Tags: osm.Tags{{Key: "type", Value: "superroute"}}, Members: osm.Members{
+				{Type: osm.TypeRelation, Ref: 20},
+			}},
+		},
+	})
+	outputFile := filepath.Join(t.TempDir(), "output.osm.pbf")
+
+	area, err := newExtractArea(&Region{Bbox: []float64{0, 0, 1, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = extractData(area, inputFile, outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects := readTestFile(t, outputFile)
+	expectedObjects := []osm.ObjectID{
+		osm.NodeID(1).ObjectID(1),
+		osm.NodeID(2).ObjectID(1),
+		osm.NodeID(3).ObjectID(1),
+		osm.NodeID(4).ObjectID(1),
+		osm.WayID(10).ObjectID(1),
+		osm.WayID(11).ObjectID(1),
+		osm.RelationID(20).ObjectID(1),
+		osm.RelationID(22).ObjectID(1),
+	}
+	if len(objects) != len(expectedObjects) {
+		t.Errorf("Expected %d objects but got %d: %v", len(expectedObjects), len(objects), objects)
+	}
+	for _, id := range expectedObjects {
+		if _, ok := objects[id]; !ok {
+			t.Errorf("Expected object %s in extract", id)
+		}
+	}
+}
+
+func TestExtractData_relationsOfCompletedMultipolygons(t *testing.T) {
+	inputFile := writeTestFile(t, &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lon: 0.5, Lat: 0.5},
+			{ID: 2, Version: 1, Lon: 1.5, Lat: 0.5},
+			{ID: 3, Version: 1, Lon: 2.5, Lat: 0.5},
+			{ID: 4, Version: 1, Lon: 2.5, Lat: 1.5},
+			{ID: 5, Version: 1, Lon: 3.5, Lat: 3.5},
+		},
+		Ways: osm.Ways{
+			{ID: 10, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+			{ID: 11, Version: 1, Nodes: osm.WayNodes{{ID: 3}, {ID: 4}}},
+			{ID: 12, Version: 1, Nodes: osm.WayNodes{{ID: 4}, {ID: 5}}},
+		},
+		Relations: osm.Relations{
+			// Multipolygon sharing way 11 with multipolygon 20 -> completed as well, which keeps way 12 and node 5
+			{ID: 18, Version: 1, Tags: osm.Tags{{Key: "type", Value: "multipolygon"}}, Members: osm.Members{
+				{Type: osm.TypeWay, Ref: 11, Role: "outer"},
+				{Type: osm.TypeWay, Ref: 12, Role: "outer"},
+			}},
+			// Way 11 is only kept after reading multipolygon 20 -> kept in spite of being before 20 in the file
+			{ID: 19, Version: 1, Tags: osm.Tags{{Key: "type", Value: "route"}}, Members: osm.Members{
+				{Type: osm.TypeWay, Ref: 11},
+			}},
+			{ID: 20, Version: 1, Tags: osm.Tags{{Key: "type", Value: "multipolygon"}}, Members: osm.Members{
+				{Type: osm.TypeWay, Ref: 10, Role: "outer"},
+				{Type: osm.TypeWay, Ref: 11, Role: "outer"},
+			}},
+		},
+	})
+	outputFile := filepath.Join(t.TempDir(), "output.osm.pbf")
+
+	area, err := newExtractArea(&Region{Bbox: []float64{0, 0, 1, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	err = extractData(area, inputFile, outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	objects := readTestFile(t, outputFile)
+	expectedObjects := []osm.ObjectID{
+		osm.NodeID(1).ObjectID(1),
+		osm.NodeID(2).ObjectID(1),
+		osm.NodeID(3).ObjectID(1),
+		osm.NodeID(4).ObjectID(1),
+		osm.NodeID(5).ObjectID(1),
+		osm.WayID(10).ObjectID(1),
+		osm.WayID(11).ObjectID(1),
+		osm.WayID(12).ObjectID(1),
+		osm.RelationID(18).ObjectID(1),
+		osm.RelationID(19).ObjectID(1),
+		osm.RelationID(20).ObjectID(1),
+	}
+	if len(objects) != len(expectedObjects) {
+		t.Errorf("Expected %d objects but got %d: %v", len(expectedObjects), len(objects), objects)
+	}
+	for _, id := range expectedObjects {
+		if _, ok := objects[id]; !ok {
+			t.Errorf("Expected object %s in extract", id)
+		}
+	}
+}
+
+func TestExtractArea_polygon(t *testing.T) {
+	polygonFile := filepath.Join(t.TempDir(), "polygon.geojson")
+	err := os.WriteFile(polygonFile, []byte(`{
+		"type": "FeatureCollection",
+		"features": [{
+			"type": "Feature",
+			"properties": {},
+			"geometry": {"type": "Polygon", "coordinates": [[[0, 0], [2, 0], [0, 2], [0, 0]]]}
+		}]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	area, err := newExtractArea(&Region{Polygon: polygonFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !area.contains(orb.Point{0.5, 0.5}) {
+		t.Errorf("Point inside polygon not contained")
+	}
+	if area.contains(orb.Point{1.5, 1.5}) {
+		t.Errorf("Point inside bbox but outside polygon is contained")
+	}
+	if area.contains(orb.Point{3, 3}) {
+		t.Errorf("Point outside bbox is contained")
+	}
+}
+
+func TestMergeData(t *testing.T) {
+	inputFile1 := writeTestFile(t, &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1},
+			{ID: 2, Version: 1},
+		},
+		Ways: osm.Ways{
+			{ID: 10, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+		},
+	})
+	inputFile2 := writeTestFile(t, &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 2, Version: 2},
+			{ID: 3, Version: 1},
+		},
+		Ways: osm.Ways{
+			{ID: 10, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+		},
+		Relations: osm.Relations{
+			{ID: 20, Version: 1},
+		},
+	})
+	outputFile := filepath.Join(t.TempDir(), "output.osm.pbf")
+
+	err := mergeData([]string{inputFile1, inputFile2}, outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects := readTestFile(t, outputFile)
+	expectedObjects := []osm.ObjectID{
+		osm.NodeID(1).ObjectID(1),
+		osm.NodeID(2).ObjectID(2),
+		osm.NodeID(3).ObjectID(1),
+		osm.WayID(10).ObjectID(1),
+		osm.RelationID(20).ObjectID(1),
+	}
+	if len(objects) != len(expectedObjects) {
+		t.Errorf("Expected %d objects but got %d: %v", len(expectedObjects), len(objects), objects)
+	}
+	for _, id := range expectedObjects {
+		if _, ok := objects[id]; !ok {
+			t.Errorf("Expected object %s in merged file", id)
+		}
+	}
+}
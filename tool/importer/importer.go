@@ -0,0 +1,118 @@
+package importer
+
+import (
+	"fmt"
+	"github.com/hauke96/sigolo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"tool/common"
+	"tool/downloader"
+	"tool/preprocessor"
+)
+
+// Import downloads all sources of the given region, extracts the area of the region from each source, merges these
+// extracts and preprocesses the merged data into the given output file. Extracting and merging is done by osmium when
+// useOsmium is true.
+func Import(regionsFile string, regionName string, downloadFolder string, baseUrl string, outputFile string, streaming bool, useOsmium bool) {
+	regions, err := readRegions(regionsFile)
+	sigolo.FatalCheck(err)
+
+	region, err := findRegion(regions, regionName)
+	sigolo.FatalCheck(err)
+
+	sigolo.Info("Import region %s", region.Name)
+
+	var extractFiles []string
+	for i, source := range region.Sources {
+		sourceFile, err := downloader.Download(baseUrl, source, downloadFolder)
+		sigolo.FatalCheck(err)
+
+		extractFile := filepath.Join(downloadFolder, fmt.Sprintf("%s-%d.osm.pbf", region.Name, i+1))
+		if isNewerThan(extractFile, sourceFile, regionsFile, region.Polygon) {
+			sigolo.Info("Skip extracting, %s is up to date", extractFile)
+		} else {
+			sigolo.Info("Extract region %s from %s", region.Name, sourceFile)
+			if useOsmium {
+				extractRegionUsingOsmium(region, sourceFile, extractFile)
+			} else {
+				area, err := newExtractArea(region)
+				sigolo.FatalCheck(err)
+				err = extractData(area, sourceFile, extractFile)
+				sigolo.FatalCheck(err)
+			}
+		}
+		extractFiles = append(extractFiles, extractFile)
+	}
+
+	mergedFile := extractFiles[0]
+	if len(extractFiles) > 1 {
+		mergedFile = filepath.Join(downloadFolder, region.Name+".osm.pbf")
+		sigolo.Info("Merge %d extracts into %s", len(extractFiles), mergedFile)
+		if useOsmium {
+			mergeFilesUsingOsmium(extractFiles, mergedFile)
+		} else {
+			err = mergeData(extractFiles, mergedFile)
+			sigolo.FatalCheck(err)
+		}
+	}
+
+	sigolo.Info("Preprocess %s", mergedFile)
+	if streaming {
+		preprocessor.PreprocessDataStreaming(mergedFile, outputFile, "")
+	} else {
+		preprocessor.PreprocessData(mergedFile, outputFile, false)
+	}
+
+	sigolo.Info("Imported region %s into %s", region.Name, outputFile)
+	if region.Layout != "" {
+		sigolo.Info("The region can be rendered using the print layout '%s'", region.Layout)
+	}
+}
+
+func extractRegionUsingOsmium(region *Region, inputFile string, outputFile string) {
+	args := []string{"extract", "-s", "smart"}
+	if region.Polygon != "" {
+		args = append(args, "-p", region.Polygon)
+	} else {
+		var bboxValues []string
+		for _, value := range region.normalizedBbox() {
+			bboxValues = append(bboxValues, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+		args = append(args, "-b", strings.Join(bboxValues, ","))
+	}
+	args = append(args, inputFile, "--overwrite", "-o", outputFile)
+
+	common.RunWithOutputRedirect(exec.Command("osmium", args...))
+}
+
+func mergeFilesUsingOsmium(inputFiles []string, outputFile string) {
+	args := append([]string{"merge"}, inputFiles...)
+	args = append(args, "--overwrite", "-o", outputFile)
+
+	common.RunWithOutputRedirect(exec.Command("osmium", args...))
+}
+
+// isNewerThan returns true when the given file exists and is newer than all other given files. Empty file names are
+// ignored.
+func isNewerThan(file string, otherFiles ...string) bool {
+	fileInfo, err := os.Stat(file)
+	if err != nil {
+		return false
+	}
+
+	for _, otherFile := range otherFiles {
+		if otherFile == "" {
+			continue
+		}
+
+		otherFileInfo, err := os.Stat(otherFile)
+		if err != nil || !fileInfo.ModTime().After(otherFileInfo.ModTime()) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"context"
+	"github.com/hauke96/sigolo"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"os"
+	"tool/common"
+)
+
+// mergeInput is one sorted input file of the merge with its current (i.e. not yet merged) object.
+type mergeInput struct {
+	file    *os.File
+	scanner *osmpbf.Scanner
+	current osm.Object
+}
+
+func (i *mergeInput) next() error {
+	if i.scanner.Scan() {
+		i.current = i.scanner.Object()
+		return nil
+	}
+	i.current = nil
+	return i.scanner.Err()
+}
+
+func (i *mergeInput) close() {
+	i.scanner.Close()
+	i.file.Close()
+}
+
+// mergeData merges the given sorted OSM-PBF files into one sorted output file. Objects existing in multiple input
+// files (e.g. ways crossing the border of two extracts) are only written once. If the versions of such objects differ,
+// the newest version is kept.
+func mergeData(inputFiles []string, outputFile string) error {
+	var inputs []*mergeInput
+	defer func() {
+		for _, input := range inputs {
+			input.close()
+		}
+	}()
+
+	var bounds *osm.Bounds
+	for _, inputFile := range inputFiles {
+		f, err := os.Open(inputFile)
+		if err != nil {
+			return err
+		}
+
+		input := &mergeInput{
+			file:    f,
+			scanner: osmpbf.New(context.Background(), f, 1),
+		}
+		inputs = append(inputs, input)
+
+		header, err := input.scanner.Header()
+		if err != nil {
+			return err
+		}
+		if header.Bounds != nil {
+			bounds = common.ExtendBounds(bounds, header.Bounds.MinLon, header.Bounds.MinLat)
+			bounds = common.ExtendBounds(bounds, header.Bounds.MaxLon, header.Bounds.MaxLat)
+		}
+
+		err = input.next()
+		if err != nil {
+			return err
+		}
+	}
+
+	writer, err := common.NewPbfWriter(outputFile, bounds)
+	if err != nil {
+		return err
+	}
+
+	numberOfDuplicates := 0
+	for {
+		// Find the next object in sort order and the newest version of it in all inputs
+		var nextObject osm.Object
+		for _, input := range inputs {
+			if input.current == nil {
+				continue
+			}
+
+			if nextObject == nil {
+				nextObject = input.current
+				continue
+			}
+
+			comparison := common.CompareObjectIds(input.current.ObjectID(), nextObject.ObjectID())
+			if comparison < 0 || (comparison == 0 && input.current.ObjectID().Version() > nextObject.ObjectID().Version()) {
+				nextObject = input.current
+			}
+		}
+
+		if nextObject == nil {
+			// All inputs are completely read
+			break
+		}
+
+		err = writer.WriteObject(nextObject)
+		if err != nil {
+			writer.Close()
+			return err
+		}
+
+		// Skip the written object in all inputs, regardless of the version
+		numberOfInputsWithObject := 0
+		for _, input := range inputs {
+			if input.current != nil && common.CompareObjectIds(input.current.ObjectID(), nextObject.ObjectID()) == 0 {
+				numberOfInputsWithObject++
+				err = input.next()
+				if err != nil {
+					writer.Close()
+					return err
+				}
+			}
+		}
+		numberOfDuplicates += numberOfInputsWithObject - 1
+	}
+
+	sigolo.Debug("Skipped %d duplicate objects while merging", numberOfDuplicates)
+	return writer.Close()
+}
@@ -0,0 +1,100 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Region describes an area for which the map data should be imported.
+type Region struct {
+	Name string `yaml:"name"`
+	// The bounding box of the region as "min-lon, min-lat, max-lon, max-lat". The order of the corners doesn't matter.
+	Bbox []float64 `yaml:"bbox"`
+	// A GeoJSON file with a (multi-)polygon describing the region. Relative paths are relative to the regions file.
+	Polygon string `yaml:"polygon"`
+	// The paths of the source extracts on the download server, e.g. "europe/germany/hamburg-latest.osm.pbf".
+	Sources []string `yaml:"sources"`
+	// The optional name of the print layout in the QGIS project belonging to this region.
+	Layout string `yaml:"layout"`
+}
+
+type regionCatalog struct {
+	Regions []*Region `yaml:"regions"`
+}
+
+// readRegions reads all regions of the given YAML file.
+func readRegions(regionsFile string) ([]*Region, error) {
+	fileContent, err := os.ReadFile(regionsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := &regionCatalog{}
+	err = yaml.Unmarshal(fileContent, catalog)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error reading regions file %s: %s", regionsFile, err.Error()))
+	}
+
+	regionNames := map[string]bool{}
+	for i, region := range catalog.Regions {
+		err = region.validate()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid region %d (%s) in %s: %s", i+1, region.Name, regionsFile, err.Error()))
+		}
+
+		if regionNames[region.Name] {
+			return nil, errors.New(fmt.Sprintf("Region %s is defined multiple times in %s", region.Name, regionsFile))
+		}
+		regionNames[region.Name] = true
+
+		if region.Polygon != "" && !filepath.IsAbs(region.Polygon) {
+			region.Polygon = filepath.Join(filepath.Dir(regionsFile), region.Polygon)
+		}
+	}
+
+	return catalog.Regions, nil
+}
+
+// findRegion returns the region with the given name or an error listing all available regions.
+func findRegion(regions []*Region, name string) (*Region, error) {
+	var regionNames []string
+	for _, region := range regions {
+		if region.Name == name {
+			return region, nil
+		}
+		regionNames = append(regionNames, region.Name)
+	}
+
+	return nil, errors.New(fmt.Sprintf("Unknown region '%s', available regions are: %s", name, strings.Join(regionNames, ", ")))
+}
+
+func (r *Region) validate() error {
+	if r.Name == "" {
+		return errors.New("The region has no name")
+	}
+	if (len(r.Bbox) == 0) == (r.Polygon == "") {
+		return errors.New("The region must have either a bbox or a polygon")
+	}
+	if len(r.Bbox) != 0 && len(r.Bbox) != 4 {
+		return errors.New(fmt.Sprintf("The bbox must have 4 values but has %d", len(r.Bbox)))
+	}
+	if len(r.Sources) == 0 {
+		return errors.New("The region has no sources")
+	}
+	return nil
+}
+
+// normalizedBbox returns the bbox of the region as "min-lon, min-lat, max-lon, max-lat".
+func (r *Region) normalizedBbox() []float64 {
+	return []float64{
+		math.Min(r.Bbox[0], r.Bbox[2]),
+		math.Min(r.Bbox[1], r.Bbox[3]),
+		math.Max(r.Bbox[0], r.Bbox[2]),
+		math.Max(r.Bbox[1], r.Bbox[3]),
+	}
+}
@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadRegions_defaultRegionsFile(t *testing.T) {
+	regions, err := readRegions("../../data/regions.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	region, err := findRegion(regions, "thueringer-wald")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(region.Polygon); err != nil {
+		t.Errorf("Polygon file of region %s not found: %s", region.Name, err.Error())
+	}
+
+	region, err = findRegion(regions, "zugspitze")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(region.Sources) != 2 {
+		t.Errorf("Expected 2 sources but got %d", len(region.Sources))
+	}
+
+	_, err = findRegion(regions, "foo")
+	if err == nil {
+		t.Errorf("Expected error for unknown region")
+	}
+}
+
+func TestReadRegions_invalidRegions(t *testing.T) {
+	invalidRegions := []string{
+		`regions: [ { bbox: [ 1, 2, 3, 4 ], sources: [ a ] } ]`,
+		`regions: [ { name: foo, sources: [ a ] } ]`,
+		`regions: [ { name: foo, bbox: [ 1, 2, 3, 4 ], polygon: foo.geojson, sources: [ a ] } ]`,
+		`regions: [ { name: foo, bbox: [ 1, 2, 3 ], sources: [ a ] } ]`,
+		`regions: [ { name: foo, bbox: [ 1, 2, 3, 4 ] } ]`,
+		`regions: [ { name: foo, bbox: [ 1, 2, 3, 4 ], sources: [ a ] }, { name: foo, bbox: [ 1, 2, 3, 4 ], sources: [ a ] } ]`,
+	}
+
+	for _, regionsFileContent := range invalidRegions {
+		regionsFile := filepath.Join(t.TempDir(), "regions.yaml")
+		err := os.WriteFile(regionsFile, []byte(regionsFileContent), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = readRegions(regionsFile)
+		if err == nil {
+			t.Errorf("Expected error for regions %s", regionsFileContent)
+		}
+	}
+}
+
+func TestRegion_normalizedBbox(t *testing.T) {
+	region := &Region{Bbox: []float64{10.8923, 47.5167, 11.2514, 47.3407}}
+
+	bbox := region.normalizedBbox()
+
+	if bbox[0] != 10.8923 || bbox[1] != 47.3407 || bbox[2] != 11.2514 || bbox[3] != 47.5167 {
+		t.Errorf("Wrong normalized bbox: %v", bbox)
+	}
+}
@@ -3,20 +3,90 @@ package main
 import (
 	"github.com/alecthomas/kong"
 	"github.com/hauke96/sigolo"
+	"time"
+	"tool/contours"
+	"tool/downloader"
+	"tool/geopackage"
+	"tool/importer"
 	"tool/preprocessor"
+	"tool/relief"
+	"tool/sprites"
 	tile_proxy "tool/tile-proxy"
 )
 
 var cli struct {
 	Debug         bool `help:"Enable debug mode." short:"d"`
 	Preprocessing struct {
-		Input  string `help:"The input file. Either .osm or .osm..pbf." placeholder:"<input-file>" arg:""`
-		Output string `help:"The output file, which must be a .osm.pbf file." placeholder:"<output-file>" arg:""`
+		Input     string    `help:"The input file. Either .osm or .osm..pbf." placeholder:"<input-file>" arg:""`
+		Output    string    `help:"The output file, which must be a .osm.pbf file." placeholder:"<output-file>" arg:""`
+		Rules     string    `help:"A YAML or JSON file with rules for tag transformations. The built-in default rules are used if not set." placeholder:"<rules-file>"`
+		Osmium    bool      `help:"Use osmium to write the output file instead of the built-in OSM-PBF writer. Not supported in streaming mode." xor:"osmium-streaming"`
+		Streaming bool      `help:"Read the input twice instead of keeping all data in memory. Requires sorted input data." xor:"osmium-streaming"`
+		NodeIndex string    `help:"A temporary file storing node locations in streaming mode. Node locations are kept in memory if not set." placeholder:"<index-file>"`
+		Timestamp time.Time `help:"The timestamp (RFC 3339, e.g. \"2024-01-31T12:00:00Z\") of generated objects. The timestamp of the object they are generated for is used if not set." placeholder:"<timestamp>"`
+		Dem       string    `help:"A GeoTIFF file (WGS84) with elevations used to add prominence, isolation and missing elevations to peaks and saddles." placeholder:"<dem-file>"`
+		Gpkg      string    `help:"Additionally convert the output into this GeoPackage file, which can directly be used by the QGIS project." placeholder:"<gpkg-file>"`
+		Osmconf   string    `help:"The GDAL osmconf.ini file defining the layers and attributes of the GeoPackage file." default:"../data/osmconf.ini"`
 	} `cmd:"" help:"Preprocesses the OSM data by adding e.g. label nodes."`
+	Download struct {
+		RegionPath string `help:"The path of the file on the download server, e.g. \"europe/germany/hamburg-latest.osm.pbf\"." placeholder:"<region-path>" arg:""`
+		Folder     string `help:"The folder the file is downloaded to." default:"downloaded-data" short:"f"`
+		BaseUrl    string `help:"The base URL of the download server." default:"${downloadBaseUrl}"`
+	} `cmd:"" help:"Downloads and verifies an OSM extract. Interrupted downloads are resumed."`
+	Import struct {
+		Region    string    `help:"The name of the region to import as defined in the regions file." placeholder:"<region>" arg:""`
+		Regions   string    `help:"The YAML file defining all regions." default:"../data/regions.yaml" short:"r"`
+		Folder    string    `help:"The folder for downloaded and intermediate files." default:"../data/downloaded-data" short:"f"`
+		Output    string    `help:"The output file, which must be a .osm.pbf file." default:"../data/downloaded-data/data-processed.osm.pbf" short:"o"`
+		BaseUrl   string    `help:"The base URL of the download server." default:"${downloadBaseUrl}"`
+		Rules     string    `help:"A YAML or JSON file with rules for tag transformations. The built-in default rules are used if not set." placeholder:"<rules-file>"`
+		Streaming bool      `help:"Preprocess the data in streaming mode, see the preprocessing command."`
+		Osmium    bool      `help:"Use osmium to extract and merge the data instead of the built-in implementation."`
+		Timestamp time.Time `help:"The timestamp of generated objects, see the preprocessing command." placeholder:"<timestamp>"`
+		Dem       string    `help:"A GeoTIFF file with elevations, see the preprocessing command." placeholder:"<dem-file>"`
+		Gpkg      string    `help:"Additionally convert the output into this GeoPackage file, which can directly be used by the QGIS project." placeholder:"<gpkg-file>"`
+		Osmconf   string    `help:"The GDAL osmconf.ini file defining the layers and attributes of the GeoPackage file." default:"../data/osmconf.ini"`
+	} `cmd:"" help:"Downloads, extracts, merges and preprocesses the data of a region."`
+	Sprites struct {
+		Osmc struct {
+			Input  string `help:"The OSM-PBF file containing the hiking route relations." placeholder:"<input-file>" arg:""`
+			Folder string `help:"The sprites folder the SVG files and the mapping table osmc-symbols.csv are written to." default:"../sprites" short:"f"`
+		} `cmd:"" help:"Generates an SVG file for each osmc:symbol of the hiking routes in the input file."`
+	} `cmd:"" help:"Generates sprites for the map style."`
+	Contours struct {
+		Input     string  `help:"The GeoTIFF file (WGS84) with elevations." placeholder:"<dem-file>" arg:""`
+		Output    string  `help:"The output file, either a .gpkg or a .osm.pbf file." placeholder:"<output-file>" arg:""`
+		Interval  float64 `help:"The elevation difference between two contour lines in meters." default:"10" short:"i"`
+		Index     int     `help:"Every n-th contour line is an index contour. Use 0 for no index contours." default:"10"`
+		Smoothing int     `help:"The number of smoothing iterations. Each iteration doubles the number of points." default:"2"`
+	} `cmd:"" help:"Generates contour lines from a digital elevation model."`
 	TileProxy struct {
-		Mappings    []string `help:"A list of URL mappings of the following form: \"<endpoint1>:<url1> <endpoint2>:<url2> ...\". Each mapping will result in an API endpoint of the form http://localhost:<port>/<endpoint>/..." arg:""`
-		Port        string   `help:"The port of the proxy on localhost." default:"9000" short:"p"`
-		CacheFolder string   `help:"A folder in which tiles will be cached." default:".tile-cache" short:"c"`
+		CacheFolder string `help:"A folder in which tiles will be cached." default:".tile-cache" short:"c"`
+
+		Serve struct {
+			Mappings         []string                 `help:"A list of URL mappings of the following form: \"<endpoint1>:<url1> <endpoint2>:<url2> ...\". Each mapping will result in an API endpoint of the form http://localhost:<port>/<endpoint>/... Use \"<endpoint>:<kind>:<dem-file>\" to serve hillshade, slope or contours tiles (kind \"hillshade\", \"slope\" or \"contours\") computed from a GeoTIFF file. Instead of a file, elevation tiles can be used with \"terrain-rgb:<url>\" or \"terrarium:<url>\"." arg:""`
+			Port             string                   `help:"The port of the proxy on localhost." default:"9000" short:"p"`
+			JpegQuality      int                      `help:"The quality of tiles requested as JPEG, from 1 (worst) to 100 (best)." default:"90"`
+			WebpQuality      int                      `help:"The quality of tiles requested as WebP, from 1 (worst) to 100 (best). Use 0 for lossless WebP tiles, which is needed for elevation tiles." default:"0"`
+			NotFoundMaxAge   time.Duration            `help:"The duration for which tiles that don't exist on the remote server (status 404) are not requested again, e.g. \"30m\". Use 0 to always request them." default:"1h"`
+			MaxAge           time.Duration            `help:"The duration after which cached remote tiles are revalidated with the remote server, e.g. \"24h\". Use 0 to never revalidate them." default:"0"`
+			EndpointMaxAge   map[string]time.Duration `help:"The max-age of single endpoints overriding --max-age, e.g. \"osm=12h;satellite=720h\"."`
+			MaxCacheSize     int64                    `help:"The maximum size of the cache folder in MB. The least recently used tiles are removed when the cache gets larger. Use 0 for no limit." default:"0"`
+			Azimuth          float64                  `help:"The direction of the light of hillshade tiles in degrees clockwise from north." default:"315"`
+			Altitude         float64                  `help:"The angle of the light of hillshade tiles above the horizon in degrees." default:"45"`
+			ZFactor          float64                  `help:"The exaggeration of the elevations for hillshade tiles." default:"1" name:"z-factor"`
+			Multidirectional bool                     `help:"Combine the light of four directions around the azimuth for hillshade tiles." default:"true" negatable:""`
+			SlopeShading     float64                  `help:"Additionally darken steep slopes in hillshade tiles, from 0 (disabled) to 1." default:"0"`
+			SlopePalette     string                   `help:"The colors of slope tiles as comma separated list of \"<min-angle>:<color>\" with colors of the form #rrggbb or #rrggbbaa." default:"${slopePalette}"`
+			ContourInterval  float64                  `help:"The elevation interval of the lines of contour tiles in meters." default:"10"`
+			ContourIndex     int                      `help:"Every n-th line of contour tiles is an index contour. Use 0 for no index contours." default:"10"`
+			ContourSmoothing int                      `help:"The number of smoothing iterations of the lines of contour tiles." default:"2"`
+		} `cmd:"" default:"withargs" help:"Start the proxy. This is the default command."`
+		Cache struct {
+			Prune struct {
+				MaxSize int64 `help:"The maximum size of the cache folder in MB." required:""`
+			} `cmd:"" help:"Remove the least recently used tiles until the cache is not larger than the given size."`
+		} `cmd:"" help:"Manage the tile cache."`
 	} `cmd:"" help:"A proxy converting remote tiles into a given image format."`
 }
 
@@ -25,19 +95,88 @@ func main() {
 
 	switch ctx.Command() {
 	case "preprocessing <input> <output>":
-		preprocessor.PreprocessData(cli.Preprocessing.Input, cli.Preprocessing.Output)
-	case "tile-proxy <mappings>":
-		tile_proxy.StartProxy(cli.TileProxy.Port, cli.TileProxy.Mappings, cli.TileProxy.CacheFolder)
+		if cli.Preprocessing.Rules != "" {
+			preprocessor.LoadRules(cli.Preprocessing.Rules)
+		}
+		preprocessor.SetTimestamp(cli.Preprocessing.Timestamp)
+		if cli.Preprocessing.Dem != "" {
+			preprocessor.LoadDem(cli.Preprocessing.Dem)
+		}
+		if cli.Preprocessing.Streaming {
+			preprocessor.PreprocessDataStreaming(cli.Preprocessing.Input, cli.Preprocessing.Output, cli.Preprocessing.NodeIndex)
+		} else {
+			preprocessor.PreprocessData(cli.Preprocessing.Input, cli.Preprocessing.Output, cli.Preprocessing.Osmium)
+		}
+		if cli.Preprocessing.Gpkg != "" {
+			exportGeoPackage(cli.Preprocessing.Output, cli.Preprocessing.Gpkg, cli.Preprocessing.Osmconf)
+		}
+	case "download <region-path>":
+		_, err := downloader.Download(cli.Download.BaseUrl, cli.Download.RegionPath, cli.Download.Folder)
+		sigolo.FatalCheck(err)
+	case "import <region>":
+		if cli.Import.Rules != "" {
+			preprocessor.LoadRules(cli.Import.Rules)
+		}
+		preprocessor.SetTimestamp(cli.Import.Timestamp)
+		if cli.Import.Dem != "" {
+			preprocessor.LoadDem(cli.Import.Dem)
+		}
+		importer.Import(cli.Import.Regions, cli.Import.Region, cli.Import.Folder, cli.Import.BaseUrl, cli.Import.Output, cli.Import.Streaming, cli.Import.Osmium)
+		if cli.Import.Gpkg != "" {
+			exportGeoPackage(cli.Import.Output, cli.Import.Gpkg, cli.Import.Osmconf)
+		}
+	case "sprites osmc <input>":
+		err := sprites.GenerateOsmcSprites(cli.Sprites.Osmc.Input, cli.Sprites.Osmc.Folder)
+		sigolo.FatalCheck(err)
+	case "contours <input> <output>":
+		err := contours.GenerateContours(cli.Contours.Input, cli.Contours.Output, cli.Contours.Interval, cli.Contours.Index, cli.Contours.Smoothing)
+		sigolo.FatalCheck(err)
+	case "tile-proxy serve <mappings>":
+		slopePalette, err := relief.ParseSlopePalette(cli.TileProxy.Serve.SlopePalette)
+		sigolo.FatalCheck(err)
+		tile_proxy.StartProxy(cli.TileProxy.Serve.Port, cli.TileProxy.Serve.Mappings, cli.TileProxy.CacheFolder, cli.TileProxy.Serve.MaxCacheSize*1024*1024, tile_proxy.EncodingOptions{
+			JpegQuality: cli.TileProxy.Serve.JpegQuality,
+			WebpQuality: cli.TileProxy.Serve.WebpQuality,
+		}, tile_proxy.RemoteTileOptions{
+			NotFoundMaxAge:  cli.TileProxy.Serve.NotFoundMaxAge,
+			MaxAge:          cli.TileProxy.Serve.MaxAge,
+			EndpointMaxAges: cli.TileProxy.Serve.EndpointMaxAge,
+		}, tile_proxy.LocalTileOptions{
+			Hillshade: relief.HillshadeOptions{
+				Azimuth:          cli.TileProxy.Serve.Azimuth,
+				Altitude:         cli.TileProxy.Serve.Altitude,
+				ZFactor:          cli.TileProxy.Serve.ZFactor,
+				Multidirectional: cli.TileProxy.Serve.Multidirectional,
+				SlopeShading:     cli.TileProxy.Serve.SlopeShading,
+			},
+			SlopePalette:         slopePalette,
+			ContourInterval:      cli.TileProxy.Serve.ContourInterval,
+			ContourIndexInterval: cli.TileProxy.Serve.ContourIndex,
+			ContourSmoothing:     cli.TileProxy.Serve.ContourSmoothing,
+		})
+	case "tile-proxy cache prune":
+		err := tile_proxy.PruneCache(cli.TileProxy.CacheFolder, cli.TileProxy.Cache.Prune.MaxSize*1024*1024)
+		sigolo.FatalCheck(err)
 	default:
 		sigolo.Fatal("Unknown command: %v", ctx.Command())
 	}
 }
 
+func exportGeoPackage(inputFile string, outputFile string, configFile string) {
+	sigolo.Info("Convert %s into GeoPackage file %s", inputFile, outputFile)
+	err := geopackage.Export(inputFile, outputFile, configFile)
+	sigolo.FatalCheck(err)
+}
+
 func readCliArgs() *kong.Context {
 	ctx := kong.Parse(
 		&cli,
 		kong.Name("Outdoor and hiking map utility"),
 		kong.Description("A CLI tool to process the OSM data of the outdoor map and to generate a legend graphic."),
+		kong.Vars{
+			"slopePalette":    relief.DefaultSlopePalette,
+			"downloadBaseUrl": downloader.DefaultBaseUrl,
+		},
 	)
 
 	if cli.Debug {
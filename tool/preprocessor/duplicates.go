@@ -0,0 +1,244 @@
+package preprocessor
+
+import (
+	"github.com/hauke96/sigolo"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/osm"
+	"math"
+	"slices"
+)
+
+const (
+	duplicatePriorityNode = "node"
+	duplicatePriorityArea = "area"
+
+	// Size of the grid cells in degrees used to find POI nodes near an area.
+	poiNodeGridCellSize = 0.01
+	metersPerDegree     = 111_320.0
+)
+
+var (
+	// Tagged input nodes which might describe the same feature as an area, grouped by grid cells.
+	poiNodes = map[poiNodeGridCell][]*poiNode{}
+	// Label nodes of areas together with the geometry of the area.
+	poiAreas []*poiArea
+	// Input nodes that are duplicates of an area together with the keys of the duplicate kinds, which are removed.
+	duplicatePoiNodes = map[osm.NodeID][]string{}
+)
+
+type poiNodeGridCell struct {
+	x int
+	y int
+}
+
+type poiNode struct {
+	id       osm.NodeID
+	location orb.Point
+	// Only the tags of the keys in the duplicates config
+	tags osm.Tags
+}
+
+type poiArea struct {
+	labelNode *osm.Node
+	geometry  orb.Geometry
+}
+
+func isDuplicateDetectionEnabled() bool {
+	return activeRules.Duplicates != nil && len(activeRules.Duplicates.Keys) != 0
+}
+
+// collectPoiNode remembers the given node, if it has one of the keys of the duplicates config. The tags of the node
+// must already be changed by the rules.
+func collectPoiNode(node *osm.Node) {
+	if !isDuplicateDetectionEnabled() {
+		return
+	}
+
+	var tags osm.Tags
+	for _, key := range activeRules.Duplicates.Keys {
+		if value := node.Tags.Find(key); value != "" {
+			tags = append(tags, osm.Tag{Key: key, Value: value})
+		}
+	}
+	if len(tags) == 0 {
+		return
+	}
+
+	cell := toPoiNodeGridCell(node.Point())
+	poiNodes[cell] = append(poiNodes[cell], &poiNode{
+		id:       node.ID,
+		location: node.Point(),
+		tags:     tags,
+	})
+}
+
+// addPoiArea remembers the given label node and the area it was created for to find duplicates later on.
+func addPoiArea(labelNode *osm.Node, area orb.Geometry) {
+	if !isDuplicateDetectionEnabled() {
+		return
+	}
+
+	poiAreas = append(poiAreas, &poiArea{
+		labelNode: labelNode,
+		geometry:  area,
+	})
+}
+
+// removeDuplicatePois finds label nodes and tagged nodes of the same kind (see duplicatesConfig.Keys), where the node is
+// inside or near the area of the label node. For example a node tagged with "tourism=wilderness_hut" within a building
+// tagged the same way. Depending on the configured priority, either the label node is removed or the tag of this kind is
+// removed from the input node (see removeTagsOfDuplicatePoiNode). The input node itself is kept, since it might be part of a way.
+func removeDuplicatePois() {
+	if !isDuplicateDetectionEnabled() {
+		return
+	}
+
+	config := activeRules.Duplicates
+	duplicateLabelNodes := map[osm.NodeID]bool{}
+
+	for _, area := range poiAreas {
+		key, value := getPoiKind(area.labelNode.Tags)
+		if key == "" {
+			continue
+		}
+
+		for _, node := range findPoiNodesNearArea(area.geometry, config.Distance) {
+			if node.tags.Find(key) != value {
+				continue
+			}
+
+			source := area.labelNode.Tags.Find(sourceOsmTypeKey) + "/" + area.labelNode.Tags.Find(sourceOsmIdKey)
+			if config.Priority == duplicatePriorityNode {
+				sigolo.Debug("Drop label node %d of %s (%s=%s), which is a duplicate of node %d", area.labelNode.ID, source, key, value, node.id)
+				duplicateLabelNodes[area.labelNode.ID] = true
+				break
+			}
+
+			sigolo.Debug("Drop tag %s=%s of node %d, which is a duplicate of %s", key, value, node.id, source)
+			if !slices.Contains(duplicatePoiNodes[node.id], key) {
+				duplicatePoiNodes[node.id] = append(duplicatePoiNodes[node.id], key)
+			}
+		}
+	}
+
+	if len(duplicateLabelNodes) > 0 {
+		var remainingNodes []*osm.Node
+		for _, node := range generatedNodes {
+			if !duplicateLabelNodes[node.ID] {
+				remainingNodes = append(remainingNodes, node)
+			}
+		}
+		generatedNodes = remainingNodes
+	}
+
+	if config.Priority == duplicatePriorityNode {
+		sigolo.Info("Removed %d label nodes of areas, which are duplicates of nodes (see debug log for details)", len(duplicateLabelNodes))
+	} else {
+		sigolo.Info("Removed tags of %d nodes, which are duplicates of areas (see debug log for details)", len(duplicatePoiNodes))
+	}
+	poiNodes = map[poiNodeGridCell][]*poiNode{}
+	poiAreas = nil
+}
+
+// removeTagsOfDuplicatePoiNode removes the tags of the duplicate kinds from the given node, if removeDuplicatePois
+// determined it to be a duplicate of an area. All other tags (e.g. the name or a different feature on the same node) are
+// kept.
+func removeTagsOfDuplicatePoiNode(node *osm.Node) {
+	keys := duplicatePoiNodes[node.ID]
+	if len(keys) == 0 {
+		return
+	}
+
+	var remainingTags osm.Tags
+	for _, tag := range node.Tags {
+		if !slices.Contains(keys, tag.Key) {
+			remainingTags = append(remainingTags, tag)
+		}
+	}
+	node.Tags = remainingTags
+}
+
+// getPoiKind returns the first tag of the given tags with a key of the duplicates config.
+func getPoiKind(tags osm.Tags) (string, string) {
+	for _, key := range activeRules.Duplicates.Keys {
+		if value := tags.Find(key); value != "" {
+			return key, value
+		}
+	}
+	return "", ""
+}
+
+// findPoiNodesNearArea returns all collected POI nodes within the given area or with at most the given distance in
+// meters to it.
+func findPoiNodesNearArea(area orb.Geometry, distance float64) []*poiNode {
+	bound := area.Bound()
+	latDistance := distance / metersPerDegree
+	lonDistance := latDistance / math.Cos(bound.Center().Lat()*math.Pi/180)
+	minCell := toPoiNodeGridCell(orb.Point{bound.Min.Lon() - lonDistance, bound.Min.Lat() - latDistance})
+	maxCell := toPoiNodeGridCell(orb.Point{bound.Max.Lon() + lonDistance, bound.Max.Lat() + latDistance})
+
+	var result []*poiNode
+	for x := minCell.x; x <= maxCell.x; x++ {
+		for y := minCell.y; y <= maxCell.y; y++ {
+			for _, node := range poiNodes[poiNodeGridCell{x, y}] {
+				if getDistanceToArea(area, node.location) <= distance {
+					result = append(result, node)
+				}
+			}
+		}
+	}
+	return result
+}
+
+func toPoiNodeGridCell(point orb.Point) poiNodeGridCell {
+	return poiNodeGridCell{
+		x: int(math.Floor(point.Lon() / poiNodeGridCellSize)),
+		y: int(math.Floor(point.Lat() / poiNodeGridCellSize)),
+	}
+}
+
+// getDistanceToArea returns the approximate distance in meters between the given point and the outline of the given
+// area. The distance is zero for points within the area.
+func getDistanceToArea(area orb.Geometry, point orb.Point) float64 {
+	switch a := area.(type) {
+	case orb.Polygon:
+		if planar.PolygonContains(a, point) {
+			return 0
+		}
+	case orb.MultiPolygon:
+		if planar.MultiPolygonContains(a, point) {
+			return 0
+		}
+	}
+
+	// Scale the longitude according to the latitude, so that distances in both directions are comparable.
+	scale := math.Cos(point.Lat() * math.Pi / 180)
+	minDistance := math.Inf(1)
+	forEachLine(area, func(line orb.LineString) {
+		for i := 1; i < len(line); i++ {
+			a := orb.Point{line[i-1].Lon() * scale, line[i-1].Lat()}
+			b := orb.Point{line[i].Lon() * scale, line[i].Lat()}
+			distance := planar.DistanceFromSegment(a, b, orb.Point{point.Lon() * scale, point.Lat()})
+			minDistance = math.Min(minDistance, distance)
+		}
+	})
+
+	return minDistance * metersPerDegree
+}
+
+// forEachLine calls the given function for the line string or each ring of the given geometry.
+func forEachLine(geometry orb.Geometry, handle func(line orb.LineString)) {
+	switch g := geometry.(type) {
+	case orb.LineString:
+		handle(g)
+	case orb.Polygon:
+		for _, ring := range g {
+			handle(orb.LineString(ring))
+		}
+	case orb.MultiPolygon:
+		for _, polygon := range g {
+			forEachLine(polygon, handle)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package preprocessor
+
+import (
+	"github.com/paulmach/osm"
+	"testing"
+)
+
+func setupDuplicateTest(t *testing.T, priority string) *osm.Way {
+	rules, err := parseRules([]byte(`
+rules:
+  - types: [ way ]
+    match: amenity
+    actions:
+      - emit: centroid
+duplicates:
+  keys: [ amenity, tourism ]
+  distance: 50
+  priority: ` + priority))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousRules := activeRules
+	activeRules = rules
+	t.Cleanup(func() {
+		activeRules = previousRules
+	})
+
+	resetState()
+	// Square of roughly 670 m * 1100 m
+	for _, node := range []*osm.Node{
+		{ID: 1, Lat: 53.00, Lon: 10.00},
+		{ID: 2, Lat: 53.00, Lon: 10.01},
+		{ID: 3, Lat: 53.01, Lon: 10.01},
+		{ID: 4, Lat: 53.01, Lon: 10.00},
+	} {
+		inputNodes[node.ID] = node
+	}
+
+	return &osm.Way{ID: 10, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 1}}, Tags: osm.Tags{
+		{Key: "amenity", Value: "shelter"},
+	}}
+}
+
+func addPoiNodeForTest(node *osm.Node) {
+	inputNodes[node.ID] = node
+	handleNode(node)
+}
+
+func TestDuplicates_nodeInsideArea(t *testing.T) {
+	way := setupDuplicateTest(t, duplicatePriorityNode)
+	addPoiNodeForTest(&osm.Node{ID: 5, Lat: 53.005, Lon: 10.005, Tags: osm.Tags{{Key: "amenity", Value: "shelter"}}})
+	handleWay(way)
+
+	// Act
+	removeDuplicatePois()
+
+	// Assert
+	if len(generatedNodes) != 0 {
+		t.Errorf("Expected label node to be removed but got %#v", generatedNodes)
+	}
+	if inputNodes[5].Tags.Find("amenity") != "shelter" {
+		t.Errorf("Node should keep its tags: %#v", inputNodes[5].Tags)
+	}
+}
+
+func TestDuplicates_nodeNearArea(t *testing.T) {
+	way := setupDuplicateTest(t, duplicatePriorityNode)
+	// Roughly 33 m east of the area
+	addPoiNodeForTest(&osm.Node{ID: 5, Lat: 53.005, Lon: 10.0105, Tags: osm.Tags{{Key: "amenity", Value: "shelter"}}})
+	// Roughly 110 m north of the area
+	addPoiNodeForTest(&osm.Node{ID: 6, Lat: 53.011, Lon: 10.005, Tags: osm.Tags{{Key: "amenity", Value: "shelter"}}})
+	handleWay(way)
+
+	// Act
+	removeDuplicatePois()
+
+	// Assert
+	if len(generatedNodes) != 0 {
+		t.Errorf("Expected label node to be removed but got %#v", generatedNodes)
+	}
+}
+
+func TestDuplicates_differentKind(t *testing.T) {
+	way := setupDuplicateTest(t, duplicatePriorityNode)
+	addPoiNodeForTest(&osm.Node{ID: 5, Lat: 53.005, Lon: 10.005, Tags: osm.Tags{{Key: "amenity", Value: "bench"}}})
+	// Roughly 110 m north of the area
+	addPoiNodeForTest(&osm.Node{ID: 6, Lat: 53.011, Lon: 10.005, Tags: osm.Tags{{Key: "amenity", Value: "shelter"}}})
+	handleWay(way)
+
+	// Act
+	removeDuplicatePois()
+
+	// Assert
+	if len(generatedNodes) != 1 {
+		t.Errorf("Expected label node to be kept but got %#v", generatedNodes)
+	}
+}
+
+func TestDuplicates_priorityArea(t *testing.T) {
+	way := setupDuplicateTest(t, duplicatePriorityArea)
+	addPoiNodeForTest(&osm.Node{ID: 5, Lat: 53.005, Lon: 10.005, Tags: osm.Tags{{Key: "amenity", Value: "shelter"}}})
+	handleWay(way)
+
+	// Act
+	removeDuplicatePois()
+	removeTagsOfDuplicatePoiNode(inputNodes[5])
+
+	// Assert
+	if len(generatedNodes) != 1 || generatedNodes[0].Tags.Find("amenity") != "shelter" {
+		t.Errorf("Expected label node to be kept but got %#v", generatedNodes)
+	}
+	if len(inputNodes[5].Tags) != 0 {
+		t.Errorf("Expected tags of node to be removed but got %#v", inputNodes[5].Tags)
+	}
+}
+
+func TestDuplicates_priorityAreaKeepsOtherTags(t *testing.T) {
+	way := setupDuplicateTest(t, duplicatePriorityArea)
+	// A shelter, which is also a viewpoint
+	addPoiNodeForTest(&osm.Node{ID: 5, Lat: 53.005, Lon: 10.005, Tags: osm.Tags{
+		{Key: "amenity", Value: "shelter"},
+		{Key: "tourism", Value: "viewpoint"},
+		{Key: "name", Value: "Hut"},
+		{Key: "ele", Value: "1234"},
+	}})
+	handleWay(way)
+
+	// Act
+	removeDuplicatePois()
+	removeTagsOfDuplicatePoiNode(inputNodes[5])
+
+	// Assert
+	tags := inputNodes[5].Tags
+	if len(tags) != 3 || tags.Find("amenity") != "" {
+		t.Errorf("Expected only the amenity tag to be removed but got %#v", tags)
+	}
+	if tags.Find("tourism") != "viewpoint" || tags.Find("name") != "Hut" || tags.Find("ele") != "1234" {
+		t.Errorf("Expected other tags of node to be kept but got %#v", tags)
+	}
+}
+
+func TestDuplicates_invalidConfig(t *testing.T) {
+	invalidRules := []string{
+		`duplicates: { keys: [ amenity ], priority: way }`,
+		`duplicates: { keys: [ amenity ], distance: -1, priority: node }`,
+	}
+
+	for _, rulesFileContent := range invalidRules {
+		_, err := parseRules([]byte(rulesFileContent))
+		if err == nil {
+			t.Errorf("Expected error for rules %s", rulesFileContent)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package preprocessor
+
+import (
+	"github.com/hauke96/sigolo"
+	"github.com/paulmach/osm"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// Generated objects get IDs derived from the object they are generated for (the source object), so that the IDs
+	// are the same in each run and don't change when unrelated data changes. The ID has the form
+	// "<type digit><source ID with 10 digits><index digit>", e.g. 100000001231 for the second object generated for
+	// way 123. The type digit is 1 for ways and 2 for relations. IDs of input objects must be below this offset.
+	generatedIdOffset int64 = 100_000_000_000
+	// Maximum number of objects generated for one source object
+	maxGeneratedObjectsPerSource = 10
+
+	// Keys of the tags on generated objects referring to the object they are generated for, e.g. to open the original
+	// object in an editor.
+	sourceOsmTypeKey = "source:osm_type"
+	sourceOsmIdKey   = "source:osm_id"
+)
+
+var (
+	// The highest ID of all input objects. This is used to make sure that IDs of generated objects are not already in use.
+	highestInputId int64 = 0
+	// Number of objects generated for each source object so far, used as index within the generated IDs.
+	generatedObjectCounts = map[osm.ObjectID]int{}
+	// The timestamp of all generated objects. When not set, generated objects get the timestamp of their source object.
+	generatedObjectTimestamp time.Time
+)
+
+// SetTimestamp sets the timestamp of all generated objects. By default, the timestamp of the source object is used.
+func SetTimestamp(timestamp time.Time) {
+	generatedObjectTimestamp = timestamp.UTC().Truncate(time.Second)
+}
+
+// addNode to the list of generated nodes
+func addNode(originLon float64, originLat float64, tags []osm.Tag, source osm.Object) *osm.Node {
+	node := osm.Node{
+		Version:   1,
+		ID:        osm.NodeID(generateId(source)),
+		Timestamp: getGeneratedObjectTimestamp(source),
+		Tags:      addSourceTags(tags, source),
+		Lon:       originLon,
+		Lat:       originLat,
+	}
+	generatedNodes = append(generatedNodes, &node)
+	return &node
+}
+
+// addWay to the list of generated ways
+func addWay(nodes osm.WayNodes, tags osm.Tags, source osm.Object) {
+	way := &osm.Way{
+		ID:        osm.WayID(generateId(source)),
+		Version:   1,
+		Timestamp: getGeneratedObjectTimestamp(source),
+		Nodes:     nodes,
+		Tags:      addSourceTags(tags, source),
+	}
+	generatedWays = append(generatedWays, way)
+}
+
+// generateId derives the ID of a new object from the given source object, see generatedIdOffset.
+func generateId(source osm.Object) int64 {
+	objectId := source.ObjectID()
+
+	index := generatedObjectCounts[objectId]
+	if index >= maxGeneratedObjectsPerSource {
+		sigolo.Fatal("Too many objects generated for %s, at most %d are possible", objectId, maxGeneratedObjectsPerSource)
+	}
+	generatedObjectCounts[objectId]++
+
+	if objectId.Ref() >= generatedIdOffset/maxGeneratedObjectsPerSource {
+		sigolo.Fatal("Cannot generate objects for %s, only IDs below %d are supported", objectId, generatedIdOffset/maxGeneratedObjectsPerSource)
+	}
+
+	var typeDigit int64
+	switch objectId.Type() {
+	case osm.TypeWay:
+		typeDigit = 1
+	case osm.TypeRelation:
+		typeDigit = 2
+	default:
+		sigolo.Fatal("Cannot generate objects for %s, only ways and relations are supported", objectId)
+	}
+
+	return typeDigit*generatedIdOffset + objectId.Ref()*maxGeneratedObjectsPerSource + int64(index)
+}
+
+// addSourceTags adds the type and ID of the given source object as tags.
+func addSourceTags(tags osm.Tags, source osm.Object) osm.Tags {
+	objectId := source.ObjectID()
+	tags = setTag(tags, sourceOsmIdKey, strconv.FormatInt(objectId.Ref(), 10))
+	tags = setTag(tags, sourceOsmTypeKey, string(objectId.Type()))
+	return tags
+}
+
+func getGeneratedObjectTimestamp(source osm.Object) time.Time {
+	if !generatedObjectTimestamp.IsZero() {
+		return generatedObjectTimestamp
+	}
+
+	switch sourceObj := source.(type) {
+	case *osm.Node:
+		return sourceObj.Timestamp
+	case *osm.Way:
+		return sourceObj.Timestamp
+	case *osm.Relation:
+		return sourceObj.Timestamp
+	}
+	return time.Time{}
+}
+
+// sortGeneratedObjects sorts the generated objects by their IDs, so that they can be written in the order required by
+// OSM-PBF files. This must be called after all input objects have been read, because it also verifies that the input
+// doesn't contain IDs reserved for generated objects (e.g. because the input has already been preprocessed).
+func sortGeneratedObjects() {
+	if highestInputId >= generatedIdOffset {
+		sigolo.Fatal("The input contains the ID %d, but IDs from %d on are reserved for generated objects. Was the input already preprocessed?", highestInputId, generatedIdOffset)
+	}
+
+	sort.Slice(generatedNodes, func(i, j int) bool {
+		return generatedNodes[i].ID < generatedNodes[j].ID
+	})
+	sort.Slice(generatedWays, func(i, j int) bool {
+		return generatedWays[i].ID < generatedWays[j].ID
+	})
+}
+
+func updateHighestInputId(osmObjId int64) {
+	if osmObjId > highestInputId {
+		highestInputId = osmObjId
+	}
+}
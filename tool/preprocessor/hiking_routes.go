@@ -0,0 +1,218 @@
+package preprocessor
+
+import (
+	"github.com/hauke96/sigolo"
+	"github.com/paulmach/osm"
+	"sort"
+	"strings"
+	"tool/common"
+)
+
+var (
+	// All ways for which addHikingRouteNamesToWay was called and which are member of a hiking route.
+	hikingRouteWaysFound = map[osm.WayID]bool{}
+
+	// Ranks of the values of the "network" tag of hiking routes. Higher ranks are more important, unknown networks have
+	// rank 0.
+	hikingRouteNetworkRanks = map[string]int{
+		"lwn": 1,
+		"rwn": 2,
+		"nwn": 3,
+		"iwn": 4,
+	}
+)
+
+// collectHikingRouteMemberships stores the way and relation memberships of the given relation, if it's a hiking route.
+// This does not depend on the members being already read, so the input data doesn't need to be sorted.
+func collectHikingRouteMemberships(relation *osm.Relation) {
+	if !common.IsHikingRoute(relation) {
+		return
+	}
+
+	for _, member := range relation.Members {
+		switch member.Type {
+		case osm.TypeWay:
+			// Member ways do not contain their nodes here, only a ref-ID to the actual way
+			wayId := osm.WayID(member.Ref)
+			wayRelationMapping[wayId] = append(wayRelationMapping[wayId], relation.ID)
+		case osm.TypeRelation:
+			childId := osm.RelationID(member.Ref)
+			relationParentMapping[childId] = append(relationParentMapping[childId], relation.ID)
+		}
+	}
+}
+
+// addHikingRouteNamesToWay adds hiking route tags to the given way, if it's part of any hiking route relation. The
+// names of the routes directly containing the way (e.g. the stage of a trail) are stored in "hiking_route_names", the
+// names of all routes containing these routes (e.g. the long-distance trail) in "hiking_route_parent_names". See
+// addHikingRouteClassificationToWay for further tags.
+func addHikingRouteNamesToWay(way *osm.Way) {
+	relationIds, ok := wayRelationMapping[way.ID]
+	if !ok {
+		return
+	}
+	hikingRouteWaysFound[way.ID] = true
+
+	var routeNames []string
+	for _, relationId := range relationIds {
+		routeNames = appendRouteName(routeNames, inputRelations[relationId])
+	}
+
+	var parentRouteNames []string
+	parentIds := getParentRoutes(relationIds)
+	for _, parentId := range parentIds {
+		parentRouteNames = appendRouteName(parentRouteNames, inputRelations[parentId])
+	}
+
+	if len(routeNames) == 0 && len(parentRouteNames) == 0 {
+		// Neither name nor ref on any route -> cannot set any name on way
+		return
+	}
+
+	if len(routeNames) != 0 {
+		way.Tags = append(way.Tags, osm.Tag{Key: "hiking_route_names", Value: strings.Join(routeNames, ", ")})
+	}
+	if len(parentRouteNames) != 0 {
+		way.Tags = append(way.Tags, osm.Tag{Key: "hiking_route_parent_names", Value: strings.Join(parentRouteNames, ", ")})
+	}
+	way.Tags = append(way.Tags, osm.Tag{Key: "hiking_route", Value: "yes"})
+
+	addHikingRouteClassificationToWay(way, append(append([]osm.RelationID{}, relationIds...), parentIds...))
+}
+
+// addHikingRouteClassificationToWay adds tags describing the importance and waymarks of the given routes of the way:
+//   - "hiking_route_network": The highest network level (iwn, nwn, rwn, lwn) of all routes
+//   - "hiking_route_refs": The refs of all routes without duplicates separated by ";", most important route first
+//   - "hiking_route_symbol", "hiking_route_colour" and "hiking_route_operator": The "osmc:symbol", "colour" and
+//     "operator" of the most important route having such a tag
+//
+// Routes with equal network level keep their order, so direct routes of the way are preferred over parent routes.
+func addHikingRouteClassificationToWay(way *osm.Way, relationIds []osm.RelationID) {
+	var routes []*osm.Relation
+	for _, relationId := range relationIds {
+		relation := inputRelations[relationId]
+		if relation != nil && common.IsHikingRoute(relation) {
+			routes = append(routes, relation)
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return hikingRouteNetworkRanks[routes[i].Tags.Find("network")] > hikingRouteNetworkRanks[routes[j].Tags.Find("network")]
+	})
+
+	if len(routes) == 0 {
+		return
+	}
+
+	network := routes[0].Tags.Find("network")
+	if hikingRouteNetworkRanks[network] > 0 {
+		way.Tags = append(way.Tags, osm.Tag{Key: "hiking_route_network", Value: network})
+	}
+
+	var refs []string
+	for _, route := range routes {
+		ref := route.Tags.Find("ref")
+		if ref != "" && !containsString(refs, ref) {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) != 0 {
+		way.Tags = append(way.Tags, osm.Tag{Key: "hiking_route_refs", Value: strings.Join(refs, ";")})
+	}
+
+	routeTagKeys := map[string]string{
+		"osmc:symbol": "hiking_route_symbol",
+		"colour":      "hiking_route_colour",
+		"operator":    "hiking_route_operator",
+	}
+	for _, routeTagKey := range sortedKeys(routeTagKeys) {
+		for _, route := range routes {
+			value := route.Tags.Find(routeTagKey)
+			if value != "" {
+				way.Tags = append(way.Tags, osm.Tag{Key: routeTagKeys[routeTagKey], Value: value})
+				break
+			}
+		}
+	}
+}
+
+// getParentRoutes returns all routes containing the given routes, either directly or via other routes. Each route is
+// only returned once and the given routes are not returned, so cyclic memberships are no problem.
+func getParentRoutes(relationIds []osm.RelationID) []osm.RelationID {
+	visited := map[osm.RelationID]bool{}
+	for _, relationId := range relationIds {
+		visited[relationId] = true
+	}
+
+	var parentIds []osm.RelationID
+	relationsToCheck := append([]osm.RelationID{}, relationIds...)
+	for len(relationsToCheck) > 0 {
+		relationId := relationsToCheck[0]
+		relationsToCheck = relationsToCheck[1:]
+
+		for _, parentId := range relationParentMapping[relationId] {
+			if visited[parentId] {
+				continue
+			}
+			visited[parentId] = true
+			parentIds = append(parentIds, parentId)
+			relationsToCheck = append(relationsToCheck, parentId)
+		}
+	}
+
+	return parentIds
+}
+
+// appendRouteName adds the name of the given route of the form "name (ref)" to the given list, unless the route has
+// neither name nor ref or the name is already in the list.
+func appendRouteName(routeNames []string, relation *osm.Relation) []string {
+	if relation == nil || !common.IsHikingRoute(relation) {
+		return routeNames
+	}
+
+	routeName := relation.Tags.Find("name")
+	routeRef := relation.Tags.Find("ref")
+	var combinedRouteName string
+	if routeName != "" {
+		combinedRouteName = routeName
+		if routeRef != "" {
+			combinedRouteName += " (" + routeRef + ")"
+		}
+	} else if routeRef != "" {
+		combinedRouteName = routeRef
+	} else {
+		return routeNames
+	}
+
+	for _, existingName := range routeNames {
+		if existingName == combinedRouteName {
+			return routeNames
+		}
+	}
+	return append(routeNames, combinedRouteName)
+}
+
+// reportMissingHikingRouteMembers logs how many member ways of hiking routes are not part of the input data. This
+// usually happens for routes crossing the border of the extract.
+func reportMissingHikingRouteMembers() {
+	numberOfMembers := 0
+	missingMembersPerRoute := map[osm.RelationID]int{}
+	for wayId, relationIds := range wayRelationMapping {
+		numberOfMembers += len(relationIds)
+		if hikingRouteWaysFound[wayId] {
+			continue
+		}
+		for _, relationId := range relationIds {
+			missingMembersPerRoute[relationId]++
+		}
+	}
+
+	numberOfMissingMembers := 0
+	for relationId, missingMembers := range missingMembersPerRoute {
+		numberOfMissingMembers += missingMembers
+		sigolo.Debug("Hiking route %d (%s) has %d member ways missing in the input data", relationId, inputRelations[relationId].Tags.Find("name"), missingMembers)
+	}
+
+	if numberOfMissingMembers > 0 {
+		sigolo.Info("%d of %d hiking route member ways of %d routes are missing in the input data (e.g. routes cut at the border of the extract)", numberOfMissingMembers, numberOfMembers, len(missingMembersPerRoute))
+	}
+}
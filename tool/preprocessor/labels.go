@@ -0,0 +1,117 @@
+package preprocessor
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/osm"
+	"math"
+	"strconv"
+	"tool/common"
+)
+
+// The key of the tag on generated label nodes containing the size of the area in square meters.
+const areaSizeKey = "area_size"
+
+// addLabelNode adds a generated node at the label point of the given area (see getLabelPoint). The area size is stored
+// as tag, unless it's zero (e.g. for unclosed ways). The ID and timestamp of the node are derived from the given source
+// object.
+func addLabelNode(area orb.Geometry, tags osm.Tags, source osm.Object) {
+	labelPoint, areaSize := getLabelPoint(area)
+	if areaSize > 0 {
+		tags = setTag(tags, areaSizeKey, strconv.FormatInt(int64(math.Round(areaSize)), 10))
+	}
+	labelNode := addNode(labelPoint.Lon(), labelPoint.Lat(), tags, source)
+	addPoiArea(labelNode, area)
+}
+
+// getGeometryOfWay returns a polygon for closed ways and a line string for unclosed ways. Nodes without known location
+// (e.g. because they are outside the extract) are ignored. False is returned if no node location is known.
+func getGeometryOfWay(w *osm.Way) (orb.Geometry, bool) {
+	geometry := make(orb.LineString, 0, len(w.Nodes))
+	for _, n := range w.Nodes {
+		if location, ok := nodeLocations.get(n.ID); ok {
+			geometry = append(geometry, location)
+		}
+	}
+
+	if len(geometry) == 0 {
+		return nil, false
+	}
+
+	if len(geometry) >= 4 && geometry[0] == geometry[len(geometry)-1] {
+		return orb.Polygon{orb.Ring(geometry)}, true
+	}
+
+	return geometry, true
+}
+
+// getLabelPoint determines the point a label or POI of the given geometry should be placed at. For polygons this is
+// the pole of inaccessibility, which is always inside the area. For line strings, the point in the middle of the line
+// is used. The area size in square meters is returned as well and is zero for line strings.
+func getLabelPoint(geometry orb.Geometry) (orb.Point, float64) {
+	switch g := geometry.(type) {
+	case orb.Polygon:
+		return getLabelPointOfPolygon(g), geo.Area(g)
+	case orb.MultiPolygon:
+		return getLabelPointOfMultipolygon(g)
+	case orb.LineString:
+		return getMiddleOfLine(g), 0
+	}
+	return geometry.Bound().Center(), 0
+}
+
+// getLabelPointOfMultipolygon returns the pole of inaccessibility of the largest polygon and the total area size in
+// square meters.
+func getLabelPointOfMultipolygon(multiPolygon orb.MultiPolygon) (orb.Point, float64) {
+	var largestPolygon orb.Polygon
+	largestArea := 0.0
+	totalArea := 0.0
+	for _, polygon := range multiPolygon {
+		area := geo.Area(polygon)
+		totalArea += area
+		if largestPolygon == nil || area > largestArea {
+			largestPolygon = polygon
+			largestArea = area
+		}
+	}
+
+	return getLabelPointOfPolygon(largestPolygon), totalArea
+}
+
+// getLabelPointOfPolygon determines the pole of inaccessibility of the given polygon. The longitude is scaled according
+// to the latitude of the polygon, so that distances in both directions are comparable.
+func getLabelPointOfPolygon(polygon orb.Polygon) orb.Point {
+	bound := polygon.Bound()
+	scale := math.Cos(bound.Center().Lat() * math.Pi / 180)
+
+	projectedPolygon := make(orb.Polygon, len(polygon))
+	for i, ring := range polygon {
+		projectedPolygon[i] = make(orb.Ring, len(ring))
+		for j, point := range ring {
+			projectedPolygon[i][j] = orb.Point{point.Lon() * scale, point.Lat()}
+		}
+	}
+
+	projectedBound := projectedPolygon.Bound()
+	precision := math.Max(projectedBound.Max.X()-projectedBound.Min.X(), projectedBound.Max.Y()-projectedBound.Min.Y()) / 1000
+	labelPoint := common.PoleOfInaccessibility(projectedPolygon, precision)
+
+	return orb.Point{labelPoint.X() / scale, labelPoint.Y()}
+}
+
+// getMiddleOfLine returns the point at half the length of the given line.
+func getMiddleOfLine(line orb.LineString) orb.Point {
+	remainingLength := planar.Length(line) / 2
+	for i := 1; i < len(line); i++ {
+		segmentLength := planar.Distance(line[i-1], line[i])
+		if segmentLength >= remainingLength && segmentLength > 0 {
+			return orb.Point{
+				line[i-1].Lon() + (line[i].Lon()-line[i-1].Lon())*remainingLength/segmentLength,
+				line[i-1].Lat() + (line[i].Lat()-line[i-1].Lat())*remainingLength/segmentLength,
+			}
+		}
+		remainingLength -= segmentLength
+	}
+	return line[len(line)-1]
+}
@@ -0,0 +1,71 @@
+package preprocessor
+
+import (
+	"github.com/paulmach/osm"
+	"testing"
+)
+
+func TestLabelPoint_unclosedWay(t *testing.T) {
+	resetState()
+	inputNodes = map[osm.NodeID]*osm.Node{
+		1: {ID: 1, Lat: 53.0, Lon: 10.0},
+		2: {ID: 2, Lat: 53.0, Lon: 10.2},
+		3: {ID: 3, Lat: 53.2, Lon: 10.2},
+	}
+	way := &osm.Way{ID: 10, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}}}
+
+	geometry, ok := getGeometryOfWay(way)
+	if !ok {
+		t.Fatalf("Expected geometry")
+	}
+
+	point, areaSize := getLabelPoint(geometry)
+
+	if point.Lon() < 10.199 || point.Lat() > 53.001 {
+		t.Errorf("Expected point at corner of the line but was %v", point)
+	}
+	if areaSize != 0 {
+		t.Errorf("Expected no area size but was %f", areaSize)
+	}
+}
+
+func TestLabelPoint_concaveWay(t *testing.T) {
+	resetState()
+	// U-shaped area
+	inputNodes = map[osm.NodeID]*osm.Node{
+		1: {ID: 1, Lat: 53.0, Lon: 10.0},
+		2: {ID: 2, Lat: 53.0, Lon: 10.1},
+		3: {ID: 3, Lat: 53.1, Lon: 10.1},
+		4: {ID: 4, Lat: 53.1, Lon: 10.08},
+		5: {ID: 5, Lat: 53.02, Lon: 10.08},
+		6: {ID: 6, Lat: 53.02, Lon: 10.02},
+		7: {ID: 7, Lat: 53.1, Lon: 10.02},
+		8: {ID: 8, Lat: 53.1, Lon: 10.0},
+	}
+	way := &osm.Way{ID: 10, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}, {ID: 6}, {ID: 7}, {ID: 8}, {ID: 1}}}
+
+	processWay(way, true, false)
+
+	if len(generatedNodes) != 0 {
+		t.Fatalf("Untagged way should not create label node")
+	}
+
+	way.Tags = osm.Tags{{Key: "amenity", Value: "parking"}}
+	processWay(way, true, false)
+
+	if len(generatedNodes) != 1 {
+		t.Fatalf("Expected 1 generated node but got %d", len(generatedNodes))
+	}
+	node := generatedNodes[0]
+	isInLeftPart := node.Lon > 10.0 && node.Lon < 10.02 && node.Lat > 53.0 && node.Lat < 53.1
+	isInRightPart := node.Lon > 10.08 && node.Lon < 10.1 && node.Lat > 53.0 && node.Lat < 53.1
+	isInBottomPart := node.Lon > 10.0 && node.Lon < 10.1 && node.Lat > 53.0 && node.Lat < 53.02
+	if !isInLeftPart && !isInRightPart && !isInBottomPart {
+		t.Errorf("Label node outside of the area: %f, %f", node.Lon, node.Lat)
+	}
+	// Roughly 6.7 km * 11.1 km - 4.0 km * 8.9 km
+	areaSize := node.Tags.Find(areaSizeKey)
+	if len(areaSize) != 8 || areaSize[0] != '3' {
+		t.Errorf("Wrong area size: %s", areaSize)
+	}
+}
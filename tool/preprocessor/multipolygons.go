@@ -0,0 +1,94 @@
+package preprocessor
+
+import (
+	"github.com/hauke96/sigolo"
+	"github.com/paulmach/osm"
+	"tool/common"
+)
+
+var (
+	// Objects emitted by rules for multipolygon relations. They are created by createObjectsForMultipolygons after all
+	// member ways have been read.
+	pendingMultipolygonEmits []*multipolygonEmit
+)
+
+type multipolygonEmit struct {
+	relation *osm.Relation
+	tags     osm.Tags
+}
+
+func isMultipolygon(relation *osm.Relation) bool {
+	return relation.Tags.Find("type") == "multipolygon"
+}
+
+// addMultipolygonEmit remembers the object emitted for the given relation. Emitted objects of relations other than
+// multipolygons are ignored, since they have no area. The "type" tag is not copied to the emitted object, since e.g. a
+// label node with "type=multipolygon" makes no sense.
+func addMultipolygonEmit(relation *osm.Relation, emitType string, tags osm.Tags) {
+	if emitType != emitCentroid || !isMultipolygon(relation) {
+		return
+	}
+
+	pendingMultipolygonEmits = append(pendingMultipolygonEmits, &multipolygonEmit{
+		// Only the members are needed to determine the geometry and the timestamp for the generated objects
+		relation: &osm.Relation{ID: relation.ID, Timestamp: relation.Timestamp, Members: relation.Members},
+		tags:     removeTag(tags, "type"),
+	})
+}
+
+// getPendingMultipolygonMemberWays returns the IDs of all ways needed by createObjectsForMultipolygons.
+func getPendingMultipolygonMemberWays() map[osm.WayID]bool {
+	wayIds := map[osm.WayID]bool{}
+	for _, pendingEmit := range pendingMultipolygonEmits {
+		for _, member := range pendingEmit.relation.Members {
+			if member.Type == osm.TypeWay {
+				wayIds[osm.WayID(member.Ref)] = true
+			}
+		}
+	}
+	return wayIds
+}
+
+// createObjectsForMultipolygons assembles the geometry of all multipolygon relations with emitted objects and creates a
+// label node inside each of them. The given function provides the member ways of the relations. Multipolygons
+// without closed outer ring (e.g. because they are cut at the border of the extract) are skipped.
+func createObjectsForMultipolygons(getWay func(id osm.WayID) (*osm.Way, bool)) {
+	numberOfInvalidMultipolygons := 0
+
+	for _, pendingEmit := range pendingMultipolygonEmits {
+		var ways []common.MultipolygonWay
+		for _, member := range pendingEmit.relation.Members {
+			if member.Type != osm.TypeWay {
+				continue
+			}
+
+			way, ok := getWay(osm.WayID(member.Ref))
+			if !ok {
+				continue
+			}
+
+			multipolygonWay := common.MultipolygonWay{Role: member.Role}
+			for _, wayNode := range way.Nodes {
+				if location, ok := nodeLocations.get(wayNode.ID); ok {
+					multipolygonWay.NodeIds = append(multipolygonWay.NodeIds, wayNode.ID)
+					multipolygonWay.Points = append(multipolygonWay.Points, location)
+				}
+			}
+			ways = append(ways, multipolygonWay)
+		}
+
+		multiPolygon, err := common.AssembleMultipolygon(ways)
+		if err != nil {
+			sigolo.Debug("Unable to create multipolygon of relation %d: %s", pendingEmit.relation.ID, err.Error())
+			numberOfInvalidMultipolygons++
+			continue
+		}
+
+		addLabelNode(multiPolygon, pendingEmit.tags, pendingEmit.relation)
+	}
+
+	if numberOfInvalidMultipolygons > 0 {
+		sigolo.Info("%d of %d multipolygon relations have no valid geometry (e.g. relations cut at the border of the extract)", numberOfInvalidMultipolygons, len(pendingMultipolygonEmits))
+	}
+	pendingMultipolygonEmits = nil
+}
@@ -0,0 +1,218 @@
+package preprocessor
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/hauke96/sigolo"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"math"
+	"os"
+	"sort"
+)
+
+// nodeLocationStore provides the location of nodes by their ID.
+type nodeLocationStore interface {
+	add(id osm.NodeID, location orb.Point) error
+	get(id osm.NodeID) (orb.Point, bool)
+	close() error
+}
+
+// inputNodesLocationStore uses the inputNodes map, which contains all nodes when processing the data in memory.
+type inputNodesLocationStore struct{}
+
+func (s *inputNodesLocationStore) add(id osm.NodeID, location orb.Point) error {
+	// Nodes are added to the inputNodes map by the caller
+	return nil
+}
+
+func (s *inputNodesLocationStore) get(id osm.NodeID) (orb.Point, bool) {
+	node, ok := inputNodes[id]
+	if !ok {
+		return orb.Point{}, false
+	}
+	return node.Point(), true
+}
+
+func (s *inputNodesLocationStore) close() error {
+	return nil
+}
+
+// memoryNodeLocationStore keeps only the locations of nodes in memory, which is much smaller than whole node objects.
+type memoryNodeLocationStore struct {
+	locations map[osm.NodeID]orb.Point
+}
+
+func newMemoryNodeLocationStore() *memoryNodeLocationStore {
+	return &memoryNodeLocationStore{
+		locations: map[osm.NodeID]orb.Point{},
+	}
+}
+
+func (s *memoryNodeLocationStore) add(id osm.NodeID, location orb.Point) error {
+	s.locations[id] = location
+	return nil
+}
+
+func (s *memoryNodeLocationStore) get(id osm.NodeID) (orb.Point, bool) {
+	location, ok := s.locations[id]
+	return location, ok
+}
+
+func (s *memoryNodeLocationStore) close() error {
+	return nil
+}
+
+const (
+	// Each entry consists of the node ID (int64) and lon and lat as int32 in 1e-7 degrees, just like OSM does.
+	diskNodeLocationEntrySize = 16
+	diskNodeLocationPrecision = 1e7
+	// The index file is read in blocks of this many entries (64 KiB).
+	diskNodeLocationBlockEntries = 4096
+	// Number of blocks kept in memory. Ways usually reference nodes with similar IDs, so most nodes are found in
+	// recently read blocks.
+	diskNodeLocationCachedBlocks = 256
+)
+
+// diskNodeLocationStore writes the node locations into an index file on disk. The nodes must be added sorted by ID, so
+// that the locations can be found using a binary search. The first ID of each block of the file is kept in memory to
+// find the block of a node without reading the file, and recently read blocks are cached.
+type diskNodeLocationStore struct {
+	file       *os.File
+	writer     *bufio.Writer
+	numEntries int64
+	lastId     osm.NodeID
+	buffer     []byte
+	// First node ID of each block of the index file
+	blockFirstIds []osm.NodeID
+	// Cached blocks by their index, the elements of cachedBlockList
+	cachedBlocks map[int]*list.Element
+	// Cached blocks ordered from most to least recently used
+	cachedBlockList *list.List
+}
+
+type diskNodeLocationBlock struct {
+	index   int
+	entries []byte
+}
+
+func newDiskNodeLocationStore(indexFileName string) (*diskNodeLocationStore, error) {
+	file, err := os.Create(indexFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskNodeLocationStore{
+		file:            file,
+		writer:          bufio.NewWriter(file),
+		lastId:          math.MinInt64,
+		buffer:          make([]byte, diskNodeLocationEntrySize),
+		cachedBlocks:    map[int]*list.Element{},
+		cachedBlockList: list.New(),
+	}, nil
+}
+
+func (s *diskNodeLocationStore) add(id osm.NodeID, location orb.Point) error {
+	if s.writer == nil {
+		return errors.New(fmt.Sprintf("Cannot add node %d to node location index, index is already in use for reading", id))
+	}
+	if id <= s.lastId {
+		return errors.New(fmt.Sprintf("Node %d added to node location index after node %d, nodes must be sorted by ID", id, s.lastId))
+	}
+
+	binary.LittleEndian.PutUint64(s.buffer[0:8], uint64(id))
+	binary.LittleEndian.PutUint32(s.buffer[8:12], uint32(int32(math.Round(location.Lon()*diskNodeLocationPrecision))))
+	binary.LittleEndian.PutUint32(s.buffer[12:16], uint32(int32(math.Round(location.Lat()*diskNodeLocationPrecision))))
+	_, err := s.writer.Write(s.buffer)
+	if err != nil {
+		return err
+	}
+
+	if s.numEntries%diskNodeLocationBlockEntries == 0 {
+		s.blockFirstIds = append(s.blockFirstIds, id)
+	}
+	s.lastId = id
+	s.numEntries++
+	return nil
+}
+
+// get returns the location of the given node. Errors writing or reading the index file are fatal, since they would
+// otherwise result in missing geometries.
+func (s *diskNodeLocationStore) get(id osm.NodeID) (orb.Point, bool) {
+	if s.writer != nil {
+		// First read access -> Write all remaining entries to disk before reading them.
+		err := s.writer.Flush()
+		if err != nil {
+			sigolo.Fatal("Error writing node location index %s: %s", s.file.Name(), err.Error())
+		}
+		s.writer = nil
+	}
+
+	// The block containing the node is the last block starting with a lower or equal ID
+	blockIndex := sort.Search(len(s.blockFirstIds), func(i int) bool {
+		return s.blockFirstIds[i] > id
+	}) - 1
+	if blockIndex < 0 {
+		return orb.Point{}, false
+	}
+
+	entries := s.readBlock(blockIndex)
+	numberOfEntries := len(entries) / diskNodeLocationEntrySize
+	index := sort.Search(numberOfEntries, func(i int) bool {
+		return osm.NodeID(binary.LittleEndian.Uint64(entries[i*diskNodeLocationEntrySize:])) >= id
+	})
+	if index >= numberOfEntries {
+		return orb.Point{}, false
+	}
+
+	entry := entries[index*diskNodeLocationEntrySize : (index+1)*diskNodeLocationEntrySize]
+	if osm.NodeID(binary.LittleEndian.Uint64(entry[0:8])) != id {
+		return orb.Point{}, false
+	}
+
+	lon := float64(int32(binary.LittleEndian.Uint32(entry[8:12]))) / diskNodeLocationPrecision
+	lat := float64(int32(binary.LittleEndian.Uint32(entry[12:16]))) / diskNodeLocationPrecision
+	return orb.Point{lon, lat}, true
+}
+
+// readBlock returns the entries of the given block from the cache or the index file. The least recently used block is
+// removed from the cache when it's full.
+func (s *diskNodeLocationStore) readBlock(blockIndex int) []byte {
+	if element, ok := s.cachedBlocks[blockIndex]; ok {
+		s.cachedBlockList.MoveToFront(element)
+		return element.Value.(*diskNodeLocationBlock).entries
+	}
+
+	var block *diskNodeLocationBlock
+	if s.cachedBlockList.Len() >= diskNodeLocationCachedBlocks {
+		// Reuse the memory of the least recently used block
+		element := s.cachedBlockList.Back()
+		block = s.cachedBlockList.Remove(element).(*diskNodeLocationBlock)
+		delete(s.cachedBlocks, block.index)
+	} else {
+		block = &diskNodeLocationBlock{entries: make([]byte, diskNodeLocationBlockEntries*diskNodeLocationEntrySize)}
+	}
+
+	numberOfEntries := min(diskNodeLocationBlockEntries, s.numEntries-int64(blockIndex)*diskNodeLocationBlockEntries)
+	block.index = blockIndex
+	block.entries = block.entries[:numberOfEntries*diskNodeLocationEntrySize]
+	_, err := s.file.ReadAt(block.entries, int64(blockIndex)*diskNodeLocationBlockEntries*diskNodeLocationEntrySize)
+	if err != nil {
+		sigolo.Fatal("Error reading node location index %s: %s", s.file.Name(), err.Error())
+	}
+
+	s.cachedBlocks[blockIndex] = s.cachedBlockList.PushFront(block)
+	return block.entries
+}
+
+// close closes and removes the index file.
+func (s *diskNodeLocationStore) close() error {
+	err := s.file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(s.file.Name())
+}
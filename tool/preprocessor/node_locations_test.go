@@ -0,0 +1,39 @@
+package preprocessor
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskNodeLocationStore_multipleBlocks(t *testing.T) {
+	store, err := newDiskNodeLocationStore(filepath.Join(t.TempDir(), "nodes.idx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+
+	// More nodes than fit into the cache to also read evicted blocks again. Only even IDs exist.
+	numberOfNodes := (diskNodeLocationCachedBlocks + 2) * diskNodeLocationBlockEntries
+	for i := 1; i <= numberOfNodes; i++ {
+		err = store.add(osm.NodeID(i*2), orb.Point{float64(i%360) - 180, -float64(i%90) / 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Act & Assert
+	for _, i := range []int{1, numberOfNodes, diskNodeLocationBlockEntries, diskNodeLocationBlockEntries + 1, 12345, 1, numberOfNodes - 1} {
+		location, ok := store.get(osm.NodeID(i * 2))
+		expectedLocation := orb.Point{float64(i%360) - 180, -float64(i%90) / 2}
+		if !ok || location != expectedLocation {
+			t.Errorf("Wrong location of node %d: %v, %t", i*2, location, ok)
+		}
+	}
+	for _, id := range []osm.NodeID{0, 1, 12345, osm.NodeID(numberOfNodes*2 + 2)} {
+		if _, ok := store.get(id); ok {
+			t.Errorf("Node %d should not exist", id)
+		}
+	}
+}
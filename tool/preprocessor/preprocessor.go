@@ -3,8 +3,6 @@ package preprocessor
 import (
 	"context"
 	"github.com/hauke96/sigolo"
-	"github.com/paulmach/orb"
-	"github.com/paulmach/orb/planar"
 	"github.com/paulmach/osm"
 	"github.com/paulmach/osm/osmpbf"
 	"github.com/paulmach/osm/osmxml"
@@ -14,39 +12,27 @@ import (
 )
 
 var (
-	// Keeps track of the OSM IDs to not use them twice. While reading OSM objects, this counter is set to the highest
-	// ID found in the input data. It is then later used as ID counter for new object. This ensures that no IDs are
-	// used twice.
-	osmObjIdCounter int64 = 0
-	// A counter for temporary new objects. This is always a negative number, which marks new objects. Later, this
-	// temporary ID is turned into an actual ID using the osmObjIdCounter variable.
-	tmpOsmObjIdCounter int64 = -1
-	inputNodes               = map[osm.NodeID]*osm.Node{}
-	inputWays                = map[osm.WayID]*osm.Way{}
-	inputRelations           = map[osm.RelationID]*osm.Relation{}
-	wayRelationMapping       = map[osm.WayID][]osm.RelationID{}
+	inputNodes         = map[osm.NodeID]*osm.Node{}
+	inputWays          = map[osm.WayID]*osm.Way{}
+	inputRelations     = map[osm.RelationID]*osm.Relation{}
+	wayRelationMapping = map[osm.WayID][]osm.RelationID{}
+	// Maps route relations to the route relations they are member of (e.g. stages of a long-distance trail to the
+	// superroute of the trail).
+	relationParentMapping = map[osm.RelationID][]osm.RelationID{}
+	// Objects created during processing (e.g. label nodes), see generated_objects.go.
+	generatedNodes []*osm.Node
+	generatedWays  []*osm.Way
+	// Provides the locations of nodes, which are needed e.g. to determine the label points of ways.
+	nodeLocations nodeLocationStore = &inputNodesLocationStore{}
 )
 
-func PreprocessData(inputFile string, outputFile string) {
-	if !strings.HasSuffix(inputFile, ".osm") && !strings.HasSuffix(inputFile, ".pbf") {
-		sigolo.Error("Input file must be an .osm or .pbf file")
-		os.Exit(1)
-	}
-	if !strings.HasSuffix(outputFile, ".osm.pbf") {
-		sigolo.Error("Output file must be an .osm.pbf file")
-		os.Exit(1)
-	}
+func PreprocessData(inputFile string, outputFile string, useOsmium bool) {
+	verifyFileNames(inputFile, outputFile)
+	resetState()
+	nodeLocations = &inputNodesLocationStore{}
 
-	f, err := os.Open(inputFile)
-	sigolo.FatalCheck(err)
+	f, scanner := openScanner(inputFile)
 	defer f.Close()
-
-	var scanner osm.Scanner
-	if strings.HasSuffix(inputFile, ".osm") {
-		scanner = osmxml.New(context.Background(), f)
-	} else if strings.HasSuffix(inputFile, ".pbf") {
-		scanner = osmpbf.New(context.Background(), f, 1)
-	}
 	defer scanner.Close()
 
 	outputOsm := osm.OSM{
@@ -69,20 +55,40 @@ func PreprocessData(inputFile string, outputFile string) {
 		}
 	}
 
+	err := scanner.Err()
+	sigolo.FatalCheck(err)
+
+	sigolo.Debug("Create objects for %d multipolygon relations", len(pendingMultipolygonEmits))
+	createObjectsForMultipolygons(func(id osm.WayID) (*osm.Way, bool) {
+		way, ok := inputWays[id]
+		return way, ok
+	})
+
+	removeDuplicatePois()
+	for id := range duplicatePoiNodes {
+		removeTagsOfDuplicatePoiNode(inputNodes[id])
+	}
+
 	sigolo.Debug("Add hiking route names to ways")
-	addHikingRouteNamesToWays()
+	for _, way := range inputWays {
+		addHikingRouteNamesToWay(way)
+	}
+	reportMissingHikingRouteMembers()
+
+	sortGeneratedObjects()
 
-	sigolo.Debug("Write %d nodes to output", len(inputNodes))
+	sigolo.Debug("Write %d nodes and %d generated nodes to output", len(inputNodes), len(generatedNodes))
 	for _, node := range inputNodes {
 		outputOsm.Append(node)
 	}
-	sigolo.Debug("Write %d ways to output", len(inputWays))
+	for _, node := range generatedNodes {
+		outputOsm.Append(node)
+	}
+	sigolo.Debug("Write %d ways and %d generated ways to output", len(inputWays), len(generatedWays))
 	for _, way := range inputWays {
-		// Some ways are new any not have an ID yet, which is represented as a negative temporary ID.
-		if way.ID < 0 {
-			osmObjIdCounter++
-			way.ID = osm.WayID(osmObjIdCounter)
-		}
+		outputOsm.Append(way)
+	}
+	for _, way := range generatedWays {
 		outputOsm.Append(way)
 	}
 	sigolo.Debug("Write %d relations to output", len(inputRelations))
@@ -90,165 +96,139 @@ func PreprocessData(inputFile string, outputFile string) {
 		outputOsm.Append(relation)
 	}
 
-	err = scanner.Err()
-	sigolo.FatalCheck(err)
-
 	sigolo.Debug("Write OSM")
-	common.WriteOsmToPbf(outputFile, &outputOsm)
+	if useOsmium {
+		common.WriteOsmToPbfUsingOsmium(outputFile, &outputOsm)
+	} else {
+		common.WriteOsmToPbf(outputFile, &outputOsm)
+	}
 }
 
-func addHikingRouteNamesToWays() {
-	for wayId, relationIds := range wayRelationMapping {
-		way := inputWays[wayId]
-
-		newHikingRouteName := ""
-		isHikingRoute := false
-
-		for _, relationId := range relationIds {
-			relation := inputRelations[relationId]
+func verifyFileNames(inputFile string, outputFile string) {
+	if !strings.HasSuffix(inputFile, ".osm") && !strings.HasSuffix(inputFile, ".pbf") {
+		sigolo.Error("Input file must be an .osm or .pbf file")
+		os.Exit(1)
+	}
+	if !strings.HasSuffix(outputFile, ".osm.pbf") {
+		sigolo.Error("Output file must be an .osm.pbf file")
+		os.Exit(1)
+	}
+}
 
-			if relation.Tags.Find("type") != "route" || relation.Tags.Find("route") != "hiking" {
-				// Not a hiking route -> Ignore
-				continue
-			}
-			routeName := relation.Tags.Find("name")
-			routeRef := relation.Tags.Find("ref")
-			var combinedRouteName string
-			if routeName != "" {
-				combinedRouteName = routeName
-				if routeRef != "" {
-					combinedRouteName += " (" + routeRef + ")"
-				}
-			} else if routeRef != "" {
-				combinedRouteName = routeRef
-			} else {
-				// Neither name nor ref on route -> cannot set any name on way
-				continue
-			}
+// openScanner opens the given .osm or .pbf file. The caller is responsible for closing the file and the scanner.
+func openScanner(inputFile string) (*os.File, osm.Scanner) {
+	f, err := os.Open(inputFile)
+	sigolo.FatalCheck(err)
 
-			if newHikingRouteName == "" {
-				newHikingRouteName = combinedRouteName
-			} else {
-				newHikingRouteName = newHikingRouteName + ", " + combinedRouteName
-			}
+	var scanner osm.Scanner
+	if strings.HasSuffix(inputFile, ".osm") {
+		scanner = osmxml.New(context.Background(), f)
+	} else if strings.HasSuffix(inputFile, ".pbf") {
+		scanner = osmpbf.New(context.Background(), f, 1)
+	}
 
-			isHikingRoute = true
-		}
+	return f, scanner
+}
 
-		if isHikingRoute {
-			newHikingRouteNameTag := osm.Tag{
-				Key:   "hiking_route_names",
-				Value: newHikingRouteName,
-			}
-			newHikingRouteTag := osm.Tag{
-				Key:   "hiking_route",
-				Value: "yes",
-			}
-			way.Tags = append(way.Tags, newHikingRouteNameTag, newHikingRouteTag)
-		}
-	}
+// resetState removes all data from previous runs.
+func resetState() {
+	highestInputId = 0
+	generatedObjectCounts = map[osm.ObjectID]int{}
+	inputNodes = map[osm.NodeID]*osm.Node{}
+	inputWays = map[osm.WayID]*osm.Way{}
+	inputRelations = map[osm.RelationID]*osm.Relation{}
+	wayRelationMapping = map[osm.WayID][]osm.RelationID{}
+	relationParentMapping = map[osm.RelationID][]osm.RelationID{}
+	hikingRouteWaysFound = map[osm.WayID]bool{}
+	pendingMultipolygonEmits = nil
+	poiNodes = map[poiNodeGridCell][]*poiNode{}
+	poiAreas = nil
+	duplicatePoiNodes = map[osm.NodeID][]string{}
+	generatedNodes = nil
+	generatedWays = nil
 }
 
 func handleNode(node *osm.Node) {
-	updateOsmIdCounter(int64(node.ID))
+	updateHighestInputId(int64(node.ID))
+	updateNodeTags(node)
+	addTerrainTags(node)
+	collectPoiNode(node)
 }
 
-// handleWay might add new nodes or tags to the given way to handle them easier in styling. It returns true of the way
-// should be kept and false if the line should not be part of the output.
+// handleWay might add new nodes or tags to the given way to handle them easier in styling.
 func handleWay(way *osm.Way) {
-	updateOsmIdCounter(int64(way.ID))
-
-	// Handling of some special cases where certain ways should be converted into point features
-	if way.Tags.Find("ford") == "yes" ||
-		way.Tags.HasTag("shop") ||
-		way.Tags.HasTag("amenity") ||
-		way.Tags.HasTag("historic") ||
-		way.Tags.Find("tourism") == "camp_site" ||
-		way.Tags.Find("tourism") == "wilderness_hut" ||
-		way.Tags.Find("waterway") == "waterfall" {
-		centroid, _ := getCentroidOfWay(way)
-		addNode(centroid.Lon(), centroid.Lat(), way.Tags)
-	}
+	updateHighestInputId(int64(way.ID))
+	processWay(way, true, true)
+}
 
-	// Add highway tags for not accessible ways
-	isUnderConstruction := way.Tags.HasTag("construction")
-	hasNoRealHighwayTag := !way.Tags.HasTag("highway") || way.Tags.Find("highway") == "construction"
-	isNotAccessible := way.Tags.Find("access") == "no" ||
-		way.Tags.Find("access") == "private" ||
-		way.Tags.Find("foot") == "no" ||
-		way.Tags.Find("foot") == "private"
-
-	if isUnderConstruction && hasNoRealHighwayTag {
-		// Set highway tag for construction roads without proper one
-		way.Tags = setTag(way.Tags, "highway", way.Tags.Find("construction"))
-	}
+// createObjectsForWay creates new objects based on the given way, e.g. centroid nodes for POIs modeled as ways.
+func createObjectsForWay(way *osm.Way) {
+	processWay(way, true, false)
+}
 
-	if isUnderConstruction || isNotAccessible {
-		// Override access tag for simplicity
-		way.Tags = setTag(way.Tags, "access", "no")
-	}
+// updateWayTags changes the tags of the given way to make styling easier.
+func updateWayTags(way *osm.Way) {
+	processWay(way, false, true)
+}
 
-	// Remove "_link" part of highway tags
-	if strings.HasSuffix(way.Tags.Find("highway"), "_link") {
-		way.Tags = setTag(way.Tags, "highway", strings.TrimSuffix(way.Tags.Find("highway"), "_link"))
+// processWay applies the active rules to the given way. Objects emitted by the rules are only created when
+// createObjects is true and the changed tags are only stored in the way when updateTags is true.
+func processWay(way *osm.Way, createObjects bool, updateTags bool) {
+	var emit func(emitType string, tags osm.Tags)
+	if createObjects {
+		emit = func(emitType string, tags osm.Tags) {
+			switch emitType {
+			case emitCentroid:
+				area, ok := getGeometryOfWay(way)
+				if ok {
+					addLabelNode(area, tags, way)
+				}
+			case emitLine:
+				addWay(way.Nodes, tags, way)
+			}
+		}
 	}
 
-	// Add polygonal barriers as linestring to simplify styling
-	if barrierTagValue := way.Tags.Find("barrier"); barrierTagValue != "" {
-		openBarrierWay := &osm.Way{
-			ID:        osm.WayID(tmpOsmObjIdCounter),
-			Version:   0,
-			Timestamp: common.GetTimestamp(),
-			Nodes:     way.Nodes,
-			Tags: osm.Tags{
-				osm.Tag{
-					Key:   "barrier",
-					Value: barrierTagValue,
-				},
-			},
-		}
-		tmpOsmObjIdCounter--
-		inputWays[openBarrierWay.ID] = openBarrierWay
+	newTags := activeRules.apply(osm.TypeWay, way.Tags, emit)
+	if updateTags {
+		way.Tags = newTags
 	}
 }
 
-func handleRelation(relation *osm.Relation) {
-	updateOsmIdCounter(int64(relation.ID))
+func updateNodeTags(node *osm.Node) {
+	node.Tags = activeRules.apply(osm.TypeNode, node.Tags, nil)
+}
 
-	// Store each way that is part of a hiking-route separately to tag them later.
-	for _, member := range relation.Members {
-		if member.Type != osm.TypeWay {
-			continue
-		}
+// updateRelationTags changes the tags of the given relation to make styling easier.
+func updateRelationTags(relation *osm.Relation) {
+	processRelation(relation, false, true)
+}
 
-		// Member ways do not contain their nodes here, only a ref-ID to the actual way
-		if memberWay, ok := inputWays[osm.WayID(member.Ref)]; ok {
-			wayRelationMapping[memberWay.ID] = append(wayRelationMapping[memberWay.ID], relation.ID)
+// processRelation applies the active rules to the given relation. Objects emitted for multipolygon relations are only
+// created when createObjects is true. Their geometry is determined later by createObjectsForMultipolygons, because
+// the member ways might not have been read yet. The changed tags are only stored in the relation when updateTags is
+// true.
+func processRelation(relation *osm.Relation, createObjects bool, updateTags bool) {
+	var emit func(emitType string, tags osm.Tags)
+	if createObjects {
+		emit = func(emitType string, tags osm.Tags) {
+			addMultipolygonEmit(relation, emitType, tags)
 		}
 	}
-}
 
-// addNode to the input list of nodes
-func addNode(originLon float64, originLat float64, tags []osm.Tag) {
-	osmObjIdCounter++
-	node := osm.Node{
-		Version:   1,
-		ID:        osm.NodeID(osmObjIdCounter),
-		Timestamp: common.GetTimestamp(),
-		Tags:      tags,
-		Lon:       originLon,
-		Lat:       originLat,
+	newTags := activeRules.apply(osm.TypeRelation, relation.Tags, emit)
+	if updateTags {
+		relation.Tags = newTags
 	}
-	inputNodes[node.ID] = &node
 }
 
-func getCentroidOfWay(w *osm.Way) (orb.Point, float64) {
-	geometry := make(orb.LineString, 0, len(w.Nodes))
-	for _, n := range w.Nodes {
-		nodeWithGeometry := inputNodes[n.ID]
-		geometry = append(geometry, nodeWithGeometry.Point())
-	}
-	return planar.CentroidArea(geometry)
+// handleRelation might create new nodes for multipolygon relations and collects hiking route memberships.
+func handleRelation(relation *osm.Relation) {
+	updateHighestInputId(int64(relation.ID))
+	processRelation(relation, true, true)
+
+	// Store each way that is part of a hiking-route separately to tag them later.
+	collectHikingRouteMemberships(relation)
 }
 
 func setTag(tags osm.Tags, key string, value string) osm.Tags {
@@ -267,9 +247,3 @@ func setTag(tags osm.Tags, key string, value string) osm.Tags {
 
 	return newTags
 }
-
-func updateOsmIdCounter(osmObjId int64) {
-	if osmObjId > osmObjIdCounter {
-		osmObjIdCounter = osmObjId
-	}
-}
@@ -65,3 +65,227 @@ func TestWay_removeLink_underConstruction(t *testing.T) {
 		t.Errorf("No correct access tag found: %#v", way.Tags)
 	}
 }
+
+func TestRelation_hikingRouteBeforeWay(t *testing.T) {
+	resetState()
+
+	relation := osm.Relation{
+		ID: 456,
+		Members: []osm.Member{
+			{Type: osm.TypeWay, Ref: 123},
+			{Type: osm.TypeWay, Ref: 124},
+		},
+		Tags: []osm.Tag{
+			{Key: "type", Value: "route"},
+			{Key: "route", Value: "hiking"},
+			{Key: "name", Value: "Foo"},
+		},
+	}
+	way := osm.Way{
+		ID: 123,
+		Tags: []osm.Tag{
+			{Key: "highway", Value: "path"},
+		},
+	}
+
+	// Relation is read before the way, as it might happen in unsorted input data
+	inputRelations[relation.ID] = &relation
+	handleRelation(&relation)
+	inputWays[way.ID] = &way
+	handleWay(&way)
+
+	addHikingRouteNamesToWay(&way)
+
+	if way.Tags.Find("hiking_route") != "yes" || way.Tags.Find("hiking_route_names") != "Foo" {
+		t.Errorf("No correct hiking route tags found: %#v", way.Tags)
+	}
+	if !hikingRouteWaysFound[123] || hikingRouteWaysFound[124] {
+		t.Errorf("Wrong ways found: %#v", hikingRouteWaysFound)
+	}
+}
+
+func TestRelation_multipolygonCentroid(t *testing.T) {
+	resetState()
+
+	inputNodes = map[osm.NodeID]*osm.Node{
+		1: {ID: 1, Lat: 53.0, Lon: 10.0},
+		2: {ID: 2, Lat: 53.0, Lon: 10.2},
+		3: {ID: 3, Lat: 53.2, Lon: 10.2},
+		4: {ID: 4, Lat: 53.2, Lon: 10.0},
+	}
+	relation := osm.Relation{
+		ID: 456,
+		Members: []osm.Member{
+			{Type: osm.TypeWay, Ref: 123, Role: "outer"},
+			{Type: osm.TypeWay, Ref: 124, Role: "outer"},
+		},
+		Tags: []osm.Tag{
+			{Key: "type", Value: "multipolygon"},
+			{Key: "tourism", Value: "camp_site"},
+		},
+	}
+	// The outer ring is split into two ways
+	inputWays = map[osm.WayID]*osm.Way{
+		123: {ID: 123, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}}},
+		124: {ID: 124, Nodes: osm.WayNodes{{ID: 3}, {ID: 4}, {ID: 1}}},
+	}
+
+	handleRelation(&relation)
+	createObjectsForMultipolygons(func(id osm.WayID) (*osm.Way, bool) {
+		way, ok := inputWays[id]
+		return way, ok
+	})
+
+	if len(generatedNodes) != 1 {
+		t.Fatalf("Expected 1 generated node but got %d", len(generatedNodes))
+	}
+	node := generatedNodes[0]
+	if node.Tags.Find("tourism") != "camp_site" || node.Tags.HasTag("type") {
+		t.Errorf("Wrong tags of generated node: %#v", node.Tags)
+	}
+	if node.Lat < 53.09 || node.Lat > 53.11 || node.Lon < 10.09 || node.Lon > 10.11 {
+		t.Errorf("Wrong location of generated node: %f, %f", node.Lon, node.Lat)
+	}
+}
+
+func TestRelation_noMultipolygon(t *testing.T) {
+	resetState()
+
+	relation := osm.Relation{
+		ID: 456,
+		Tags: []osm.Tag{
+			{Key: "type", Value: "site"},
+			{Key: "tourism", Value: "camp_site"},
+		},
+	}
+
+	handleRelation(&relation)
+
+	if len(pendingMultipolygonEmits) != 0 {
+		t.Errorf("Expected no pending objects for relation of type site")
+	}
+}
+
+func TestRelation_hikingRouteInSuperroute(t *testing.T) {
+	resetState()
+
+	stage := osm.Relation{
+		ID:      456,
+		Members: []osm.Member{{Type: osm.TypeWay, Ref: 123}},
+		Tags: []osm.Tag{
+			{Key: "type", Value: "route"},
+			{Key: "route", Value: "hiking"},
+			{Key: "name", Value: "Stage 1"},
+		},
+	}
+	trail := osm.Relation{
+		ID:      457,
+		Members: []osm.Member{{Type: osm.TypeRelation, Ref: 456}},
+		Tags: []osm.Tag{
+			{Key: "type", Value: "superroute"},
+			{Key: "route", Value: "hiking"},
+			{Key: "name", Value: "Trail"},
+			{Key: "ref", Value: "T"},
+		},
+	}
+	// Contains the trail and is contained in the trail, which must not lead to an endless loop
+	cyclicRoute := osm.Relation{
+		ID:      458,
+		Members: []osm.Member{{Type: osm.TypeRelation, Ref: 457}},
+		Tags: []osm.Tag{
+			{Key: "type", Value: "route"},
+			{Key: "route", Value: "hiking"},
+			{Key: "name", Value: "Network"},
+		},
+	}
+	trail.Members = append(trail.Members, osm.Member{Type: osm.TypeRelation, Ref: 458})
+	way := osm.Way{
+		ID: 123,
+		Tags: []osm.Tag{
+			{Key: "highway", Value: "path"},
+		},
+	}
+
+	for _, relation := range []*osm.Relation{&trail, &cyclicRoute, &stage} {
+		inputRelations[relation.ID] = relation
+		handleRelation(relation)
+	}
+	inputWays[way.ID] = &way
+	handleWay(&way)
+
+	addHikingRouteNamesToWay(&way)
+
+	if way.Tags.Find("hiking_route") != "yes" || way.Tags.Find("hiking_route_names") != "Stage 1" {
+		t.Errorf("No correct hiking route tags found: %#v", way.Tags)
+	}
+	if way.Tags.Find("hiking_route_parent_names") != "Trail (T), Network" {
+		t.Errorf("Wrong parent route names: %s", way.Tags.Find("hiking_route_parent_names"))
+	}
+}
+
+func TestRelation_hikingRouteClassification(t *testing.T) {
+	resetState()
+
+	localRoute := osm.Relation{
+		ID:      456,
+		Members: []osm.Member{{Type: osm.TypeWay, Ref: 123}},
+		Tags: []osm.Tag{
+			{Key: "type", Value: "route"},
+			{Key: "route", Value: "hiking"},
+			{Key: "network", Value: "lwn"},
+			{Key: "ref", Value: "L1"},
+			{Key: "osmc:symbol", Value: "yellow:white:yellow_bar"},
+			{Key: "operator", Value: "Local club"},
+		},
+	}
+	europeanPath := osm.Relation{
+		ID:      457,
+		Members: []osm.Member{{Type: osm.TypeWay, Ref: 123}},
+		Tags: []osm.Tag{
+			{Key: "type", Value: "route"},
+			{Key: "route", Value: "hiking"},
+			{Key: "network", Value: "iwn"},
+			{Key: "ref", Value: "E1"},
+			{Key: "osmc:symbol", Value: "black:white:black_cross"},
+		},
+	}
+	// Same ref as the local route
+	regionalRoute := osm.Relation{
+		ID:      458,
+		Members: []osm.Member{{Type: osm.TypeWay, Ref: 123}},
+		Tags: []osm.Tag{
+			{Key: "type", Value: "route"},
+			{Key: "route", Value: "hiking"},
+			{Key: "network", Value: "rwn"},
+			{Key: "ref", Value: "L1"},
+		},
+	}
+	way := osm.Way{
+		ID: 123,
+		Tags: []osm.Tag{
+			{Key: "highway", Value: "path"},
+		},
+	}
+
+	for _, relation := range []*osm.Relation{&localRoute, &europeanPath, &regionalRoute} {
+		inputRelations[relation.ID] = relation
+		handleRelation(relation)
+	}
+	inputWays[way.ID] = &way
+	handleWay(&way)
+
+	addHikingRouteNamesToWay(&way)
+
+	if way.Tags.Find("hiking_route_network") != "iwn" {
+		t.Errorf("Wrong network: %s", way.Tags.Find("hiking_route_network"))
+	}
+	if way.Tags.Find("hiking_route_refs") != "E1;L1" {
+		t.Errorf("Wrong refs: %s", way.Tags.Find("hiking_route_refs"))
+	}
+	if way.Tags.Find("hiking_route_symbol") != "black:white:black_cross" {
+		t.Errorf("Wrong symbol: %s", way.Tags.Find("hiking_route_symbol"))
+	}
+	if way.Tags.Find("hiking_route_operator") != "Local club" || way.Tags.HasTag("hiking_route_colour") {
+		t.Errorf("Wrong operator or colour: %#v", way.Tags)
+	}
+}
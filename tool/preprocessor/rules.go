@@ -0,0 +1,447 @@
+package preprocessor
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/hauke96/sigolo"
+	"github.com/paulmach/osm"
+	"gopkg.in/yaml.v3"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	emitCentroid = "centroid"
+	emitLine     = "line"
+)
+
+var (
+	//go:embed default-rules.yaml
+	defaultRulesFileContent []byte
+
+	// The rules used to process the data. These are the default rules unless LoadRules is called.
+	activeRules = mustParseRules(defaultRulesFileContent)
+
+	// Matches references to tag values like "{construction}" in values of set-actions.
+	tagReferenceRegex = regexp.MustCompile(`\{([^{}]+)}`)
+)
+
+// ruleSet contains all rules of a rules file. The rules are applied in the order they appear in the file.
+type ruleSet struct {
+	Rules      []*rule           `yaml:"rules"`
+	Duplicates *duplicatesConfig `yaml:"duplicates"`
+}
+
+// duplicatesConfig defines how label nodes of areas are deduplicated against tagged nodes describing the same feature,
+// see removeDuplicatePois.
+type duplicatesConfig struct {
+	// The keys defining the kind of a POI. A node and an area are of the same kind, when they have the same value for
+	// the first of these keys the label node of the area has.
+	Keys []string `yaml:"keys"`
+	// Maximum distance in meters of a node outside the area to be considered a duplicate.
+	Distance float64 `yaml:"distance"`
+	// The object to keep, either "node" or "area".
+	Priority string `yaml:"priority"`
+}
+
+type rule struct {
+	Name string `yaml:"name"`
+	// The types of objects (node, way, relation) this rule applies to. An empty list means all types.
+	Types   []string   `yaml:"types"`
+	Match   *condition `yaml:"match"`
+	Actions []*action  `yaml:"actions"`
+
+	objectTypes map[osm.Type]bool
+}
+
+// condition either is a tag expression or a combination of other conditions. Tag expressions have one of the following
+// forms:
+//   - "key": The tag exists
+//   - "!key": The tag does not exist
+//   - "key=value" or "key=value1|value2": The tag has one of the given values
+//   - "key!=value" or "key!=value1|value2": The tag does not have any of the given values (or doesn't exist)
+//   - "key~regex": The tag value matches the given regular expression
+type condition struct {
+	Tag string       `yaml:"tag"`
+	All []*condition `yaml:"all"`
+	Any []*condition `yaml:"any"`
+	Not *condition   `yaml:"not"`
+
+	key      string
+	operator string
+	values   []string
+	regex    *regexp.Regexp
+}
+
+type replacement struct {
+	Pattern string `yaml:"pattern"`
+	With    string `yaml:"with"`
+
+	regex *regexp.Regexp
+}
+
+// action changes the tags of the object or emits a new object. Values of "set" may reference other tag values of the
+// object using "{key}".
+type action struct {
+	Set     map[string]string       `yaml:"set"`
+	Remove  []string                `yaml:"remove"`
+	Rename  map[string]string       `yaml:"rename"`
+	Replace map[string]*replacement `yaml:"replace"`
+	// Emits a new object. Either "centroid" for a label node inside a way or multipolygon relation (see
+	// getLabelPoint) or "line" for a way with the same nodes.
+	Emit string `yaml:"emit"`
+	// The tags copied to the emitted object. An empty list means all tags.
+	Tags []string `yaml:"tags"`
+}
+
+// LoadRules reads the given YAML or JSON rules file and uses its rules instead of the default rules.
+func LoadRules(rulesFile string) {
+	sigolo.Info("Load rules from %s", rulesFile)
+
+	fileContent, err := os.ReadFile(rulesFile)
+	sigolo.FatalCheck(err)
+
+	rules, err := parseRules(fileContent)
+	if err != nil {
+		sigolo.Fatal("Error reading rules file %s: %s", rulesFile, err.Error())
+	}
+
+	sigolo.Debug("Loaded %d rules", len(rules.Rules))
+	activeRules = rules
+}
+
+func mustParseRules(fileContent []byte) *ruleSet {
+	rules, err := parseRules(fileContent)
+	sigolo.FatalCheck(err)
+	return rules
+}
+
+// parseRules parses the given rules file content. Because JSON is a subset of YAML, this works for both formats.
+func parseRules(fileContent []byte) (*ruleSet, error) {
+	rules := &ruleSet{}
+	err := yaml.Unmarshal(fileContent, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, r := range rules.Rules {
+		err = r.compile()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid rule %d (%s): %s", i+1, r.Name, err.Error()))
+		}
+	}
+
+	if rules.Duplicates != nil {
+		err = rules.Duplicates.validate()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid duplicates config: %s", err.Error()))
+		}
+	}
+
+	return rules, nil
+}
+
+func (c *duplicatesConfig) validate() error {
+	if c.Priority != duplicatePriorityNode && c.Priority != duplicatePriorityArea {
+		return errors.New(fmt.Sprintf("Unknown priority '%s', must be '%s' or '%s'", c.Priority, duplicatePriorityNode, duplicatePriorityArea))
+	}
+	if c.Distance < 0 {
+		return errors.New(fmt.Sprintf("Distance must not be negative but was %f", c.Distance))
+	}
+	return nil
+}
+
+func (r *rule) compile() error {
+	r.objectTypes = map[osm.Type]bool{}
+	for _, t := range r.Types {
+		objectType := osm.Type(t)
+		if objectType != osm.TypeNode && objectType != osm.TypeWay && objectType != osm.TypeRelation {
+			return errors.New(fmt.Sprintf("Unknown object type %s", t))
+		}
+		r.objectTypes[objectType] = true
+	}
+
+	if r.Match != nil {
+		err := r.Match.compile()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, a := range r.Actions {
+		err := a.compile()
+		if err != nil {
+			return err
+		}
+
+		if a.Emit == emitLine && (len(r.objectTypes) != 1 || !r.objectTypes[osm.TypeWay]) {
+			return errors.New("Emitting lines is only supported for rules restricted to ways")
+		}
+		if a.Emit == emitCentroid && (len(r.objectTypes) == 0 || r.objectTypes[osm.TypeNode]) {
+			return errors.New("Emitting centroids is only supported for rules restricted to ways and relations")
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalYAML allows a plain string as shorthand for a condition with only a tag expression.
+func (c *condition) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		c.Tag = value.Value
+		return nil
+	}
+
+	// Use different type to not call this function recursively
+	type plainCondition condition
+	return value.Decode((*plainCondition)(c))
+}
+
+func (c *condition) compile() error {
+	numberOfParts := 0
+	if c.Tag != "" {
+		numberOfParts++
+	}
+	if len(c.All) != 0 {
+		numberOfParts++
+	}
+	if len(c.Any) != 0 {
+		numberOfParts++
+	}
+	if c.Not != nil {
+		numberOfParts++
+	}
+	if numberOfParts != 1 {
+		return errors.New("A condition must have exactly one of: tag expression, all, any, not")
+	}
+
+	for _, subCondition := range c.All {
+		err := subCondition.compile()
+		if err != nil {
+			return err
+		}
+	}
+	for _, subCondition := range c.Any {
+		err := subCondition.compile()
+		if err != nil {
+			return err
+		}
+	}
+	if c.Not != nil {
+		return c.Not.compile()
+	}
+
+	if c.Tag == "" {
+		return nil
+	}
+
+	// The first operator separates the key from the value, so that values (e.g. regular expressions) may contain
+	// operator characters as well.
+	index := strings.IndexAny(c.Tag, "=~")
+	switch {
+	case index > 0 && c.Tag[index] == '=' && c.Tag[index-1] == '!':
+		c.key, c.operator, c.values = c.Tag[:index-1], "!=", splitValues(c.Tag[index+1:])
+	case index != -1 && c.Tag[index] == '=':
+		c.key, c.operator, c.values = c.Tag[:index], "=", splitValues(c.Tag[index+1:])
+	case index != -1:
+		regex, err := regexp.Compile(strings.TrimSpace(c.Tag[index+1:]))
+		if err != nil {
+			return err
+		}
+		c.key, c.operator, c.regex = c.Tag[:index], "~", regex
+	case strings.HasPrefix(c.Tag, "!"):
+		c.key, c.operator = c.Tag[1:], "!"
+	default:
+		c.key, c.operator = c.Tag, ""
+	}
+
+	c.key = strings.TrimSpace(c.key)
+	if c.key == "" {
+		return errors.New(fmt.Sprintf("Tag expression '%s' has no key", c.Tag))
+	}
+
+	return nil
+}
+
+// splitValues splits the "|" separated values of a tag expression and removes surrounding whitespace.
+func splitValues(values string) []string {
+	result := strings.Split(values, "|")
+	for i, value := range result {
+		result[i] = strings.TrimSpace(value)
+	}
+	return result
+}
+
+func (c *condition) matches(tags osm.Tags) bool {
+	switch {
+	case len(c.All) != 0:
+		for _, subCondition := range c.All {
+			if !subCondition.matches(tags) {
+				return false
+			}
+		}
+		return true
+	case len(c.Any) != 0:
+		for _, subCondition := range c.Any {
+			if subCondition.matches(tags) {
+				return true
+			}
+		}
+		return false
+	case c.Not != nil:
+		return !c.Not.matches(tags)
+	}
+
+	switch c.operator {
+	case "=":
+		return tags.HasTag(c.key) && containsString(c.values, tags.Find(c.key))
+	case "!=":
+		return !tags.HasTag(c.key) || !containsString(c.values, tags.Find(c.key))
+	case "~":
+		return tags.HasTag(c.key) && c.regex.MatchString(tags.Find(c.key))
+	case "!":
+		return !tags.HasTag(c.key)
+	default:
+		return tags.HasTag(c.key)
+	}
+}
+
+func (a *action) compile() error {
+	numberOfParts := 0
+	if len(a.Set) != 0 {
+		numberOfParts++
+	}
+	if len(a.Remove) != 0 {
+		numberOfParts++
+	}
+	if len(a.Rename) != 0 {
+		numberOfParts++
+	}
+	if len(a.Replace) != 0 {
+		numberOfParts++
+	}
+	if a.Emit != "" {
+		numberOfParts++
+		if a.Emit != emitCentroid && a.Emit != emitLine {
+			return errors.New(fmt.Sprintf("Unknown emit type %s", a.Emit))
+		}
+	}
+	if numberOfParts != 1 {
+		return errors.New("An action must have exactly one of: set, remove, rename, replace, emit")
+	}
+	if len(a.Tags) != 0 && a.Emit == "" {
+		return errors.New("The tags of an action are only allowed for emit actions")
+	}
+
+	for _, r := range a.Replace {
+		regex, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return err
+		}
+		r.regex = regex
+	}
+
+	return nil
+}
+
+// apply applies all rules matching the given object type and tags. The given tags are not changed, instead new tags
+// are returned. For each emit action, the emit function is called with the emit type and the tags of the new object.
+// The emit function may be nil, in which case emit actions are ignored.
+func (s *ruleSet) apply(objectType osm.Type, tags osm.Tags, emit func(emitType string, tags osm.Tags)) osm.Tags {
+	for _, r := range s.Rules {
+		if len(r.objectTypes) != 0 && !r.objectTypes[objectType] {
+			continue
+		}
+		if r.Match != nil && !r.Match.matches(tags) {
+			continue
+		}
+
+		for _, a := range r.Actions {
+			if a.Emit != "" {
+				if emit != nil {
+					emit(a.Emit, a.getEmittedTags(tags))
+				}
+				continue
+			}
+			tags = a.apply(tags)
+		}
+	}
+
+	return tags
+}
+
+func (a *action) apply(tags osm.Tags) osm.Tags {
+	// Map keys are sorted to always produce the same tag order
+	for _, key := range sortedKeys(a.Set) {
+		value := tagReferenceRegex.ReplaceAllStringFunc(a.Set[key], func(reference string) string {
+			return tags.Find(strings.Trim(reference, "{}"))
+		})
+		tags = setTag(tags, key, value)
+	}
+
+	for _, key := range a.Remove {
+		tags = removeTag(tags, key)
+	}
+
+	for _, oldKey := range sortedKeys(a.Rename) {
+		if !tags.HasTag(oldKey) {
+			continue
+		}
+		value := tags.Find(oldKey)
+		tags = setTag(removeTag(tags, oldKey), a.Rename[oldKey], value)
+	}
+
+	for _, key := range sortedKeys(a.Replace) {
+		if !tags.HasTag(key) {
+			continue
+		}
+		tags = setTag(tags, key, a.Replace[key].regex.ReplaceAllString(tags.Find(key), a.Replace[key].With))
+	}
+
+	return tags
+}
+
+func (a *action) getEmittedTags(tags osm.Tags) osm.Tags {
+	if len(a.Tags) == 0 {
+		return tags
+	}
+
+	var emittedTags osm.Tags
+	for _, key := range a.Tags {
+		if tags.HasTag(key) {
+			emittedTags = append(emittedTags, osm.Tag{Key: key, Value: tags.Find(key)})
+		}
+	}
+	return emittedTags
+}
+
+func removeTag(tags osm.Tags, key string) osm.Tags {
+	var newTags osm.Tags
+	for _, t := range tags {
+		if t.Key != key {
+			newTags = append(newTags, t)
+		}
+	}
+	return newTags
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,125 @@
+package preprocessor
+
+import (
+	"github.com/paulmach/osm"
+	"testing"
+)
+
+func TestRules_jsonFile(t *testing.T) {
+	rules, err := parseRules([]byte(`{
+		"rules": [
+			{
+				"types": ["node"],
+				"match": {"all": ["natural=peak", {"not": "name"}]},
+				"actions": [
+					{"set": {"name": "Peak {ele}"}},
+					{"rename": {"ele": "elevation"}},
+					{"remove": ["foo"]}
+				]
+			}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags := rules.apply(osm.TypeNode, osm.Tags{
+		{Key: "natural", Value: "peak"},
+		{Key: "ele", Value: "123"},
+		{Key: "foo", Value: "bar"},
+	}, nil)
+
+	if len(tags) != 3 || tags.Find("name") != "Peak 123" || tags.Find("elevation") != "123" || tags.Find("natural") != "peak" {
+		t.Errorf("Wrong tags: %#v", tags)
+	}
+
+	// Rule must not match ways
+	tags = rules.apply(osm.TypeWay, osm.Tags{{Key: "natural", Value: "peak"}}, nil)
+	if len(tags) != 1 {
+		t.Errorf("Wrong tags: %#v", tags)
+	}
+}
+
+func TestRules_emit(t *testing.T) {
+	rules, err := parseRules([]byte(`
+rules:
+  - types: [ way ]
+    match:
+      any: [ "barrier=fence|wall", "fence_type" ]
+    actions:
+      - emit: line
+        tags: [ barrier ]
+      - remove: [ barrier ]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var emittedTypes []string
+	var emittedTags []osm.Tags
+	tags := rules.apply(osm.TypeWay, osm.Tags{
+		{Key: "barrier", Value: "wall"},
+		{Key: "landuse", Value: "farmland"},
+	}, func(emitType string, tags osm.Tags) {
+		emittedTypes = append(emittedTypes, emitType)
+		emittedTags = append(emittedTags, tags)
+	})
+
+	if len(tags) != 1 || tags.Find("landuse") != "farmland" {
+		t.Errorf("Wrong tags: %#v", tags)
+	}
+	if len(emittedTypes) != 1 || emittedTypes[0] != emitLine {
+		t.Fatalf("Wrong emitted objects: %#v", emittedTypes)
+	}
+	if len(emittedTags[0]) != 1 || emittedTags[0].Find("barrier") != "wall" {
+		t.Errorf("Wrong tags of emitted object: %#v", emittedTags[0])
+	}
+}
+
+func TestCondition_tagExpressions(t *testing.T) {
+	tags := osm.Tags{
+		{Key: "highway", Value: "path"},
+		{Key: "website", Value: "https://example.com/hut?id=42"},
+	}
+
+	for expression, expected := range map[string]bool{
+		`website~^https?://.*\?id=`: true,
+		`website~\?id!=`:            false,
+		`highway = path | track`:    true,
+		`highway != path`:           false,
+		`highway!=track`:            true,
+		`highway ~ ^pa`:             true,
+		`!website`:                  false,
+		`name`:                      false,
+	} {
+		c := &condition{Tag: expression}
+		err := c.compile()
+		if err != nil {
+			t.Fatalf("Error compiling '%s': %s", expression, err.Error())
+		}
+
+		if c.matches(tags) != expected {
+			t.Errorf("Expected %t for '%s'", expected, expression)
+		}
+	}
+}
+
+func TestRules_invalidRules(t *testing.T) {
+	invalidRules := []string{
+		`rules: [ { types: [ area ] } ]`,
+		`rules: [ { match: "=foo" } ]`,
+		`rules: [ { match: { tag: foo, any: [ bar ] } } ]`,
+		`rules: [ { actions: [ { set: { foo: bar }, remove: [ foo ] } ] } ]`,
+		`rules: [ { actions: [ { emit: centroid } ] } ]`,
+		`rules: [ { types: [ way ], actions: [ { emit: polygon } ] } ]`,
+		`rules: [ { types: [ node, way ], actions: [ { emit: centroid } ] } ]`,
+		`rules: [ { types: [ way, relation ], actions: [ { emit: line } ] } ]`,
+	}
+
+	for _, rulesFileContent := range invalidRules {
+		_, err := parseRules([]byte(rulesFileContent))
+		if err == nil {
+			t.Errorf("Expected error for rules %s", rulesFileContent)
+		}
+	}
+}
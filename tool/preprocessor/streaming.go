@@ -0,0 +1,197 @@
+package preprocessor
+
+import (
+	"github.com/hauke96/sigolo"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"tool/common"
+)
+
+// PreprocessDataStreaming does the same as PreprocessData but without keeping all objects in memory. The input data is
+// read twice and must be sorted (nodes, then ways, then relations, each sorted by ID), which is the case for OSM-PBF
+// files from e.g. Geofabrik or files written by osmium.
+//
+// The first pass only collects the node locations, the objects generated for ways (e.g. centroid nodes), the POI nodes
+// to find duplicates and the hiking route memberships. The second pass changes the tags of each object and writes it directly to the output file. When
+// objects are emitted for multipolygon relations, the ways are read once more in between to determine the geometry of
+// these relations.
+//
+// When nodeIndexFile is not empty, the node locations are stored in this file instead of memory. The file is removed
+// afterwards.
+func PreprocessDataStreaming(inputFile string, outputFile string, nodeIndexFile string) {
+	verifyFileNames(inputFile, outputFile)
+	resetState()
+
+	if nodeIndexFile != "" {
+		sigolo.Debug("Use node location index file %s", nodeIndexFile)
+		store, err := newDiskNodeLocationStore(nodeIndexFile)
+		sigolo.FatalCheck(err)
+		nodeLocations = store
+	} else {
+		nodeLocations = newMemoryNodeLocationStore()
+	}
+	defer func() {
+		err := nodeLocations.close()
+		sigolo.FatalCheck(err)
+		nodeLocations = &inputNodesLocationStore{}
+	}()
+
+	sigolo.Debug("Start first pass: Collect node locations and relation memberships")
+	bounds := collectData(inputFile)
+
+	if len(pendingMultipolygonEmits) > 0 {
+		sigolo.Debug("Read ways of %d multipolygon relations", len(pendingMultipolygonEmits))
+		memberWays := collectWays(inputFile, getPendingMultipolygonMemberWays())
+		createObjectsForMultipolygons(func(id osm.WayID) (*osm.Way, bool) {
+			way, ok := memberWays[id]
+			return way, ok
+		})
+	}
+
+	removeDuplicatePois()
+	sortGeneratedObjects()
+
+	sigolo.Debug("Start second pass: Process and write data")
+	processAndWriteData(inputFile, outputFile, bounds)
+}
+
+// collectData reads the input file and collects all information needed to process the objects in the second pass. The
+// bounds of all nodes are returned.
+func collectData(inputFile string) *osm.Bounds {
+	f, scanner := openScanner(inputFile)
+	defer f.Close()
+	defer scanner.Close()
+
+	var bounds *osm.Bounds
+	for scanner.Scan() {
+		obj := scanner.Object()
+		switch osmObj := obj.(type) {
+		case *osm.Node:
+			updateHighestInputId(int64(osmObj.ID))
+			err := nodeLocations.add(osmObj.ID, osmObj.Point())
+			sigolo.FatalCheck(err)
+			bounds = common.ExtendBounds(bounds, osmObj.Lon, osmObj.Lat)
+			// The tags are changed again in the second pass, this is only needed to find duplicate POIs.
+			updateNodeTags(osmObj)
+			collectPoiNode(osmObj)
+		case *osm.Way:
+			updateHighestInputId(int64(osmObj.ID))
+			createObjectsForWay(osmObj)
+		case *osm.Relation:
+			handleRelation(osmObj)
+			if common.IsHikingRoute(osmObj) {
+				// Only the tags are needed to determine the route names, the members would waste memory.
+				inputRelations[osmObj.ID] = &osm.Relation{
+					ID:   osmObj.ID,
+					Tags: osmObj.Tags,
+				}
+			}
+		}
+	}
+
+	err := scanner.Err()
+	sigolo.FatalCheck(err)
+
+	sigolo.Debug("Collected %d generated nodes, %d generated ways and %d hiking route relations", len(generatedNodes), len(generatedWays), len(inputRelations))
+	return bounds
+}
+
+// collectWays reads the node lists of the given ways from the input file.
+func collectWays(inputFile string, wayIds map[osm.WayID]bool) map[osm.WayID]*osm.Way {
+	f, scanner := openScanner(inputFile)
+	defer f.Close()
+	defer scanner.Close()
+
+	if pbfScanner, ok := scanner.(*osmpbf.Scanner); ok {
+		pbfScanner.SkipNodes = true
+		pbfScanner.SkipRelations = true
+	}
+
+	ways := map[osm.WayID]*osm.Way{}
+	for scanner.Scan() {
+		way, ok := scanner.Object().(*osm.Way)
+		if ok && wayIds[way.ID] {
+			// Only the nodes are needed to determine the geometry, the tags would waste memory.
+			ways[way.ID] = &osm.Way{ID: way.ID, Nodes: way.Nodes}
+		}
+	}
+
+	err := scanner.Err()
+	sigolo.FatalCheck(err)
+
+	return ways
+}
+
+// processAndWriteData reads the input file again, processes each object and writes it to the output file. The
+// generated objects are written after the input objects of the same type, because they have higher IDs.
+func processAndWriteData(inputFile string, outputFile string, bounds *osm.Bounds) {
+	f, scanner := openScanner(inputFile)
+	defer f.Close()
+	defer scanner.Close()
+
+	writer, err := common.NewPbfWriter(outputFile, bounds)
+	sigolo.FatalCheck(err)
+
+	generatedNodesWritten := false
+	writeGeneratedNodes := func() {
+		if generatedNodesWritten {
+			return
+		}
+		sigolo.Debug("Write %d generated nodes", len(generatedNodes))
+		for _, node := range generatedNodes {
+			writeErr := writer.WriteNode(node)
+			sigolo.FatalCheck(writeErr)
+		}
+		generatedNodesWritten = true
+	}
+
+	generatedWaysWritten := false
+	writeGeneratedWays := func() {
+		if generatedWaysWritten {
+			return
+		}
+		sigolo.Debug("Write %d generated ways", len(generatedWays))
+		for _, way := range generatedWays {
+			writeErr := writer.WriteWay(way)
+			sigolo.FatalCheck(writeErr)
+		}
+		generatedWaysWritten = true
+	}
+
+	for scanner.Scan() {
+		obj := scanner.Object()
+		switch osmObj := obj.(type) {
+		case *osm.Node:
+			updateNodeTags(osmObj)
+			addTerrainTags(osmObj)
+			removeTagsOfDuplicatePoiNode(osmObj)
+			err = writer.WriteNode(osmObj)
+		case *osm.Way:
+			writeGeneratedNodes()
+			updateWayTags(osmObj)
+			addHikingRouteNamesToWay(osmObj)
+			err = writer.WriteWay(osmObj)
+		case *osm.Relation:
+			writeGeneratedNodes()
+			writeGeneratedWays()
+			updateRelationTags(osmObj)
+			err = writer.WriteRelation(osmObj)
+		}
+
+		if err != nil {
+			sigolo.Fatal("Error writing %s: %s. Streaming mode requires sorted input data.", obj.ObjectID(), err.Error())
+		}
+	}
+
+	err = scanner.Err()
+	sigolo.FatalCheck(err)
+
+	writeGeneratedNodes()
+	writeGeneratedWays()
+	reportMissingHikingRouteMembers()
+
+	err = writer.Close()
+	sigolo.FatalCheck(err)
+
+	sigolo.Info("OSM data successfully written to %s", outputFile)
+}
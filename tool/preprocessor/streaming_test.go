@@ -0,0 +1,216 @@
+package preprocessor
+
+import (
+	"bytes"
+	"context"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"tool/common"
+)
+
+var inputTimestamp = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func createTestInput(t *testing.T) string {
+	inputOsm := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lat: 53.0, Lon: 10.0},
+			{ID: 2, Version: 1, Lat: 53.0, Lon: 10.2},
+			{ID: 3, Version: 1, Lat: 53.2, Lon: 10.2},
+			{ID: 4, Version: 1, Lat: 53.2, Lon: 10.0},
+		},
+		Ways: osm.Ways{
+			{ID: 10, Version: 1, Timestamp: inputTimestamp, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 1}}, Tags: osm.Tags{
+				{Key: "amenity", Value: "shelter"},
+				{Key: "barrier", Value: "fence"},
+			}},
+			{ID: 11, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}, Tags: osm.Tags{
+				{Key: "highway", Value: "primary_link"},
+			}},
+		},
+		Relations: osm.Relations{
+			{ID: 20, Version: 1, Members: osm.Members{{Type: osm.TypeWay, Ref: 11}}, Tags: osm.Tags{
+				{Key: "type", Value: "route"},
+				{Key: "route", Value: "hiking"},
+				{Key: "name", Value: "Foo"},
+				{Key: "ref", Value: "F"},
+			}},
+		},
+	}
+
+	inputFile := filepath.Join(t.TempDir(), "input.osm.pbf")
+	common.WriteOsmToPbf(inputFile, inputOsm)
+	return inputFile
+}
+
+func readOutput(t *testing.T, outputFile string) *osm.OSM {
+	f, err := os.Open(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := osmpbf.New(context.Background(), f, 1)
+	defer scanner.Close()
+
+	result := &osm.OSM{}
+	for scanner.Scan() {
+		result.Append(scanner.Object())
+	}
+	if scanner.Err() != nil {
+		t.Fatal(scanner.Err())
+	}
+	return result
+}
+
+func verifyOutput(t *testing.T, result *osm.OSM) {
+	if len(result.Nodes) != 5 {
+		t.Fatalf("Expected 5 nodes but got %d", len(result.Nodes))
+	}
+	centroidNode := result.Nodes[4]
+	if centroidNode.ID != 100000000100 || centroidNode.Tags.Find("amenity") != "shelter" || !centroidNode.Timestamp.Equal(inputTimestamp) {
+		t.Errorf("Wrong centroid node: %#v", centroidNode)
+	}
+	if centroidNode.Lat < 53.09 || centroidNode.Lat > 53.11 || centroidNode.Lon < 10.09 || centroidNode.Lon > 10.11 {
+		t.Errorf("Wrong centroid location: %f, %f", centroidNode.Lon, centroidNode.Lat)
+	}
+	if centroidNode.Tags.Find("source:osm_type") != "way" || centroidNode.Tags.Find("source:osm_id") != "10" {
+		t.Errorf("Wrong source tags on centroid node: %#v", centroidNode.Tags)
+	}
+
+	if len(result.Ways) != 3 {
+		t.Fatalf("Expected 3 ways but got %d", len(result.Ways))
+	}
+	routeWay := result.Ways[1]
+	if routeWay.Tags.Find("highway") != "primary" || routeWay.Tags.Find("hiking_route") != "yes" || routeWay.Tags.Find("hiking_route_names") != "Foo (F)" {
+		t.Errorf("Wrong tags on route way: %#v", routeWay.Tags)
+	}
+	barrierWay := result.Ways[2]
+	if barrierWay.ID != 100000000101 || barrierWay.Tags.Find("barrier") != "fence" || len(barrierWay.Nodes) != 5 || !barrierWay.Timestamp.Equal(inputTimestamp) {
+		t.Errorf("Wrong barrier way: %#v", barrierWay)
+	}
+	if barrierWay.Tags.Find("source:osm_type") != "way" || barrierWay.Tags.Find("source:osm_id") != "10" {
+		t.Errorf("Wrong source tags on barrier way: %#v", barrierWay.Tags)
+	}
+
+	if len(result.Relations) != 1 {
+		t.Errorf("Expected 1 relation but got %d", len(result.Relations))
+	}
+}
+
+func TestPreprocessData(t *testing.T) {
+	inputFile := createTestInput(t)
+	outputFile := filepath.Join(t.TempDir(), "output.osm.pbf")
+
+	PreprocessData(inputFile, outputFile, false)
+
+	verifyOutput(t, readOutput(t, outputFile))
+}
+
+func TestPreprocessDataStreaming(t *testing.T) {
+	inputFile := createTestInput(t)
+	outputFile := filepath.Join(t.TempDir(), "output.osm.pbf")
+
+	PreprocessDataStreaming(inputFile, outputFile, "")
+
+	verifyOutput(t, readOutput(t, outputFile))
+}
+
+func TestPreprocessDataStreaming_withNodeIndex(t *testing.T) {
+	inputFile := createTestInput(t)
+	outputFile := filepath.Join(t.TempDir(), "output.osm.pbf")
+	nodeIndexFile := filepath.Join(t.TempDir(), "nodes.idx")
+
+	PreprocessDataStreaming(inputFile, outputFile, nodeIndexFile)
+
+	verifyOutput(t, readOutput(t, outputFile))
+	if _, err := os.Stat(nodeIndexFile); !os.IsNotExist(err) {
+		t.Errorf("Node index file %s should have been removed", nodeIndexFile)
+	}
+}
+
+func TestPreprocessData_deterministic(t *testing.T) {
+	inputFile := createTestInput(t)
+	firstOutputFile := filepath.Join(t.TempDir(), "first.osm.pbf")
+	secondOutputFile := filepath.Join(t.TempDir(), "second.osm.pbf")
+
+	PreprocessData(inputFile, firstOutputFile, false)
+	PreprocessDataStreaming(inputFile, secondOutputFile, "")
+
+	firstOutput, err := os.ReadFile(firstOutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondOutput, err := os.ReadFile(secondOutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(firstOutput, secondOutput) {
+		t.Errorf("Output files differ")
+	}
+}
+
+func TestPreprocessData_timestamp(t *testing.T) {
+	inputFile := createTestInput(t)
+	outputFile := filepath.Join(t.TempDir(), "output.osm.pbf")
+	timestamp := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	SetTimestamp(timestamp)
+	defer SetTimestamp(time.Time{})
+
+	PreprocessData(inputFile, outputFile, false)
+
+	result := readOutput(t, outputFile)
+	if !result.Nodes[4].Timestamp.Equal(timestamp) {
+		t.Errorf("Expected timestamp %s on generated node but got %s", timestamp, result.Nodes[4].Timestamp)
+	}
+	if !result.Ways[2].Timestamp.Equal(timestamp) {
+		t.Errorf("Expected timestamp %s on generated way but got %s", timestamp, result.Ways[2].Timestamp)
+	}
+	if !result.Ways[0].Timestamp.Equal(inputTimestamp) {
+		t.Errorf("Timestamp of input way should not change but got %s", result.Ways[0].Timestamp)
+	}
+}
+
+func TestPreprocessDataStreaming_multipolygon(t *testing.T) {
+	inputOsm := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lat: 53.0, Lon: 10.0},
+			{ID: 2, Version: 1, Lat: 53.0, Lon: 10.2},
+			{ID: 3, Version: 1, Lat: 53.2, Lon: 10.2},
+			{ID: 4, Version: 1, Lat: 53.2, Lon: 10.0},
+		},
+		Ways: osm.Ways{
+			{ID: 10, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}}},
+			{ID: 11, Version: 1, Nodes: osm.WayNodes{{ID: 3}, {ID: 4}, {ID: 1}}},
+		},
+		Relations: osm.Relations{
+			{ID: 20, Version: 1, Members: osm.Members{
+				{Type: osm.TypeWay, Ref: 10, Role: "outer"},
+				{Type: osm.TypeWay, Ref: 11, Role: "outer"},
+			}, Tags: osm.Tags{
+				{Key: "type", Value: "multipolygon"},
+				{Key: "historic", Value: "castle"},
+			}},
+		},
+	}
+	inputFile := filepath.Join(t.TempDir(), "input.osm.pbf")
+	common.WriteOsmToPbf(inputFile, inputOsm)
+	outputFile := filepath.Join(t.TempDir(), "output.osm.pbf")
+
+	PreprocessDataStreaming(inputFile, outputFile, "")
+
+	result := readOutput(t, outputFile)
+	if len(result.Nodes) != 5 {
+		t.Fatalf("Expected 5 nodes but got %d", len(result.Nodes))
+	}
+	centroidNode := result.Nodes[4]
+	if centroidNode.ID != 200000000200 || centroidNode.Tags.Find("historic") != "castle" || centroidNode.Tags.Find("source:osm_type") != "relation" || centroidNode.Tags.Find("source:osm_id") != "20" {
+		t.Errorf("Wrong centroid node: %#v", centroidNode)
+	}
+	if centroidNode.Lat < 53.09 || centroidNode.Lat > 53.11 || centroidNode.Lon < 10.09 || centroidNode.Lon > 10.11 {
+		t.Errorf("Wrong centroid location: %f, %f", centroidNode.Lon, centroidNode.Lat)
+	}
+}
@@ -0,0 +1,90 @@
+package preprocessor
+
+import (
+	"github.com/hauke96/sigolo"
+	"github.com/paulmach/osm"
+	"math"
+	"strconv"
+	"tool/dem"
+)
+
+const (
+	eleKey        = "ele"
+	prominenceKey = "prominence"
+	isolationKey  = "isolation"
+
+	// Peaks in OSM are usually not exactly at the highest pixel of the DEM, so the highest pixel within this radius in
+	// meters is used as summit.
+	peakSearchRadius = 100
+	// Only terrain within this radius in meters is considered to determine the prominence of saddles.
+	saddleSearchRadius = 5000
+)
+
+// The DEM used to add terrain information to peaks and saddles. No terrain information is added unless LoadDem is called.
+var terrainModel *dem.Dem
+
+// LoadDem reads the given GeoTIFF file, which is then used to add prominence, isolation and missing elevations to
+// peaks and saddles.
+func LoadDem(demFile string) {
+	sigolo.Info("Load DEM from %s", demFile)
+
+	terrain, err := dem.ReadGeoTiff(demFile)
+	sigolo.FatalCheck(err)
+
+	terrainModel = terrain
+}
+
+// addTerrainTags adds the tags "prominence" and "isolation" (both in meters) to peaks and fills missing "ele" tags.
+// Saddles get a "prominence" as well, which is the height of the lower of the two terrain parts next to the saddle. The
+// isolation isn't defined for saddles. Existing tags are not changed. Peaks without higher terrain within the DEM (e.g.
+// the highest peak) get no prominence and isolation, since the DEM only provides lower bounds for them.
+func addTerrainTags(node *osm.Node) {
+	if terrainModel == nil {
+		return
+	}
+
+	natural := node.Tags.Find("natural")
+	if natural != "peak" && natural != "saddle" {
+		return
+	}
+
+	x, y, ok := terrainModel.PixelOf(node.Point())
+	if !ok {
+		return
+	}
+
+	if natural == "peak" {
+		x, y = terrainModel.HighestPixelNear(x, y, peakSearchRadius)
+		if elevation, ok := terrainModel.At(x, y); ok {
+			node.Tags = setMissingTag(node.Tags, eleKey, elevation)
+		}
+		if prominence, ok := terrainModel.Prominence(x, y); ok {
+			node.Tags = setMissingTag(node.Tags, prominenceKey, prominence)
+		} else {
+			sigolo.Debug("Prominence of node %d is unknown, it's at least %.0f m but there's no higher terrain in the DEM", node.ID, prominence)
+		}
+		if isolation, ok := terrainModel.Isolation(x, y); ok {
+			node.Tags = setMissingTag(node.Tags, isolationKey, isolation)
+		} else {
+			sigolo.Debug("Isolation of node %d is unknown, it's at least %.0f m but there's no higher terrain in the DEM", node.ID, isolation)
+		}
+		return
+	}
+
+	if elevation, ok := terrainModel.Elevation(node.Point()); ok {
+		node.Tags = setMissingTag(node.Tags, eleKey, elevation)
+	}
+	if prominence, ok := terrainModel.SaddleProminence(x, y, saddleSearchRadius); ok {
+		node.Tags = setMissingTag(node.Tags, prominenceKey, prominence)
+	} else {
+		sigolo.Debug("Node %d is no saddle according to the DEM", node.ID)
+	}
+}
+
+// setMissingTag sets the given value rounded to whole meters, unless the tag already exists.
+func setMissingTag(tags osm.Tags, key string, value float64) osm.Tags {
+	if tags.Find(key) != "" {
+		return tags
+	}
+	return append(tags, osm.Tag{Key: key, Value: strconv.FormatInt(int64(math.Round(value)), 10)})
+}
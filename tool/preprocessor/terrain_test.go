@@ -0,0 +1,79 @@
+package preprocessor
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"testing"
+	"tool/dem"
+)
+
+func setupTerrainModel(t *testing.T) {
+	// Two peaks (1000 m and 1500 m) connected by a saddle at 700 m, pixels of 0.01°
+	terrainModel = dem.New(5, 3, orb.Bound{Min: orb.Point{10, 47}, Max: orb.Point{10.05, 47.03}}, []float32{
+		100, 500, 100, 500, 100,
+		100, 1000, 700, 1500, 100,
+		100, 500, 100, 500, 100,
+	})
+	t.Cleanup(func() {
+		terrainModel = nil
+	})
+}
+
+func TestTerrain_peak(t *testing.T) {
+	setupTerrainModel(t)
+	// Slightly next to the highest pixel
+	node := &osm.Node{ID: 1, Lon: 10.0149, Lat: 47.0149, Tags: osm.Tags{{Key: "natural", Value: "peak"}}}
+
+	addTerrainTags(node)
+
+	if node.Tags.Find("ele") != "1000" || node.Tags.Find("prominence") != "300" || node.Tags.Find("isolation") == "" {
+		t.Errorf("Wrong tags of peak: %#v", node.Tags)
+	}
+}
+
+func TestTerrain_highestPeak(t *testing.T) {
+	setupTerrainModel(t)
+	node := &osm.Node{ID: 1, Lon: 10.035, Lat: 47.015, Tags: osm.Tags{{Key: "natural", Value: "peak"}}}
+
+	addTerrainTags(node)
+
+	if node.Tags.Find("ele") != "1500" || node.Tags.Find("prominence") != "" || node.Tags.Find("isolation") != "" {
+		t.Errorf("Highest peak should only get an elevation: %#v", node.Tags)
+	}
+}
+
+func TestTerrain_existingTagsKept(t *testing.T) {
+	setupTerrainModel(t)
+	node := &osm.Node{ID: 1, Lon: 10.015, Lat: 47.015, Tags: osm.Tags{
+		{Key: "natural", Value: "peak"},
+		{Key: "ele", Value: "1003"},
+	}}
+
+	addTerrainTags(node)
+
+	if node.Tags.Find("ele") != "1003" || node.Tags.Find("prominence") != "300" {
+		t.Errorf("Wrong tags of peak: %#v", node.Tags)
+	}
+}
+
+func TestTerrain_saddle(t *testing.T) {
+	setupTerrainModel(t)
+	node := &osm.Node{ID: 1, Lon: 10.025, Lat: 47.015, Tags: osm.Tags{{Key: "natural", Value: "saddle"}}}
+
+	addTerrainTags(node)
+
+	if node.Tags.Find("ele") != "700" || node.Tags.Find("prominence") != "300" || node.Tags.Find("isolation") != "" {
+		t.Errorf("Wrong tags of saddle: %#v", node.Tags)
+	}
+}
+
+func TestTerrain_otherNode(t *testing.T) {
+	setupTerrainModel(t)
+	node := &osm.Node{ID: 1, Lon: 10.015, Lat: 47.015, Tags: osm.Tags{{Key: "amenity", Value: "bench"}}}
+
+	addTerrainTags(node)
+
+	if len(node.Tags) != 1 {
+		t.Errorf("Tags should not be changed: %#v", node.Tags)
+	}
+}
@@ -0,0 +1,85 @@
+package relief
+
+import (
+	"errors"
+	"fmt"
+	"github.com/paulmach/orb"
+	"image"
+	"image/color"
+	"math"
+	"tool/dem"
+)
+
+// Encodings of elevation tiles, which store the elevation in the color channels of each pixel.
+const (
+	// EncodingTerrainRgb is used by MapTiler and Mapbox: elevation = -10000 + (R*256*256 + G*256 + B) * 0.1
+	EncodingTerrainRgb = "terrain-rgb"
+	// EncodingTerrarium is used by AWS terrain tiles and Tilezen: elevation = R*256 + G + B/256 - 32768
+	EncodingTerrarium = "terrarium"
+)
+
+// DecodeElevation returns the elevation of a pixel of an elevation tile with the given encoding. Transparent pixels
+// have no data and result in NaN.
+func DecodeElevation(r uint8, g uint8, b uint8, a uint8, encoding string) float64 {
+	if a == 0 {
+		return math.NaN()
+	}
+	if encoding == EncodingTerrarium {
+		return float64(r)*256 + float64(g) + float64(b)/256 - 32768
+	}
+	return -10000 + (float64(r)*256*256+float64(g)*256+float64(b))*0.1
+}
+
+// ElevationTileGrid creates the grid of the tile in the center of the given 3x3 elevation tiles (indexed by row and
+// column). The border pixels are taken from the neighboring tiles. Missing neighbors (nil) result in border pixels
+// without data.
+func ElevationTileGrid(z int, y int, tiles [3][3]image.Image, encoding string) (*Grid, error) {
+	center := tiles[1][1]
+	size := center.Bounds().Dx()
+	if size == 0 || center.Bounds().Dy() != size {
+		return nil, errors.New(fmt.Sprintf("Elevation tiles must be square but have size %v", center.Bounds().Size()))
+	}
+
+	elevations := make([]float64, 0, (size+2)*(size+2))
+	for row := -1; row <= size; row++ {
+		for column := -1; column <= size; column++ {
+			tile := tiles[tileIndex(row, size)][tileIndex(column, size)]
+			if tile == nil || tile.Bounds().Dx() != size || tile.Bounds().Dy() != size {
+				elevations = append(elevations, math.NaN())
+				continue
+			}
+
+			// Pixel within the neighboring tile, e.g. -1 is the last pixel of the western neighbor
+			pixel := tile.At(tile.Bounds().Min.X+(column+size)%size, tile.Bounds().Min.Y+(row+size)%size)
+			// Not premultiplied, since the channels contain the encoded elevation and not a color
+			c := color.NRGBAModel.Convert(pixel).(color.NRGBA)
+			elevations = append(elevations, DecodeElevation(c.R, c.G, c.B, c.A, encoding))
+		}
+	}
+
+	return NewGrid(z, y, size, elevations), nil
+}
+
+// tileIndex returns the index of the tile containing the given pixel, i.e. 0 for border pixels before the tile, 1 for
+// pixels of the tile and 2 for border pixels after the tile.
+func tileIndex(pixel int, size int) int {
+	if pixel < 0 {
+		return 0
+	}
+	if pixel >= size {
+		return 2
+	}
+	return 1
+}
+
+// TilePixelDem returns the grid including its border pixels as DEM whose coordinates are tile pixels instead of
+// longitudes and latitudes: The x coordinate is the column and the y coordinate the negative row, so that the north
+// is still at the top. The upper left corner of the tile is at 0,0 and its lower right corner at size,-size.
+func (g *Grid) TilePixelDem() *dem.Dem {
+	elevations := make([]float32, len(g.elevations))
+	for i, elevation := range g.elevations {
+		elevations[i] = float32(elevation)
+	}
+	bound := orb.Bound{Min: orb.Point{-1, -float64(g.size + 1)}, Max: orb.Point{float64(g.size + 1), 1}}
+	return dem.New(g.size+2, g.size+2, bound, elevations)
+}
@@ -0,0 +1,82 @@
+package relief
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func createTestElevationTile(c color.NRGBA) image.Image {
+	tile := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			tile.SetNRGBA(x, y, c)
+		}
+	}
+	return tile
+}
+
+func TestDecodeElevation(t *testing.T) {
+	// 1000 m is 110000 (0x01adb0) in Terrain-RGB and 33768 (0x83e8) in Terrarium
+	if elevation := DecodeElevation(0x01, 0xad, 0xb0, 255, EncodingTerrainRgb); math.Abs(elevation-1000) > 1e-6 {
+		t.Errorf("Wrong Terrain-RGB elevation %f", elevation)
+	}
+	if elevation := DecodeElevation(0x83, 0xe8, 0x80, 255, EncodingTerrarium); elevation != 1000.5 {
+		t.Errorf("Wrong Terrarium elevation %f", elevation)
+	}
+	if !math.IsNaN(DecodeElevation(0x83, 0xe8, 0x00, 0, EncodingTerrarium)) {
+		t.Errorf("Expected no data for transparent pixels")
+	}
+}
+
+func TestElevationTileGrid(t *testing.T) {
+	// Terrarium tiles with an elevation of 100 m in the center and 200 m in the western neighbor
+	var tiles [3][3]image.Image
+	for row := 1; row < 3; row++ {
+		for column := 0; column < 3; column++ {
+			tiles[row][column] = createTestElevationTile(color.NRGBA{R: 0x80, G: 100, A: 255})
+		}
+	}
+	tiles[1][0] = createTestElevationTile(color.NRGBA{R: 0x80, G: 200, A: 255})
+
+	// Act
+	grid, err := ElevationTileGrid(20, 1<<19, tiles, EncodingTerrarium)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grid.Size() != 2 {
+		t.Errorf("Wrong grid size %d", grid.Size())
+	}
+	if grid.at(0, 0) != 100 || grid.at(1, 1) != 100 {
+		t.Errorf("Wrong elevations in the tile %f and %f", grid.at(0, 0), grid.at(1, 1))
+	}
+	if grid.at(-1, 0) != 200 || grid.at(2, 0) != 100 || grid.at(0, 2) != 100 {
+		t.Errorf("Wrong elevations of the border %f, %f and %f", grid.at(-1, 0), grid.at(2, 0), grid.at(0, 2))
+	}
+	if !math.IsNaN(grid.at(0, -1)) {
+		t.Errorf("Expected no data of missing neighbor")
+	}
+}
+
+func TestTilePixelDem(t *testing.T) {
+	grid := createTestGrid(func(column int, row int) float64 {
+		return float64(row*10 + column)
+	})
+
+	// Act
+	terrain := grid.TilePixelDem()
+
+	// Assert
+	if terrain.Width() != 4 || terrain.Height() != 4 {
+		t.Fatalf("Wrong DEM size %dx%d", terrain.Width(), terrain.Height())
+	}
+	if elevation, _ := terrain.At(2, 1); elevation != 1 {
+		t.Errorf("Wrong elevation %f of tile pixel 1,0", elevation)
+	}
+	if center := terrain.PixelCenter(2, 1); center.X() != 1.5 || center.Y() != -0.5 {
+		t.Errorf("Wrong location %v of tile pixel 1,0", center)
+	}
+}
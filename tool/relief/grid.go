@@ -0,0 +1,97 @@
+package relief
+
+import (
+	"github.com/paulmach/orb"
+	"math"
+	"tool/dem"
+)
+
+// Circumference of the earth at the equator in meters as used by the web mercator projection.
+const earthCircumference = 40_075_016.686
+
+// Grid contains the elevations of the pixels of a web mercator tile. It has one additional pixel at each side, so that
+// the slope of the border pixels of the tile can be determined. Pixels without data are NaN.
+type Grid struct {
+	// Number of pixels of each side of the tile without the additional border pixels
+	size       int
+	elevations []float64
+	// Ground width and height of the pixels of each row (including the border rows) in meters
+	pixelSizes []float64
+}
+
+// NewGrid creates a grid for the given tile with the elevations of (size+2)*(size+2) pixels row by row, starting with
+// the northern border row.
+func NewGrid(z int, y int, size int, elevations []float64) *Grid {
+	grid := &Grid{
+		size:       size,
+		elevations: elevations,
+		pixelSizes: make([]float64, size+2),
+	}
+	for row := range grid.pixelSizes {
+		_, lat := tilePixelToLonLat(z, 0, y, size, 0, row-1)
+		grid.pixelSizes[row] = earthCircumference * math.Cos(lat*math.Pi/180) / (float64(size) * math.Exp2(float64(z)))
+	}
+	return grid
+}
+
+// SampleGrid creates the grid of the given tile from the bilinear interpolated elevations of the DEM.
+func SampleGrid(terrain *dem.Dem, z int, x int, y int, size int) *Grid {
+	elevations := make([]float64, 0, (size+2)*(size+2))
+	for row := -1; row <= size; row++ {
+		for column := -1; column <= size; column++ {
+			lon, lat := tilePixelToLonLat(z, x, y, size, column, row)
+			elevation, ok := terrain.Elevation(orb.Point{lon, lat})
+			if !ok {
+				elevation = math.NaN()
+			}
+			elevations = append(elevations, elevation)
+		}
+	}
+	return NewGrid(z, y, size, elevations)
+}
+
+// Size returns the number of pixels of each side of the tile.
+func (g *Grid) Size() int {
+	return g.size
+}
+
+// at returns the elevation of the given pixel of the tile, where -1 and size are the border pixels.
+func (g *Grid) at(column int, row int) float64 {
+	return g.elevations[(row+1)*(g.size+2)+column+1]
+}
+
+// gradient returns the change of the elevation per meter to the east and to the north at the given pixel using Horn's
+// method. Neighbors without data are replaced by the pixel itself. False is returned for pixels without data.
+func (g *Grid) gradient(column int, row int) (float64, float64, bool) {
+	center := g.at(column, row)
+	if math.IsNaN(center) {
+		return 0, 0, false
+	}
+
+	var e [3][3]float64
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			elevation := g.at(column+dx, row+dy)
+			if math.IsNaN(elevation) {
+				elevation = center
+			}
+			e[dy+1][dx+1] = elevation
+		}
+	}
+
+	pixelSize := g.pixelSizes[row+1]
+	east := ((e[0][2] + 2*e[1][2] + e[2][2]) - (e[0][0] + 2*e[1][0] + e[2][0])) / (8 * pixelSize)
+	north := ((e[0][0] + 2*e[0][1] + e[0][2]) - (e[2][0] + 2*e[2][1] + e[2][2])) / (8 * pixelSize)
+	return east, north, true
+}
+
+// tilePixelToLonLat returns the location of the center of the given pixel of a web mercator tile.
+func tilePixelToLonLat(z int, x int, y int, size int, column int, row int) (float64, float64) {
+	numberOfTiles := math.Exp2(float64(z))
+	tileX := float64(x) + (float64(column)+0.5)/float64(size)
+	tileY := float64(y) + (float64(row)+0.5)/float64(size)
+
+	lon := tileX/numberOfTiles*360 - 180
+	lat := math.Atan(math.Sinh(math.Pi*(1-2*tileY/numberOfTiles))) * 180 / math.Pi
+	return lon, lat
+}
@@ -0,0 +1,102 @@
+package relief
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// HillshadeOptions define the light and the exaggeration of the terrain.
+type HillshadeOptions struct {
+	// Direction of the light in degrees clockwise from north
+	Azimuth float64
+	// Angle of the light above the horizon in degrees
+	Altitude float64
+	// Exaggeration of the elevations
+	ZFactor float64
+	// Combine the light of four directions around the azimuth (like "gdaldem hillshade -multidirectional"), so that
+	// slopes facing away from the light are not completely dark.
+	Multidirectional bool
+	// Additionally darken steep slopes, from 0 (disabled) to 1 (vertical slopes are black).
+	SlopeShading float64
+}
+
+// Validate returns an error if one of the options is out of range.
+func (o HillshadeOptions) Validate() error {
+	if o.Altitude < 0 || o.Altitude > 90 {
+		return errors.New(fmt.Sprintf("Invalid altitude %f, it must be between 0 and 90", o.Altitude))
+	}
+	if o.ZFactor <= 0 {
+		return errors.New(fmt.Sprintf("Invalid z-factor %f, it must be greater than 0", o.ZFactor))
+	}
+	if o.SlopeShading < 0 || o.SlopeShading > 1 {
+		return errors.New(fmt.Sprintf("Invalid slope shading %f, it must be between 0 and 1", o.SlopeShading))
+	}
+	return nil
+}
+
+// Hillshade creates a grayscale image of the illuminated terrain of the grid. Pixels without data are transparent.
+func Hillshade(grid *Grid, options HillshadeOptions) *image.NRGBA {
+	result := image.NewNRGBA(image.Rect(0, 0, grid.size, grid.size))
+
+	for row := 0; row < grid.size; row++ {
+		for column := 0; column < grid.size; column++ {
+			east, north, ok := grid.gradient(column, row)
+			if !ok {
+				continue
+			}
+
+			shade := illumination(east*options.ZFactor, north*options.ZFactor, options)
+			gray := uint8(math.Round(255 * math.Max(0, math.Min(1, shade))))
+			result.SetNRGBA(column, row, color.NRGBA{R: gray, G: gray, B: gray, A: 255})
+		}
+	}
+
+	return result
+}
+
+// illumination returns the brightness (0 to 1) of a pixel with the given (already exaggerated) gradient.
+func illumination(east float64, north float64, options HillshadeOptions) float64 {
+	var shade float64
+	if !options.Multidirectional {
+		shade = directionalIllumination(east, north, options.Azimuth, options.Altitude)
+	} else {
+		// Each light is weighted by how much the slope faces towards or away from it, which is the squared gradient in
+		// the direction of the light. The weights of all four lights sum up to twice the squared gradient.
+		squaredGradient := east*east + north*north
+		if squaredGradient == 0 {
+			shade = directionalIllumination(0, 0, options.Azimuth, options.Altitude)
+		} else {
+			for _, azimuth := range []float64{options.Azimuth - 90, options.Azimuth - 45, options.Azimuth, options.Azimuth + 45} {
+				azimuthRadians := azimuth * math.Pi / 180
+				gradientInLightDirection := east*math.Sin(azimuthRadians) + north*math.Cos(azimuthRadians)
+				weight := gradientInLightDirection * gradientInLightDirection / (2 * squaredGradient)
+				shade += weight * directionalIllumination(east, north, azimuth, options.Altitude)
+			}
+		}
+	}
+
+	if options.SlopeShading > 0 {
+		slope := math.Atan(math.Sqrt(east*east + north*north))
+		shade *= 1 - options.SlopeShading*slope/(math.Pi/2)
+	}
+
+	return shade
+}
+
+// directionalIllumination returns the cosine of the angle between the surface normal and the light from the given
+// direction, which is 0 for surfaces facing away from the light.
+func directionalIllumination(east float64, north float64, azimuth float64, altitude float64) float64 {
+	azimuthRadians := azimuth * math.Pi / 180
+	altitudeRadians := altitude * math.Pi / 180
+
+	lightEast := math.Sin(azimuthRadians) * math.Cos(altitudeRadians)
+	lightNorth := math.Cos(azimuthRadians) * math.Cos(altitudeRadians)
+	lightUp := math.Sin(altitudeRadians)
+
+	// The normal of the surface is (-east, -north, 1)
+	normalLength := math.Sqrt(east*east + north*north + 1)
+	return math.Max(0, (-east*lightEast-north*lightNorth+lightUp)/normalLength)
+}
@@ -0,0 +1,118 @@
+package relief
+
+import (
+	"github.com/paulmach/orb"
+	"math"
+	"testing"
+	"tool/dem"
+)
+
+// createTestGrid creates a grid of 2x2 pixels at the equator with the given elevations including the border pixels.
+func createTestGrid(elevation func(column int, row int) float64) *Grid {
+	var elevations []float64
+	for row := -1; row <= 2; row++ {
+		for column := -1; column <= 2; column++ {
+			elevations = append(elevations, elevation(column, row))
+		}
+	}
+	// The tile 20/0/524288 is at the equator with pixels of ~0.15 m
+	return NewGrid(20, 1<<19, 2, elevations)
+}
+
+func TestHillshade_flat(t *testing.T) {
+	grid := createTestGrid(func(column int, row int) float64 {
+		return 100
+	})
+
+	// Act
+	result := Hillshade(grid, HillshadeOptions{Azimuth: 315, Altitude: 60, ZFactor: 1})
+
+	// Assert
+	expected := uint8(math.Round(255 * math.Sin(60*math.Pi/180)))
+	if result.NRGBAAt(0, 0).R != expected || result.NRGBAAt(1, 1).A != 255 {
+		t.Errorf("Expected gray value %d but got %v", expected, result.NRGBAAt(0, 0))
+	}
+}
+
+func TestHillshade_slopeFacingLight(t *testing.T) {
+	// Rising to the east by one pixel size per pixel, so the slope is 45° and faces west
+	grid := createTestGrid(func(column int, row int) float64 {
+		return float64(column) * grid0PixelSize()
+	})
+
+	// Act
+	litByWest := Hillshade(grid, HillshadeOptions{Azimuth: 270, Altitude: 45, ZFactor: 1})
+	litByEast := Hillshade(grid, HillshadeOptions{Azimuth: 90, Altitude: 45, ZFactor: 1})
+	multidirectional := Hillshade(grid, HillshadeOptions{Azimuth: 90, Altitude: 45, ZFactor: 1, Multidirectional: true})
+	slopeShaded := Hillshade(grid, HillshadeOptions{Azimuth: 270, Altitude: 45, ZFactor: 1, SlopeShading: 1})
+
+	// Assert
+	if litByWest.NRGBAAt(0, 0).R != 255 {
+		t.Errorf("Slope facing the light should be white but was %v", litByWest.NRGBAAt(0, 0))
+	}
+	if litByEast.NRGBAAt(0, 0).R != 0 {
+		t.Errorf("Slope facing away from the light should be black but was %v", litByEast.NRGBAAt(0, 0))
+	}
+	if multidirectional.NRGBAAt(0, 0).R == 0 {
+		t.Errorf("Slope facing away from the main light should be lit by the other lights")
+	}
+	if gray := slopeShaded.NRGBAAt(0, 0).R; gray != 127 && gray != 128 {
+		t.Errorf("Slope of 45° should be darkened by half but was %v", slopeShaded.NRGBAAt(0, 0))
+	}
+}
+
+func TestHillshade_noData(t *testing.T) {
+	grid := createTestGrid(func(column int, row int) float64 {
+		if column == 0 && row == 0 {
+			return math.NaN()
+		}
+		return 100
+	})
+
+	// Act
+	result := Hillshade(grid, HillshadeOptions{Azimuth: 315, Altitude: 45, ZFactor: 1})
+
+	// Assert
+	if result.NRGBAAt(0, 0).A != 0 {
+		t.Errorf("Pixel without data should be transparent")
+	}
+	if result.NRGBAAt(1, 0).A != 255 {
+		t.Errorf("Neighbor of pixel without data should not be transparent")
+	}
+}
+
+func TestSampleGrid(t *testing.T) {
+	// DEM covering the western half of the tile 1/0/0
+	terrain := dem.New(2, 1, orb.Bound{Min: orb.Point{-180, 0}, Max: orb.Point{-90, 85}}, []float32{100, 200})
+
+	// Act
+	grid := SampleGrid(terrain, 1, 0, 0, 4)
+
+	// Assert
+	if grid.Size() != 4 || len(grid.elevations) != 36 {
+		t.Fatalf("Wrong grid size %d with %d elevations", grid.Size(), len(grid.elevations))
+	}
+	if grid.at(0, 3) != 100 || grid.at(1, 3) != 200 {
+		t.Errorf("Wrong elevations %f and %f", grid.at(0, 3), grid.at(1, 3))
+	}
+	if !math.IsNaN(grid.at(3, 3)) {
+		t.Errorf("Expected no data outside the DEM")
+	}
+}
+
+func TestHillshadeOptions_Validate(t *testing.T) {
+	if (HillshadeOptions{Azimuth: 315, Altitude: 45, ZFactor: 1}).Validate() != nil {
+		t.Errorf("Valid options should not return an error")
+	}
+	if (HillshadeOptions{Azimuth: 315, Altitude: 45, ZFactor: 0}).Validate() == nil {
+		t.Errorf("Expected error for z-factor 0")
+	}
+	if (HillshadeOptions{Azimuth: 315, Altitude: 95, ZFactor: 1}).Validate() == nil {
+		t.Errorf("Expected error for altitude above 90°")
+	}
+}
+
+// grid0PixelSize returns the pixel size of the rows of the test grid in meters.
+func grid0PixelSize() float64 {
+	return createTestGrid(func(int, int) float64 { return 0 }).pixelSizes[1]
+}
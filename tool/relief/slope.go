@@ -0,0 +1,91 @@
+package relief
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultSlopePalette contains the slope classes of avalanche maps: 30° to 35° (yellow), 35° to 40° (orange), 40° to
+// 45° (red) and steeper (purple).
+const DefaultSlopePalette = "30:#f0e100,35:#ff9900,40:#ff0000,45:#a600ff"
+
+// SlopeClass is a range of slope angles drawn in the same color. The range ends at the minimum angle of the next class.
+type SlopeClass struct {
+	// Minimum slope angle in degrees
+	MinAngle float64
+	Color    color.NRGBA
+}
+
+// ParseSlopePalette parses a comma separated list of slope classes of the form "<min-angle>:<color>", e.g.
+// "30:#f0e100,35:#ff9900". Colors are given as "#rrggbb" or "#rrggbbaa". The classes are sorted by their minimum angle.
+func ParseSlopePalette(palette string) ([]SlopeClass, error) {
+	var classes []SlopeClass
+	for _, entry := range strings.Split(palette, ",") {
+		angleAndColor := strings.Split(strings.TrimSpace(entry), ":")
+		if len(angleAndColor) != 2 {
+			return nil, errors.New(fmt.Sprintf("Invalid slope class '%s', it must have the form <min-angle>:<color>", entry))
+		}
+
+		angle, err := strconv.ParseFloat(angleAndColor[0], 64)
+		if err != nil || angle < 0 || angle > 90 {
+			return nil, errors.New(fmt.Sprintf("Invalid angle '%s' of slope class, it must be a number between 0 and 90", angleAndColor[0]))
+		}
+
+		classColor, err := parseColor(angleAndColor[1])
+		if err != nil {
+			return nil, err
+		}
+
+		classes = append(classes, SlopeClass{MinAngle: angle, Color: classColor})
+	}
+
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i].MinAngle < classes[j].MinAngle
+	})
+	return classes, nil
+}
+
+func parseColor(value string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	rgba, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 || !strings.HasPrefix(value, "#") {
+		return color.NRGBA{}, errors.New(fmt.Sprintf("Invalid color '%s', it must have the form #rrggbb or #rrggbbaa", value))
+	}
+
+	return color.NRGBA{R: uint8(rgba >> 24), G: uint8(rgba >> 16), B: uint8(rgba >> 8), A: uint8(rgba)}, nil
+}
+
+// Slope creates an image with the color of the slope class of each pixel. Pixels flatter than the first class and
+// pixels without data are transparent.
+func Slope(grid *Grid, palette []SlopeClass) *image.NRGBA {
+	result := image.NewNRGBA(image.Rect(0, 0, grid.size, grid.size))
+
+	for row := 0; row < grid.size; row++ {
+		for column := 0; column < grid.size; column++ {
+			east, north, ok := grid.gradient(column, row)
+			if !ok {
+				continue
+			}
+
+			angle := math.Atan(math.Sqrt(east*east+north*north)) * 180 / math.Pi
+			for i := len(palette) - 1; i >= 0; i-- {
+				if angle >= palette[i].MinAngle {
+					result.SetNRGBA(column, row, palette[i].Color)
+					break
+				}
+			}
+		}
+	}
+
+	return result
+}
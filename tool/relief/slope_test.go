@@ -0,0 +1,55 @@
+package relief
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseSlopePalette(t *testing.T) {
+	// Act
+	palette, err := ParseSlopePalette("35:#ff9900, 30:#f0e10080")
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(palette) != 2 || palette[0].MinAngle != 30 || palette[1].MinAngle != 35 {
+		t.Fatalf("Wrong classes %v", palette)
+	}
+	if palette[0].Color != (color.NRGBA{R: 0xf0, G: 0xe1, B: 0x00, A: 0x80}) || palette[1].Color != (color.NRGBA{R: 0xff, G: 0x99, B: 0x00, A: 0xff}) {
+		t.Errorf("Wrong colors %v", palette)
+	}
+
+	for _, invalidPalette := range []string{"30", "95:#ff0000", "30:ff0000", "30:#ff00", "30:#gg0000"} {
+		_, err = ParseSlopePalette(invalidPalette)
+		if err == nil {
+			t.Errorf("Expected error for palette %s", invalidPalette)
+		}
+	}
+}
+
+func TestSlope(t *testing.T) {
+	palette, err := ParseSlopePalette(DefaultSlopePalette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rising to the east by 0.9 pixel sizes per pixel, which is a slope of 42°
+	steepGrid := createTestGrid(func(column int, row int) float64 {
+		return float64(column) * 0.9 * grid0PixelSize()
+	})
+	flatGrid := createTestGrid(func(column int, row int) float64 {
+		return 100
+	})
+
+	// Act
+	steepResult := Slope(steepGrid, palette)
+	flatResult := Slope(flatGrid, palette)
+
+	// Assert
+	if steepResult.NRGBAAt(0, 0) != palette[2].Color {
+		t.Errorf("Expected color %v of 40° class but got %v", palette[2].Color, steepResult.NRGBAAt(0, 0))
+	}
+	if flatResult.NRGBAAt(0, 0).A != 0 {
+		t.Errorf("Flat pixel should be transparent but was %v", flatResult.NRGBAAt(0, 0))
+	}
+}
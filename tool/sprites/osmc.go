@@ -0,0 +1,194 @@
+package sprites
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Size of the generated symbols in pixels
+const symbolSize = 20
+
+var osmcColors = map[string]string{
+	"black":  "#000000",
+	"blue":   "#1f4fcc",
+	"brown":  "#8b4513",
+	"gray":   "#808080",
+	"green":  "#1e9e3a",
+	"orange": "#ff8c00",
+	"purple": "#800080",
+	"red":    "#dd0000",
+	"white":  "#ffffff",
+	"yellow": "#ffd700",
+}
+
+// SVG elements of the supported foreground symbols. The "%[1]s" placeholder is replaced by the color.
+var osmcForegrounds = map[string]string{
+	"arch":            `<path d="M 4,16 V 9 A 6,6 0 0 1 16,9 V 16 H 12.5 V 9 A 2.5,2.5 0 0 0 7.5,9 V 16 Z" fill="%[1]s"/>`,
+	"backslash":       `<path d="M 0,0 H 5 L 20,15 V 20 H 15 L 0,5 Z" fill="%[1]s"/>`,
+	"bar":             `<rect x="0" y="7" width="20" height="6" fill="%[1]s"/>`,
+	"circle":          `<circle cx="10" cy="10" r="5.5" fill="none" stroke="%[1]s" stroke-width="2.5"/>`,
+	"corner":          `<path d="M 0,0 H 14 L 0,14 Z" fill="%[1]s"/>`,
+	"cross":           `<path d="M 8.5,2 H 11.5 V 8.5 H 18 V 11.5 H 11.5 V 18 H 8.5 V 11.5 H 2 V 8.5 H 8.5 Z" fill="%[1]s"/>`,
+	"diamond":         `<path d="M 10,3 L 17,10 L 10,17 L 3,10 Z" fill="%[1]s"/>`,
+	"diamond_left":    `<path d="M 10,3 L 10,17 L 3,10 Z" fill="%[1]s"/>`,
+	"diamond_line":    `<path d="M 10,4 L 16,10 L 10,16 L 4,10 Z" fill="none" stroke="%[1]s" stroke-width="2"/>`,
+	"diamond_right":   `<path d="M 10,3 L 17,10 L 10,17 Z" fill="%[1]s"/>`,
+	"dot":             `<circle cx="10" cy="10" r="5.5" fill="%[1]s"/>`,
+	"fork":            `<path d="M 8.5,20 V 11 L 2,4.5 4.1,2.4 10,8.3 15.9,2.4 18,4.5 11.5,11 V 20 Z" fill="%[1]s"/>`,
+	"hexagon":         `<path d="M 6,3 H 14 L 18,10 L 14,17 H 6 L 2,10 Z" fill="%[1]s"/>`,
+	"L":               `<path d="M 5,3 H 9 V 13 H 16 V 17 H 5 Z" fill="%[1]s"/>`,
+	"lower":           `<rect x="0" y="10" width="20" height="10" fill="%[1]s"/>`,
+	"pointer":         `<path d="M 3,3 L 17,10 L 3,17 Z" fill="%[1]s"/>`,
+	"rectangle":       `<rect x="4" y="4" width="12" height="12" fill="%[1]s"/>`,
+	"rectangle_line":  `<rect x="5" y="5" width="10" height="10" fill="none" stroke="%[1]s" stroke-width="2"/>`,
+	"slash":           `<path d="M 20,0 V 5 L 5,20 H 0 V 15 L 15,0 Z" fill="%[1]s"/>`,
+	"stripe":          `<rect x="7" y="0" width="6" height="20" fill="%[1]s"/>`,
+	"triangle":        `<path d="M 10,3 L 17,16 H 3 Z" fill="%[1]s"/>`,
+	"triangle_line":   `<path d="M 10,5 L 15.5,15 H 4.5 Z" fill="none" stroke="%[1]s" stroke-width="2"/>`,
+	"triangle_turned": `<path d="M 3,4 H 17 L 10,17 Z" fill="%[1]s"/>`,
+	"turned_T":        `<path d="M 8.5,3 H 11.5 V 14 H 17 V 17 H 3 V 14 H 8.5 Z" fill="%[1]s"/>`,
+	"x":               `<path d="M 2,4.1 4.1,2 10,7.9 15.9,2 18,4.1 12.1,10 18,15.9 15.9,18 10,12.1 4.1,18 2,15.9 7.9,10 Z" fill="%[1]s"/>`,
+}
+
+// osmcSymbol is a parsed "osmc:symbol" value of the form
+// "waycolor:background[:foreground][:foreground2][:text:textcolor]". See
+// https://wiki.openstreetmap.org/wiki/Key:osmc:symbol for details.
+type osmcSymbol struct {
+	value           string
+	wayColor        string
+	backgroundColor string
+	// Empty for a filled square, otherwise "circle", "frame" or "round"
+	backgroundShape string
+	foregrounds     []osmcForeground
+	text            string
+	textColor       string
+}
+
+type osmcForeground struct {
+	color  string
+	symbol string
+}
+
+func parseOsmcSymbol(value string) (*osmcSymbol, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 {
+		return nil, errors.New(fmt.Sprintf("Symbol '%s' has no background", value))
+	}
+
+	symbol := &osmcSymbol{
+		value:    value,
+		wayColor: parts[0],
+	}
+	if _, ok := osmcColors[symbol.wayColor]; !ok {
+		return nil, errors.New(fmt.Sprintf("Unknown way color '%s' in symbol '%s'", symbol.wayColor, value))
+	}
+
+	if parts[1] != "" {
+		color, shape, _ := strings.Cut(parts[1], "_")
+		if _, ok := osmcColors[color]; !ok {
+			return nil, errors.New(fmt.Sprintf("Unknown background color '%s' in symbol '%s'", color, value))
+		}
+		if shape != "" && shape != "circle" && shape != "frame" && shape != "round" {
+			return nil, errors.New(fmt.Sprintf("Unknown background shape '%s' in symbol '%s'", shape, value))
+		}
+		symbol.backgroundColor = color
+		symbol.backgroundShape = shape
+	}
+
+	foregroundParts := parts[2:]
+	if len(parts) >= 5 {
+		// The last two parts are text and text color
+		symbol.text = parts[len(parts)-2]
+		symbol.textColor = parts[len(parts)-1]
+		if _, ok := osmcColors[symbol.textColor]; !ok {
+			return nil, errors.New(fmt.Sprintf("Unknown text color '%s' in symbol '%s'", symbol.textColor, value))
+		}
+		foregroundParts = parts[2 : len(parts)-2]
+	}
+	if len(foregroundParts) > 2 {
+		return nil, errors.New(fmt.Sprintf("Too many foregrounds in symbol '%s'", value))
+	}
+
+	for _, foregroundPart := range foregroundParts {
+		if foregroundPart == "" {
+			continue
+		}
+
+		color, foregroundSymbol, _ := strings.Cut(foregroundPart, "_")
+		if _, ok := osmcColors[color]; !ok {
+			return nil, errors.New(fmt.Sprintf("Unknown foreground color '%s' in symbol '%s'", color, value))
+		}
+		symbol.foregrounds = append(symbol.foregrounds, osmcForeground{color: color, symbol: foregroundSymbol})
+	}
+
+	return symbol, nil
+}
+
+// unsupportedForegrounds returns the foregrounds that can't be rendered (e.g. pictograms like "hiker" or "shell").
+func (s *osmcSymbol) unsupportedForegrounds() []string {
+	var result []string
+	for _, foreground := range s.foregrounds {
+		if _, ok := osmcForegrounds[foreground.symbol]; !ok {
+			result = append(result, foreground.symbol)
+		}
+	}
+	return result
+}
+
+// toSvg renders the background, the supported foregrounds and the text of the symbol. The way color is not part of the
+// symbol.
+func (s *osmcSymbol) toSvg() string {
+	builder := &strings.Builder{}
+	builder.WriteString(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<svg width="%[1]d" height="%[1]d" viewBox="0 0 20 20" version="1.1" xmlns="http://www.w3.org/2000/svg">
+    <!-- osmc:symbol=%[2]s -->
+`, symbolSize, html.EscapeString(s.value)))
+
+	if s.backgroundColor != "" {
+		color := osmcColors[s.backgroundColor]
+		switch s.backgroundShape {
+		case "":
+			builder.WriteString(fmt.Sprintf(`    <rect x="0" y="0" width="20" height="20" fill="%s"/>`+"\n", color))
+		case "circle":
+			builder.WriteString(fmt.Sprintf(`    <circle cx="10" cy="10" r="8.5" fill="#ffffff" stroke="%s" stroke-width="3"/>`+"\n", color))
+		case "frame":
+			builder.WriteString(fmt.Sprintf(`    <rect x="1.5" y="1.5" width="17" height="17" fill="#ffffff" stroke="%s" stroke-width="3"/>`+"\n", color))
+		case "round":
+			builder.WriteString(fmt.Sprintf(`    <circle cx="10" cy="10" r="10" fill="%s"/>`+"\n", color))
+		}
+	}
+
+	for _, foreground := range s.foregrounds {
+		if svgElement, ok := osmcForegrounds[foreground.symbol]; ok {
+			builder.WriteString("    " + fmt.Sprintf(svgElement, osmcColors[foreground.color]) + "\n")
+		}
+	}
+
+	if s.text != "" {
+		fontSize := 11.0
+		if len([]rune(s.text)) > 2 {
+			fontSize = 22.0 / float64(len([]rune(s.text)))
+		}
+		builder.WriteString(fmt.Sprintf(`    <text x="10" y="10" dy="0.35em" text-anchor="middle" font-family="sans-serif" font-weight="bold" font-size="%.1f" fill="%s">%s</text>`+"\n", fontSize, osmcColors[s.textColor], html.EscapeString(s.text)))
+	}
+
+	builder.WriteString("</svg>\n")
+	return builder.String()
+}
+
+// fileName returns a readable file name without extension for the symbol, e.g. "osmc-red-white-red_bar". Characters
+// not allowed in file names are replaced by "_".
+func (s *osmcSymbol) fileName() string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r == ':':
+			return '-'
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, s.value)
+	return "osmc-" + name
+}
@@ -0,0 +1,117 @@
+package sprites
+
+import (
+	"encoding/xml"
+	"github.com/paulmach/osm"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tool/common"
+)
+
+func TestParseOsmcSymbol(t *testing.T) {
+	symbol, err := parseOsmcSymbol("red:white_frame:red_bar:blue_dot:E1:black")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if symbol.wayColor != "red" || symbol.backgroundColor != "white" || symbol.backgroundShape != "frame" {
+		t.Errorf("Wrong way color or background: %#v", symbol)
+	}
+	if len(symbol.foregrounds) != 2 || symbol.foregrounds[0].symbol != "bar" || symbol.foregrounds[1].color != "blue" {
+		t.Errorf("Wrong foregrounds: %#v", symbol.foregrounds)
+	}
+	if symbol.text != "E1" || symbol.textColor != "black" {
+		t.Errorf("Wrong text: %#v", symbol)
+	}
+}
+
+func TestParseOsmcSymbol_withoutForeground(t *testing.T) {
+	symbol, err := parseOsmcSymbol("blue:yellow_round::42:blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(symbol.foregrounds) != 0 || symbol.text != "42" || symbol.backgroundShape != "round" {
+		t.Errorf("Wrong symbol: %#v", symbol)
+	}
+}
+
+func TestParseOsmcSymbol_invalidSymbols(t *testing.T) {
+	invalidSymbols := []string{
+		"red",
+		"pink:white:red_bar",
+		"red:white_star:red_bar",
+		"red:white:pink_bar",
+		"red:white:red_bar:E1:pink",
+	}
+
+	for _, value := range invalidSymbols {
+		_, err := parseOsmcSymbol(value)
+		if err == nil {
+			t.Errorf("Expected error for symbol %s", value)
+		}
+	}
+}
+
+func TestGenerateOsmcSprites(t *testing.T) {
+	routeTags := func(symbol string) osm.Tags {
+		return osm.Tags{
+			{Key: "type", Value: "route"},
+			{Key: "route", Value: "hiking"},
+			{Key: "osmc:symbol", Value: symbol},
+		}
+	}
+	inputOsm := &osm.OSM{
+		Nodes: osm.Nodes{{ID: 1, Version: 1, Lat: 53.0, Lon: 10.0}},
+		Relations: osm.Relations{
+			{ID: 20, Version: 1, Tags: routeTags("red:white:red_bar")},
+			{ID: 21, Version: 1, Tags: routeTags("red:white:red_bar")},
+			{ID: 22, Version: 1, Tags: routeTags("yellow:white:yellow_hiker:<&>:black")},
+			{ID: 23, Version: 1, Tags: routeTags("invalid")},
+			{ID: 24, Version: 1, Tags: osm.Tags{{Key: "type", Value: "route"}, {Key: "route", Value: "bicycle"}, {Key: "osmc:symbol", Value: "blue:white:blue_bar"}}},
+		},
+	}
+	inputFile := filepath.Join(t.TempDir(), "input.osm.pbf")
+	common.WriteOsmToPbf(inputFile, inputOsm)
+	spritesFolder := t.TempDir()
+
+	// Act
+	err := GenerateOsmcSprites(inputFile, spritesFolder)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapping, err := os.ReadFile(filepath.Join(spritesFolder, osmcMappingFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedMapping := `osmc_symbol,file,waycolor,routes
+red:white:red_bar,osmc-red-white-red_bar.svg,red,2
+yellow:white:yellow_hiker:<&>:black,osmc-yellow-white-yellow_hiker-___-black.svg,yellow,1
+`
+	if string(mapping) != expectedMapping {
+		t.Errorf("Wrong mapping table:\n%s", string(mapping))
+	}
+
+	for _, fileName := range []string{"osmc-red-white-red_bar.svg", "osmc-yellow-white-yellow_hiker-___-black.svg"} {
+		svg, err := os.ReadFile(filepath.Join(spritesFolder, fileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoder := xml.NewDecoder(strings.NewReader(string(svg)))
+		for {
+			_, err = decoder.Token()
+			if err != nil {
+				break
+			}
+		}
+		if err.Error() != "EOF" {
+			t.Errorf("Invalid SVG file %s: %s", fileName, err.Error())
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package sprites
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/hauke96/sigolo"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"tool/common"
+)
+
+// The mapping table from symbol values to SVG files within the sprites folder.
+const osmcMappingFileName = "osmc-symbols.csv"
+
+// GenerateOsmcSprites creates one SVG file for each distinct "osmc:symbol" of the hiking routes in the given OSM-PBF
+// file. Additionally, a CSV mapping table with the columns "osmc_symbol", "file", "waycolor" and "routes" (number of
+// routes using the symbol) is written into the sprites folder. Symbols that can't be parsed (e.g. because of unknown
+// colors) are skipped and logged.
+func GenerateOsmcSprites(inputFile string, spritesFolder string) error {
+	symbolValues, err := collectOsmcSymbols(inputFile)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(spritesFolder, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	var values []string
+	for value := range symbolValues {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	mappingFile, err := os.Create(filepath.Join(spritesFolder, osmcMappingFileName))
+	if err != nil {
+		return err
+	}
+	defer mappingFile.Close()
+
+	mappingWriter := csv.NewWriter(mappingFile)
+	err = mappingWriter.Write([]string{"osmc_symbol", "file", "waycolor", "routes"})
+	if err != nil {
+		return err
+	}
+
+	usedFileNames := map[string]bool{}
+	numberOfInvalidSymbols := 0
+	for _, value := range values {
+		symbol, err := parseOsmcSymbol(value)
+		if err != nil {
+			sigolo.Debug("Skip symbol: %s", err.Error())
+			numberOfInvalidSymbols++
+			continue
+		}
+
+		if unsupportedForegrounds := symbol.unsupportedForegrounds(); len(unsupportedForegrounds) > 0 {
+			sigolo.Debug("Foregrounds %v of symbol '%s' are not supported and therefore not part of the SVG", unsupportedForegrounds, value)
+		}
+
+		// Different values might result in the same file name, e.g. when they contain special characters
+		fileName := symbol.fileName() + ".svg"
+		for i := 2; usedFileNames[fileName]; i++ {
+			fileName = fmt.Sprintf("%s-%d.svg", symbol.fileName(), i)
+		}
+		usedFileNames[fileName] = true
+
+		err = os.WriteFile(filepath.Join(spritesFolder, fileName), []byte(symbol.toSvg()), 0644)
+		if err != nil {
+			return err
+		}
+
+		err = mappingWriter.Write([]string{value, fileName, symbol.wayColor, strconv.Itoa(symbolValues[value])})
+		if err != nil {
+			return err
+		}
+	}
+
+	mappingWriter.Flush()
+	err = mappingWriter.Error()
+	if err != nil {
+		return err
+	}
+
+	sigolo.Info("Wrote %d symbols and mapping table %s into %s", len(usedFileNames), osmcMappingFileName, spritesFolder)
+	if numberOfInvalidSymbols > 0 {
+		sigolo.Info("Skipped %d invalid or unsupported symbols", numberOfInvalidSymbols)
+	}
+
+	return nil
+}
+
+// collectOsmcSymbols returns all distinct "osmc:symbol" values of hiking routes with the number of routes using them.
+func collectOsmcSymbols(inputFile string) (map[string]int, error) {
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := osmpbf.New(context.Background(), f, 1)
+	defer scanner.Close()
+	scanner.SkipNodes = true
+	scanner.SkipWays = true
+
+	symbolValues := map[string]int{}
+	for scanner.Scan() {
+		relation, ok := scanner.Object().(*osm.Relation)
+		if !ok || !common.IsHikingRoute(relation) {
+			continue
+		}
+
+		value := relation.Tags.Find("osmc:symbol")
+		if value != "" {
+			symbolValues[value]++
+		}
+	}
+
+	return symbolValues, scanner.Err()
+}
@@ -1,13 +1,16 @@
 package tile_proxy
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/hauke96/sigolo"
+	"golang.org/x/sync/singleflight"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 func getTile(z, x, y, cacheKey, remoteFormat, cacheBaseFolder string, log *logger) []byte {
@@ -26,23 +29,146 @@ func getTile(z, x, y, cacheKey, remoteFormat, cacheBaseFolder string, log *logge
 		return nil
 	}
 
+	// The modification time is the time of the last use, so that the least recently used tiles can be removed, see
+	// PruneCache.
+	now := time.Now()
+	err = os.Chtimes(imageFilePath, now, now)
+	if err != nil {
+		log.Debug("Error updating last use of cached image file %s: %s", imageFilePath, err.Error())
+	}
+
 	return fileContent
 }
 
+// getCachedTile returns the cached tile and its format. All given formats are tried, since the format of remote tiles
+// might only be known after they have been loaded. Nil is returned when the tile is not cached in any of the formats.
+func getCachedTile(z, x, y, cacheKey string, formats []string, cacheBaseFolder string, log *logger) ([]byte, string) {
+	for _, format := range formats {
+		tileBytes := getTile(z, x, y, cacheKey, format, cacheBaseFolder, log)
+		if tileBytes != nil {
+			return tileBytes, format
+		}
+	}
+	return nil, ""
+}
+
+// cacheTile writes the tile into the cache. The tile is written into a temporary file first, which is then renamed, so
+// that concurrent requests never read partially written tiles.
 func cacheTile(z, x, y, cacheKey, remoteFormat, cacheBaseFolder string, image []byte) error {
 	cachePath := filepath.Join(cacheBaseFolder, cacheKey)
 
 	imageFolder := ensureFolderExists(z, x, cachePath)
 	imageFilePath := filepath.Join(imageFolder, y+"."+remoteFormat)
 
-	err := os.WriteFile(imageFilePath, image, 0644)
+	tempFile, err := os.CreateTemp(imageFolder, y+"."+remoteFormat+".*.tmp")
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error creating temporary file for %s: %s", imageFilePath, err.Error()))
+	}
+
+	_, err = tempFile.Write(image)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempFile.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), imageFilePath)
+	}
 	if err != nil {
+		os.Remove(tempFile.Name())
 		return errors.New(fmt.Sprintf("Error writing image file to %s: %s", imageFilePath, err.Error()))
 	}
 
 	return nil
 }
 
+// The extension of the metadata files of cached tiles, which are stored next to the tiles (e.g. "3.png.meta").
+const metadataExtension = "meta"
+
+// tileMetadata contains the information needed to revalidate a cached tile with the remote server.
+type tileMetadata struct {
+	// Time when the tile has been loaded or revalidated the last time
+	FetchedAt    time.Time `json:"fetched_at"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	// Time of the last failed revalidation (zero if the last revalidation succeeded), see remoteTileSource.isExpired
+	RevalidationFailedAt time.Time `json:"revalidation_failed_at"`
+}
+
+// readTileMetadata returns the metadata of the cached tile. Tiles without metadata (e.g. cached by older versions) have
+// empty metadata, so they are considered as fetched a long time ago.
+func readTileMetadata(z, x, y, cacheKey, format, cacheBaseFolder string) tileMetadata {
+	var metadata tileMetadata
+	fileContent, err := os.ReadFile(filepath.Join(cacheBaseFolder, cacheKey, z, x, y+"."+format+"."+metadataExtension))
+	if err == nil {
+		err = json.Unmarshal(fileContent, &metadata)
+		if err != nil {
+			sigolo.Debug("Ignore invalid metadata of cached tile %s/%s/%s: %s", z, x, y, err.Error())
+			return tileMetadata{}
+		}
+	}
+	return metadata
+}
+
+func writeTileMetadata(z, x, y, cacheKey, format, cacheBaseFolder string, metadata tileMetadata) error {
+	fileContent, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return cacheTile(z, x, y, cacheKey, format+"."+metadataExtension, cacheBaseFolder, fileContent)
+}
+
+// removeCachedTile removes the tile and its metadata from the cache.
+func removeCachedTile(z, x, y, cacheKey, format, cacheBaseFolder string) {
+	tileFilePath := filepath.Join(cacheBaseFolder, cacheKey, z, x, y+"."+format)
+	for _, filePath := range []string{tileFilePath, tileFilePath + "." + metadataExtension} {
+		err := os.Remove(filePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			sigolo.Error("Error removing cached file %s: %s", filePath, err.Error())
+		}
+	}
+}
+
+// The extension of marker files of tiles that don't exist on the remote server.
+const notFoundExtension = "not-found"
+
+// cacheNotFound remembers that the tile doesn't exist on the remote server. The modification time of the marker file is
+// the time of the request.
+func cacheNotFound(z, x, y, cacheKey, cacheBaseFolder string) error {
+	return cacheTile(z, x, y, cacheKey, notFoundExtension, cacheBaseFolder, nil)
+}
+
+// isCachedAsNotFound returns true when the tile didn't exist on the remote server within the given duration.
+func isCachedAsNotFound(z, x, y, cacheKey, cacheBaseFolder string, maxAge time.Duration) bool {
+	fileInfo, err := os.Stat(filepath.Join(cacheBaseFolder, cacheKey, z, x, y+"."+notFoundExtension))
+	return err == nil && time.Since(fileInfo.ModTime()) < maxAge
+}
+
+// tileFlights ensures that uncached tiles are only loaded or computed once, even if they are requested concurrently.
+var tileFlights singleflight.Group
+
+type tileFlightResult struct {
+	tileBytes []byte
+	format    string
+}
+
+// loadTileOnce calls the load function for the given tile, unless it is already running for the same tile. In this case
+// the result of the running call is awaited and returned instead. The returned bytes are shared and must not be changed.
+func loadTileOnce(z, x, y, cacheKey string, log *logger, load func() ([]byte, string, error)) ([]byte, string, error) {
+	result, err, shared := tileFlights.Do(filepath.Join(cacheKey, z, x, y), func() (interface{}, error) {
+		tileBytes, format, err := load()
+		return tileFlightResult{tileBytes: tileBytes, format: format}, err
+	})
+	if shared {
+		log.Debug("Tile shared with concurrent requests of the same tile")
+	}
+
+	flightResult := result.(tileFlightResult)
+	return flightResult.tileBytes, flightResult.format, err
+}
+
 func ensureFolderExists(z string, x string, cachePath string) string {
 	imageFolder := filepath.Join(cachePath, z, x)
 	err := os.MkdirAll(imageFolder, os.ModePerm)
@@ -51,7 +177,11 @@ func ensureFolderExists(z string, x string, cachePath string) string {
 }
 
 func toCacheKey(targetUrl *url.URL) string {
-	cacheKey := targetUrl.Host + targetUrl.Path
+	return toFolderName(targetUrl.Host + targetUrl.Path)
+}
+
+// toFolderName turns the given cache key into a name usable as folder within the cache folder.
+func toFolderName(cacheKey string) string {
 	cacheKey = strings.ReplaceAll(cacheKey, "/", "_")
 	cacheKey = strings.ReplaceAll(cacheKey, ".", "-")
 	cacheKey = strings.ReplaceAll(cacheKey, "{", "")
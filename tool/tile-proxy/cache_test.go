@@ -0,0 +1,71 @@
+package tile_proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheTile(t *testing.T) {
+	cacheBaseFolder := t.TempDir()
+
+	// Act
+	err := cacheTile("1", "2", "3", "key", formatPng, cacheBaseFolder, []byte("old"))
+	if err == nil {
+		err = cacheTile("1", "2", "3", "key", formatPng, cacheBaseFolder, []byte("new"))
+	}
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	tileBytes := getTile("1", "2", "3", "key", formatPng, cacheBaseFolder, newLogger("test"))
+	if string(tileBytes) != "new" {
+		t.Errorf("Expected overwritten tile but got %s", tileBytes)
+	}
+	files, _ := os.ReadDir(filepath.Join(cacheBaseFolder, "key", "1", "2"))
+	if len(files) != 1 {
+		t.Errorf("Expected only the tile and no temporary files but got %v", files)
+	}
+}
+
+func TestRemoteTileSource_concurrentRequests(t *testing.T) {
+	var numberOfRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numberOfRequests.Add(1)
+		// Slow server, so that all requests are waiting at the same time
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write([]byte{0x1a, 0x02})
+	}))
+	defer server.Close()
+
+	remote := newRemoteTileSource(server.URL+"/{z}/{x}/{y}", t.TempDir(), RemoteTileOptions{})
+
+	// Act
+	var waitGroup sync.WaitGroup
+	results := make([][]byte, 10)
+	for i := range results {
+		waitGroup.Add(1)
+		go func(i int) {
+			defer waitGroup.Done()
+			results[i], _, _ = remote.getTile("1", "2", "3", newLogger("test"))
+		}(i)
+	}
+	waitGroup.Wait()
+
+	// Assert
+	if numberOfRequests.Load() != 1 {
+		t.Errorf("Expected one request to the remote server but got %d", numberOfRequests.Load())
+	}
+	for i, result := range results {
+		if len(result) != 2 {
+			t.Errorf("Request %d got wrong tile %v", i, result)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package tile_proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/HugoSmits86/nativewebp"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"strings"
+
+	_ "golang.org/x/image/webp" // register webp format for image.Decode
+)
+
+// The tile formats, which are also used as file extensions of cached tiles.
+const (
+	formatWebp = "webp"
+	formatPng  = "png"
+	formatJpeg = "jpeg"
+	formatPbf  = "pbf"
+)
+
+var allFormats = []string{formatPng, formatJpeg, formatWebp, formatPbf}
+
+// EncodingOptions define the quality of converted raster tiles.
+type EncodingOptions struct {
+	// Quality of JPEG tiles between 1 (worst) and 100 (best)
+	JpegQuality int
+	// Quality of lossy WebP tiles between 1 (worst) and 100 (best). WebP tiles are encoded lossless for 0.
+	WebpQuality int
+}
+
+func (o EncodingOptions) validate() error {
+	if o.JpegQuality < 1 || o.JpegQuality > 100 {
+		return errors.New(fmt.Sprintf("Invalid JPEG quality %d, it must be between 1 and 100", o.JpegQuality))
+	}
+	if o.WebpQuality < 0 || o.WebpQuality > 100 {
+		return errors.New(fmt.Sprintf("Invalid WebP quality %d, it must be between 1 and 100 or 0 for lossless WebP", o.WebpQuality))
+	}
+	if o.WebpQuality != 0 && !lossyWebpSupported {
+		return errors.New("Lossy WebP is not supported, since this tool was built without cgo (which needs a C compiler)")
+	}
+	return nil
+}
+
+// normalizeFormat returns the format of the given file extension (e.g. "jpg" becomes "jpeg"). An empty string is
+// returned for unknown extensions.
+func normalizeFormat(extension string) string {
+	extension = strings.ToLower(strings.TrimPrefix(extension, "."))
+	switch extension {
+	case "jpg", formatJpeg:
+		return formatJpeg
+	case "mvt":
+		return formatPbf
+	case formatPng, formatWebp, formatPbf:
+		return extension
+	}
+	return ""
+}
+
+// detectFormat determines the format of the given tile by its magic bytes. Formats without magic bytes (like vector
+// tiles) are determined by the content type. If both fail, the fallback format (e.g. from the file extension of the
+// URL) is used.
+func detectFormat(tileBytes []byte, contentType string, fallbackFormat string) (string, error) {
+	switch {
+	case bytes.HasPrefix(tileBytes, []byte("\x89PNG\r\n\x1a\n")):
+		return formatPng, nil
+	case bytes.HasPrefix(tileBytes, []byte{0xff, 0xd8, 0xff}):
+		return formatJpeg, nil
+	case len(tileBytes) >= 12 && string(tileBytes[0:4]) == "RIFF" && string(tileBytes[8:12]) == "WEBP":
+		return formatWebp, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "image/png":
+		return formatPng, nil
+	case "image/jpeg":
+		return formatJpeg, nil
+	case "image/webp":
+		return formatWebp, nil
+	case "application/x-protobuf", "application/vnd.mapbox-vector-tile", "application/vnd.mvt":
+		return formatPbf, nil
+	}
+
+	if fallbackFormat != "" {
+		return fallbackFormat, nil
+	}
+	return "", errors.New(fmt.Sprintf("Unknown tile format with content type '%s'", contentType))
+}
+
+// contentTypeOf returns the content type used for responses of the given format.
+func contentTypeOf(format string) string {
+	switch format {
+	case formatPng:
+		return "image/png"
+	case formatJpeg:
+		return "image/jpeg"
+	case formatWebp:
+		return "image/webp"
+	case formatPbf:
+		return "application/x-protobuf"
+	}
+	return "application/octet-stream"
+}
+
+// convertTile converts the tile into the requested format. Tiles already having the requested format are returned
+// unchanged. Raster tiles can be converted into any raster format, vector tiles can't be converted at all.
+func convertTile(tileBytes []byte, tileFormat string, requestedFormat string, options EncodingOptions) ([]byte, error) {
+	if tileFormat == requestedFormat {
+		return tileBytes, nil
+	}
+	if tileFormat == formatPbf || requestedFormat == formatPbf {
+		return nil, errors.New(fmt.Sprintf("Unsupported conversion from %s to %s", tileFormat, requestedFormat))
+	}
+
+	tileImage, _, err := image.Decode(bytes.NewReader(tileBytes))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error decoding tile as %s: %s", tileFormat, err.Error()))
+	}
+
+	var result bytes.Buffer
+	switch requestedFormat {
+	case formatPng:
+		err = png.Encode(&result, tileImage)
+	case formatJpeg:
+		err = jpeg.Encode(&result, onWhiteBackground(tileImage), &jpeg.Options{Quality: options.JpegQuality})
+	case formatWebp:
+		if options.WebpQuality == 0 {
+			err = nativewebp.Encode(&result, tileImage, nil)
+		} else {
+			err = encodeLossyWebp(&result, tileImage, options.WebpQuality)
+		}
+	default:
+		err = errors.New(fmt.Sprintf("Unsupported requested format %s", requestedFormat))
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error encoding tile as %s: %s", requestedFormat, err.Error()))
+	}
+
+	return result.Bytes(), nil
+}
+
+// onWhiteBackground draws the image on a white background, since JPEG has no transparency and transparent pixels would
+// otherwise be black.
+func onWhiteBackground(img image.Image) image.Image {
+	background := image.NewRGBA(img.Bounds())
+	draw.Draw(background, background.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(background, background.Bounds(), img, img.Bounds().Min, draw.Over)
+	return background
+}
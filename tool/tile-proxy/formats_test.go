@@ -0,0 +1,202 @@
+package tile_proxy
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+)
+
+var testEncodingOptions = EncodingOptions{JpegQuality: 90}
+
+func createTestTile(t *testing.T) []byte {
+	tileImage := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := 0; i < 4; i++ {
+		tileImage.SetNRGBA(i, i, color.NRGBA{R: 255, A: 255})
+	}
+
+	var tileBytes bytes.Buffer
+	err := png.Encode(&tileBytes, tileImage)
+	if err != nil {
+		t.Fatalf("Error encoding test tile: %s", err.Error())
+	}
+	return tileBytes.Bytes()
+}
+
+func TestNormalizeFormat(t *testing.T) {
+	if normalizeFormat(".jpg") != formatJpeg || normalizeFormat("PNG") != formatPng || normalizeFormat("webp") != formatWebp {
+		t.Errorf("Wrong normalized formats")
+	}
+	if normalizeFormat("") != "" || normalizeFormat("tiff") != "" {
+		t.Errorf("Unknown formats should result in an empty string")
+	}
+}
+
+func TestConvertTile(t *testing.T) {
+	pngTile := createTestTile(t)
+
+	for _, format := range []string{formatPng, formatJpeg, formatWebp} {
+		for _, requestedFormat := range []string{formatPng, formatJpeg, formatWebp} {
+			// Arrange
+			tile, err := convertTile(pngTile, formatPng, format, testEncodingOptions)
+			if err != nil {
+				t.Fatalf("Error converting test tile to %s: %s", format, err.Error())
+			}
+
+			// Act
+			result, err := convertTile(tile, format, requestedFormat, testEncodingOptions)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Error converting %s to %s: %s", format, requestedFormat, err.Error())
+			}
+			detectedFormat, _ := detectFormat(result, "", "")
+			if detectedFormat != requestedFormat {
+				t.Errorf("Expected %s when converting %s to %s but got %s", requestedFormat, format, requestedFormat, detectedFormat)
+			}
+			resultImage, _, err := image.Decode(bytes.NewReader(result))
+			if err != nil || resultImage.Bounds().Dx() != 4 {
+				t.Errorf("Invalid %s tile converted from %s (%v)", requestedFormat, format, err)
+			}
+		}
+	}
+}
+
+func TestConvertTile_elevationTileToWebp(t *testing.T) {
+	// Terrarium elevation tile of a hill, which has many different colors and used to break the WebP encoder
+	tileImage := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			elevation := 32768 + 2000 - math.Hypot(float64(x-128), float64(y-128))*7.3
+			tileImage.SetNRGBA(x, y, color.NRGBA{R: uint8(int(elevation) / 256), G: uint8(int(elevation) % 256), B: uint8((elevation - math.Floor(elevation)) * 256), A: 255})
+		}
+	}
+	var pngTile bytes.Buffer
+	err := png.Encode(&pngTile, tileImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	result, err := convertTile(pngTile.Bytes(), formatPng, formatWebp, testEncodingOptions)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	resultImage, _, err := image.Decode(bytes.NewReader(result))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, g, b, _ := resultImage.At(10, 10).RGBA()
+	expected := tileImage.NRGBAAt(10, 10)
+	if uint8(r>>8) != expected.R || uint8(g>>8) != expected.G || uint8(b>>8) != expected.B {
+		t.Errorf("Lossless WebP tile differs from original image: %v != %v", resultImage.At(10, 10), expected)
+	}
+}
+
+func TestConvertTile_lossyWebp(t *testing.T) {
+	if !lossyWebpSupported {
+		t.Skip("Lossy WebP needs cgo")
+	}
+	tileImage := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			tileImage.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x * y), A: 255})
+		}
+	}
+	var pngTile bytes.Buffer
+	err := png.Encode(&pngTile, tileImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	lossless, err := convertTile(pngTile.Bytes(), formatPng, formatWebp, testEncodingOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lossy, err := convertTile(pngTile.Bytes(), formatPng, formatWebp, EncodingOptions{JpegQuality: 90, WebpQuality: 50})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detectedFormat, _ := detectFormat(lossy, "", ""); detectedFormat != formatWebp {
+		t.Errorf("Expected WebP tile but got %s", detectedFormat)
+	}
+	resultImage, _, err := image.Decode(bytes.NewReader(lossy))
+	if err != nil || resultImage.Bounds().Dx() != 256 {
+		t.Errorf("Invalid lossy WebP tile (%v)", err)
+	}
+	if len(lossy) >= len(lossless) {
+		t.Errorf("Lossy WebP tile with %d bytes should be smaller than lossless tile with %d bytes", len(lossy), len(lossless))
+	}
+}
+
+func TestEncodingOptions_validate(t *testing.T) {
+	if (EncodingOptions{JpegQuality: 90}).validate() != nil {
+		t.Errorf("Lossless WebP should be valid")
+	}
+	if (EncodingOptions{JpegQuality: 0}).validate() == nil || (EncodingOptions{JpegQuality: 90, WebpQuality: 101}).validate() == nil {
+		t.Errorf("Expected error for invalid qualities")
+	}
+	if err := (EncodingOptions{JpegQuality: 90, WebpQuality: 80}).validate(); (err == nil) != lossyWebpSupported {
+		t.Errorf("Lossy WebP should only be valid when supported but got %v", err)
+	}
+}
+
+func TestConvertTile_transparentToJpeg(t *testing.T) {
+	// Act
+	result, err := convertTile(createTestTile(t), formatPng, formatJpeg, EncodingOptions{JpegQuality: 100})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Error converting tile: %s", err.Error())
+	}
+	resultImage, _, _ := image.Decode(bytes.NewReader(result))
+	r, g, b, _ := resultImage.At(3, 0).RGBA()
+	if r>>8 < 250 || g>>8 < 250 || b>>8 < 250 {
+		t.Errorf("Transparent pixels should be white but were %v", resultImage.At(3, 0))
+	}
+}
+
+func TestConvertTile_vectorTile(t *testing.T) {
+	vectorTile := []byte{0x1a, 0x02, 0x78, 0x02}
+
+	result, err := convertTile(vectorTile, formatPbf, formatPbf, testEncodingOptions)
+	if err != nil || !bytes.Equal(result, vectorTile) {
+		t.Errorf("Vector tiles should be returned unchanged")
+	}
+
+	_, err = convertTile(vectorTile, formatPbf, formatPng, testEncodingOptions)
+	if err == nil {
+		t.Errorf("Expected error when converting vector tile into image")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	jpegTile, _ := convertTile(createTestTile(t), formatPng, formatJpeg, testEncodingOptions)
+
+	format, err := detectFormat(jpegTile, "image/png", formatPng)
+	if err != nil || format != formatJpeg {
+		t.Errorf("Magic bytes should be preferred over content type and extension but got %s (%v)", format, err)
+	}
+
+	format, err = detectFormat([]byte{0x1a, 0x02}, "application/x-protobuf; charset=utf-8", "")
+	if err != nil || format != formatPbf {
+		t.Errorf("Expected format from content type but got %s (%v)", format, err)
+	}
+
+	format, err = detectFormat([]byte{0x1a, 0x02}, "application/octet-stream", formatPbf)
+	if err != nil || format != formatPbf {
+		t.Errorf("Expected fallback format but got %s (%v)", format, err)
+	}
+
+	_, err = detectFormat([]byte{0x1a, 0x02}, "application/octet-stream", "")
+	if err == nil {
+		t.Errorf("Expected error for unknown format")
+	}
+}
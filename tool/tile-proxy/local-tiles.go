@@ -0,0 +1,313 @@
+package tile_proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/hauke96/sigolo"
+	"image"
+	"image/png"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"tool/contours"
+	"tool/dem"
+	"tool/relief"
+)
+
+const (
+	// Mappings of the form "<endpoint>:<kind>:<elevation-source>" (e.g. "hillshade:hillshade:dem.tif") serve tiles of
+	// this kind computed from the elevations instead of proxying a remote server.
+	localTileKindHillshade = "hillshade"
+	localTileKindSlope     = "slope"
+	localTileKindContours  = "contours"
+
+	tileSize = 256
+	maxZoom  = 24
+)
+
+// LocalTileOptions configure the tiles computed from a local DEM or from elevation tiles.
+type LocalTileOptions struct {
+	Hillshade relief.HillshadeOptions
+	// Slope classes of slope tiles
+	SlopePalette []relief.SlopeClass
+	// Elevation interval of contour tiles in meters
+	ContourInterval float64
+	// Every n-th contour line is an index contour (none if 0)
+	ContourIndexInterval int
+	// Number of smoothing iterations of contour lines
+	ContourSmoothing int
+}
+
+// elevationSampler returns the elevations of the given tile.
+type elevationSampler func(z int, x int, y int, log *logger) (*relief.Grid, error)
+
+// tileRenderer creates the encoded tile from the elevations of the tile.
+type tileRenderer func(grid *relief.Grid) ([]byte, error)
+
+// parseLocalTileTarget returns the kind and the elevation source of mapping targets of local tiles. False is returned
+// for all other targets, e.g. URLs of remote servers.
+func parseLocalTileTarget(target string) (string, string, bool) {
+	for _, kind := range []string{localTileKindHillshade, localTileKindSlope, localTileKindContours} {
+		if strings.HasPrefix(target, kind+":") {
+			return kind, strings.TrimPrefix(target, kind+":"), true
+		}
+	}
+	return "", "", false
+}
+
+func startLocalTileEndpoint(port string, endpoint string, kind string, elevationSource string, cacheBaseFolder string, encodingOptions EncodingOptions, remoteTileOptions RemoteTileOptions, options LocalTileOptions) {
+	var render tileRenderer
+	var cacheParameters string
+	// Format in which the tiles are rendered and cached
+	tileFormat := formatPng
+	switch kind {
+	case localTileKindHillshade:
+		err := options.Hillshade.Validate()
+		sigolo.FatalCheck(err)
+
+		render = func(grid *relief.Grid) ([]byte, error) {
+			return encodePng(relief.Hillshade(grid, options.Hillshade))
+		}
+		cacheParameters = fmt.Sprintf("%g/%g/%g/%t/%g", options.Hillshade.Azimuth, options.Hillshade.Altitude,
+			options.Hillshade.ZFactor, options.Hillshade.Multidirectional, options.Hillshade.SlopeShading)
+	case localTileKindSlope:
+		render = func(grid *relief.Grid) ([]byte, error) {
+			return encodePng(relief.Slope(grid, options.SlopePalette))
+		}
+		var classes []string
+		for _, class := range options.SlopePalette {
+			classes = append(classes, fmt.Sprintf("%g-%02x%02x%02x%02x", class.MinAngle, class.Color.R, class.Color.G, class.Color.B, class.Color.A))
+		}
+		cacheParameters = strings.Join(classes, "/")
+	case localTileKindContours:
+		if options.ContourInterval <= 0 || options.ContourIndexInterval < 0 || options.ContourSmoothing < 0 {
+			sigolo.Fatal("Invalid contour options: The interval must be greater than 0, the index interval and smoothing must not be negative")
+		}
+
+		render = func(grid *relief.Grid) ([]byte, error) {
+			return contours.VectorTile(grid, options.ContourInterval, options.ContourIndexInterval, options.ContourSmoothing)
+		}
+		cacheParameters = fmt.Sprintf("%g/%d/%d", options.ContourInterval, options.ContourIndexInterval, options.ContourSmoothing)
+		tileFormat = formatPbf
+	default:
+		sigolo.Fatal("Unknown kind of local tiles %s", kind)
+	}
+
+	sample, sourceCacheKey := newElevationSampler(elevationSource, cacheBaseFolder, remoteTileOptions)
+	cacheKey := toFolderName(fmt.Sprintf("%s/%s/%s", kind, sourceCacheKey, cacheParameters))
+
+	sigolo.Info("Start %s tiles on port localhost:%s/%s for elevations of %s", kind, port, endpoint, elevationSource)
+
+	http.HandleFunc("/"+endpoint+"/", func(w http.ResponseWriter, r *http.Request) {
+		log := newLogger(endpoint)
+
+		log.Debug("Request URL: %s", r.URL)
+
+		z, x, y, requestedFormat, err := parseTileRequest(r.URL.Path, endpoint)
+		if err != nil {
+			responseWithError(log, w, err.Error(), err)
+			return
+		}
+		// Raster tiles can be converted into any raster format, vector tiles can't be converted at all
+		requestedFormat = normalizeFormat(requestedFormat)
+		if requestedFormat == "" || (requestedFormat == formatPbf) != (tileFormat == formatPbf) {
+			responseWithError(log, w, fmt.Sprintf("Unsupported requested format in %s for %s tiles", r.URL.Path, kind), nil)
+			return
+		}
+
+		tileZ, tileX, tileY, err := parseTileCoordinates(z, x, y)
+		if err != nil {
+			responseWithError(log, w, err.Error(), err)
+			return
+		}
+		// Normalized coordinates for the cache (e.g. without leading zeros)
+		z, x, y = strconv.Itoa(tileZ), strconv.Itoa(tileX), strconv.Itoa(tileY)
+
+		tileBytes := getTile(z, x, y, cacheKey, tileFormat, cacheBaseFolder, log)
+		if tileBytes == nil {
+			tileBytes, _, err = loadTileOnce(z, x, y, cacheKey, log, func() ([]byte, string, error) {
+				// A concurrent request might have cached the tile in the meantime
+				if tileBytes := getTile(z, x, y, cacheKey, tileFormat, cacheBaseFolder, log); tileBytes != nil {
+					log.Debug("Found tile in cache")
+					return tileBytes, tileFormat, nil
+				}
+
+				log.Debug("Tile not cached, compute %s", kind)
+				tileBytes, err := computeLocalTile(sample, render, tileZ, tileX, tileY, log)
+				if err != nil {
+					return nil, "", err
+				}
+
+				log.Debug("Cache new tile")
+				err = cacheTile(z, x, y, cacheKey, tileFormat, cacheBaseFolder, tileBytes)
+				if err != nil {
+					return nil, "", errors.New(fmt.Sprintf("Error caching tile %s/%s/%s.%s: %s", z, x, y, tileFormat, err.Error()))
+				}
+				return tileBytes, tileFormat, nil
+			})
+			if err != nil {
+				responseWithError(log, w, err.Error(), err)
+				return
+			}
+		} else {
+			log.Debug("Found tile in cache")
+		}
+
+		// Raster tiles are cached as PNG and converted on each request, since PNG is lossless and used by most requests.
+		tileBytes, err = convertTile(tileBytes, tileFormat, requestedFormat, encodingOptions)
+		if err != nil {
+			responseWithError(log, w, fmt.Sprintf("Error converting tile %s/%s/%s.%s: %s", z, x, y, tileFormat, err.Error()), err)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentTypeOf(requestedFormat))
+		err = writeTileToResponse(w, bytes.NewBuffer(tileBytes))
+		if err != nil {
+			log.Error("Error returning tile %s/%s/%s.%s: %s", z, x, y, requestedFormat, err.Error())
+			return
+		}
+		log.Debug("Response written - Done")
+	})
+}
+
+// computeLocalTile samples the elevations of the given tile and renders the tile.
+func computeLocalTile(sample elevationSampler, render tileRenderer, z int, x int, y int, log *logger) ([]byte, error) {
+	grid, err := sample(z, x, y, log)
+	if err != nil {
+		// Wrapped to keep the status code of errors of the remote server
+		return nil, fmt.Errorf("Error getting elevations of tile %d/%d/%d: %w", z, x, y, err)
+	}
+
+	tileBytes, err := render(grid)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error computing tile %d/%d/%d: %s", z, x, y, err.Error()))
+	}
+	return tileBytes, nil
+}
+
+// newElevationSampler returns the sampler of the given elevation source and a cache key of the source. The source is
+// either a GeoTIFF file or an URL of elevation tiles prefixed by their encoding, e.g. "terrarium:https://...".
+func newElevationSampler(elevationSource string, cacheBaseFolder string, remoteTileOptions RemoteTileOptions) (elevationSampler, string) {
+	for _, encoding := range []string{relief.EncodingTerrainRgb, relief.EncodingTerrarium} {
+		if strings.HasPrefix(elevationSource, encoding+":") {
+			remote := newRemoteTileSource(strings.TrimPrefix(elevationSource, encoding+":"), cacheBaseFolder, remoteTileOptions)
+			sample := func(z int, x int, y int, log *logger) (*relief.Grid, error) {
+				return sampleElevationTiles(remote, encoding, z, x, y, log)
+			}
+			return sample, encoding + "/" + remote.cacheKey
+		}
+	}
+
+	terrain, err := dem.ReadGeoTiff(elevationSource)
+	sigolo.FatalCheck(err)
+
+	sample := func(z int, x int, y int, log *logger) (*relief.Grid, error) {
+		return relief.SampleGrid(terrain, z, x, y, tileSize), nil
+	}
+	return sample, toDemFileCacheKey(elevationSource)
+}
+
+// sampleElevationTiles creates the grid of the given tile from the elevation tile and its eight neighbors, which are
+// needed for the border pixels. Neighbors that can't be loaded (e.g. outside the area of the elevation tiles) result
+// in border pixels without data.
+func sampleElevationTiles(remote *remoteTileSource, encoding string, z int, x int, y int, log *logger) (*relief.Grid, error) {
+	numberOfTiles := 1 << z
+
+	var tiles [3][3]image.Image
+	var errs [3][3]error
+	var waitGroup sync.WaitGroup
+	for row := 0; row < 3; row++ {
+		for column := 0; column < 3; column++ {
+			tileY := y + row - 1
+			if tileY < 0 || tileY >= numberOfTiles {
+				continue
+			}
+			// The world wraps around at the antimeridian
+			tileX := (x + column - 1 + numberOfTiles) % numberOfTiles
+
+			waitGroup.Add(1)
+			go func(row int, column int) {
+				defer waitGroup.Done()
+				tiles[row][column], errs[row][column] = loadElevationTile(remote, z, tileX, tileY, log)
+			}(row, column)
+		}
+	}
+	waitGroup.Wait()
+
+	if errs[1][1] != nil {
+		return nil, errs[1][1]
+	}
+	for row := range errs {
+		for column, err := range errs[row] {
+			if err != nil {
+				log.Debug("Neighbor of tile without elevations: %s", err.Error())
+				tiles[row][column] = nil
+			}
+		}
+	}
+
+	return relief.ElevationTileGrid(z, y, tiles, encoding)
+}
+
+func loadElevationTile(remote *remoteTileSource, z int, x int, y int, log *logger) (image.Image, error) {
+	tileBytes, _, err := remote.getTile(strconv.Itoa(z), strconv.Itoa(x), strconv.Itoa(y), log)
+	if err != nil {
+		return nil, err
+	}
+
+	tileImage, _, err := image.Decode(bytes.NewReader(tileBytes))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error decoding elevation tile %d/%d/%d: %s", z, x, y, err.Error()))
+	}
+	return tileImage, nil
+}
+
+// encodePng returns the image encoded as PNG.
+func encodePng(tileImage image.Image) ([]byte, error) {
+	var tileBytes bytes.Buffer
+	err := png.Encode(&tileBytes, tileImage)
+	if err != nil {
+		return nil, err
+	}
+	return tileBytes.Bytes(), nil
+}
+
+// parseTileCoordinates converts the tile coordinates of a request into numbers and checks whether the tile exists. This
+// also ensures that the coordinates are safe to use as part of the cache path.
+func parseTileCoordinates(zString string, xString string, yString string) (int, int, int, error) {
+	z, zErr := strconv.Atoi(zString)
+	x, xErr := strconv.Atoi(xString)
+	y, yErr := strconv.Atoi(yString)
+	if zErr != nil || xErr != nil || yErr != nil {
+		return 0, 0, 0, errors.New(fmt.Sprintf("Invalid tile coordinates %s/%s/%s", zString, xString, yString))
+	}
+
+	numberOfTiles := int(math.Exp2(float64(min(z, maxZoom))))
+	if z < 0 || z > maxZoom || x < 0 || y < 0 || x >= numberOfTiles || y >= numberOfTiles {
+		return 0, 0, 0, errors.New(fmt.Sprintf("Tile %d/%d/%d does not exist", z, x, y))
+	}
+
+	return z, x, y, nil
+}
+
+// toDemFileCacheKey returns a cache key containing the DEM file and its last modification, so that cached tiles are not
+// used anymore when the file changes.
+func toDemFileCacheKey(demFile string) string {
+	var modificationTime int64
+	fileInfo, err := os.Stat(demFile)
+	if err == nil {
+		modificationTime = fileInfo.ModTime().Unix()
+	}
+
+	absoluteDemFile, err := filepath.Abs(demFile)
+	if err != nil {
+		absoluteDemFile = demFile
+	}
+
+	return fmt.Sprintf("%s/%d", absoluteDemFile, modificationTime)
+}
@@ -0,0 +1,100 @@
+package tile_proxy
+
+import (
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"tool/relief"
+)
+
+func TestParseTileRequest(t *testing.T) {
+	z, x, y, format, err := parseTileRequest("/hillshade/12/2176/1328.png", "hillshade")
+	if err != nil || z != "12" || x != "2176" || y != "1328" || format != "png" {
+		t.Errorf("Wrong tile %s/%s/%s.%s (%v)", z, x, y, format, err)
+	}
+
+	_, _, _, _, err = parseTileRequest("/hillshade/12/2176.png", "hillshade")
+	if err == nil {
+		t.Errorf("Expected error for missing coordinate")
+	}
+}
+
+func TestParseTileCoordinates(t *testing.T) {
+	z, x, y, err := parseTileCoordinates("2", "3", "1")
+	if err != nil || z != 2 || x != 3 || y != 1 {
+		t.Errorf("Wrong tile %d/%d/%d (%v)", z, x, y, err)
+	}
+
+	for _, coordinates := range [][]string{{"2", "4", "1"}, {"2", "-1", "1"}, {"30", "0", "0"}, {"2", "..", "1"}} {
+		_, _, _, err = parseTileCoordinates(coordinates[0], coordinates[1], coordinates[2])
+		if err == nil {
+			t.Errorf("Expected error for tile %v", coordinates)
+		}
+	}
+}
+
+func TestParseLocalTileTarget(t *testing.T) {
+	kind, demFile, isLocal := parseLocalTileTarget("slope:../data/dem.tif")
+	if !isLocal || kind != localTileKindSlope || demFile != "../data/dem.tif" {
+		t.Errorf("Wrong local tile target %s %s %v", kind, demFile, isLocal)
+	}
+
+	kind, source, isLocal := parseLocalTileTarget("contours:terrarium:https://example.com/{z}/{x}/{y}.png")
+	if !isLocal || kind != localTileKindContours || source != "terrarium:https://example.com/{z}/{x}/{y}.png" {
+		t.Errorf("Wrong local tile target %s %s %v", kind, source, isLocal)
+	}
+
+	_, _, isLocal = parseLocalTileTarget("https://api.maptiler.com/tiles/hillshade/{z}/{x}/{y}.webp")
+	if isLocal {
+		t.Errorf("URL should not be a local tile target")
+	}
+}
+
+func TestSampleElevationTiles(t *testing.T) {
+	// Terrarium tile with an elevation of 1000 m (R=131, G=232 is 33768)
+	tileImage := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := range tileImage.Pix {
+		tileImage.Pix[i] = []uint8{131, 232, 0, 255}[i%4]
+	}
+	tileBytes, err := encodePng(tileImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requestedTiles []string
+	var requestedTilesMutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedTilesMutex.Lock()
+		requestedTiles = append(requestedTiles, r.URL.Path)
+		requestedTilesMutex.Unlock()
+		w.Write(tileBytes)
+	}))
+	defer server.Close()
+
+	remote := newRemoteTileSource(server.URL+"/{z}/{x}/{y}", t.TempDir(), RemoteTileOptions{})
+
+	// Act
+	grid, err := sampleElevationTiles(remote, relief.EncodingTerrarium, 2, 0, 0, newLogger("test"))
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grid.Size() != 4 {
+		t.Errorf("Wrong grid size %d", grid.Size())
+	}
+	// The northern neighbors don't exist, the western neighbors wrap around the antimeridian
+	sort.Strings(requestedTiles)
+	expectedTiles := []string{"/2/0/0", "/2/0/1", "/2/1/0", "/2/1/1", "/2/3/0", "/2/3/1"}
+	if !slices.Equal(requestedTiles, expectedTiles) {
+		t.Errorf("Expected requested tiles %v but got %v", expectedTiles, requestedTiles)
+	}
+	hillshade := relief.Hillshade(grid, relief.HillshadeOptions{Azimuth: 315, Altitude: 90, ZFactor: 1})
+	if hillshade.NRGBAAt(0, 0).A != 255 || hillshade.NRGBAAt(0, 0).R != 255 {
+		t.Errorf("Expected flat terrain with data but got %v", hillshade.NRGBAAt(0, 0))
+	}
+}
@@ -4,16 +4,17 @@ import (
 	"fmt"
 	"github.com/hauke96/sigolo"
 	"strings"
+	"sync/atomic"
 )
 
 var (
-	nextTraceId = 0
+	// Atomic, since loggers are created by concurrently handled requests
+	nextTraceId atomic.Int64
 )
 
 func newLogger(prefix string) *logger {
-	defer func() { nextTraceId++ }() // Just increase trace-ID counter after return statement
 	return &logger{
-		LogTraceId: nextTraceId,
+		LogTraceId: int(nextTraceId.Add(1) - 1),
 		LogPrefix:  prefix,
 	}
 }
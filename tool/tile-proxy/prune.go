@@ -0,0 +1,120 @@
+package tile_proxy
+
+import (
+	"errors"
+	"github.com/hauke96/sigolo"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Interval in which the cache is pruned while the proxy is running
+	cachePruneInterval = 10 * time.Minute
+	// Temporary files older than this are leftovers of interrupted writes, see cacheTile
+	maxTemporaryFileAge = time.Hour
+)
+
+// cacheEntry is a cached tile with all its files (e.g. its metadata).
+type cacheEntry struct {
+	files    []string
+	size     int64
+	lastUsed time.Time
+}
+
+// PruneCache removes the least recently used tiles until the cache folder is at most maxSize bytes large. A tile is
+// removed together with its metadata. Leftover temporary files of interrupted writes are removed as well.
+func PruneCache(cacheBaseFolder string, maxSize int64) error {
+	entries := map[string]*cacheEntry{}
+	var totalSize int64
+
+	err := filepath.WalkDir(cacheBaseFolder, func(filePath string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dirEntry.IsDir() {
+			return nil
+		}
+
+		fileInfo, err := dirEntry.Info()
+		if err != nil {
+			// Removed in the meantime, e.g. by a concurrent write of the same tile
+			return nil
+		}
+
+		if strings.HasSuffix(filePath, ".tmp") {
+			if time.Since(fileInfo.ModTime()) > maxTemporaryFileAge {
+				os.Remove(filePath)
+			}
+			return nil
+		}
+
+		tileFilePath := strings.TrimSuffix(filePath, "."+metadataExtension)
+		entry, ok := entries[tileFilePath]
+		if !ok {
+			entry = &cacheEntry{}
+			entries[tileFilePath] = entry
+		}
+		entry.files = append(entry.files, filePath)
+		entry.size += fileInfo.Size()
+		if filePath == tileFilePath {
+			// The modification time of the tile (not its metadata) is the time of the last use, see getTile
+			entry.lastUsed = fileInfo.ModTime()
+		}
+		totalSize += fileInfo.Size()
+
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		sigolo.Debug("Cache folder %s does not exist, nothing to prune", cacheBaseFolder)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if totalSize <= maxSize {
+		sigolo.Debug("Cache has %d MB, no need to prune it", totalSize/1024/1024)
+		return nil
+	}
+
+	sortedEntries := make([]*cacheEntry, 0, len(entries))
+	for _, entry := range entries {
+		sortedEntries = append(sortedEntries, entry)
+	}
+	sort.Slice(sortedEntries, func(i, j int) bool {
+		return sortedEntries[i].lastUsed.Before(sortedEntries[j].lastUsed)
+	})
+
+	numberOfRemovedTiles := 0
+	for _, entry := range sortedEntries {
+		if totalSize <= maxSize {
+			break
+		}
+
+		for _, filePath := range entry.files {
+			err = os.Remove(filePath)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		totalSize -= entry.size
+		numberOfRemovedTiles++
+	}
+
+	sigolo.Info("Removed %d least recently used tiles from the cache, which now has %d MB", numberOfRemovedTiles, totalSize/1024/1024)
+	return nil
+}
+
+func pruneCachePeriodically(cacheBaseFolder string, maxSize int64) {
+	for {
+		err := PruneCache(cacheBaseFolder, maxSize)
+		if err != nil {
+			sigolo.Error("Error pruning cache: %s", err.Error())
+		}
+		time.Sleep(cachePruneInterval)
+	}
+}
@@ -0,0 +1,62 @@
+package tile_proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPruneCache(t *testing.T) {
+	cacheBaseFolder := t.TempDir()
+	// Tiles of 100 bytes each, the first one with metadata of 20 bytes
+	for i, y := range []string{"1", "2", "3"} {
+		err := cacheTile("1", "0", y, "key", formatPng, cacheBaseFolder, make([]byte, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lastUsed := time.Now().Add(time.Duration(i-3) * time.Hour)
+		err = os.Chtimes(filepath.Join(cacheBaseFolder, "key", "1", "0", y+".png"), lastUsed, lastUsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := cacheTile("1", "0", "1", "key", formatPng+"."+metadataExtension, cacheBaseFolder, make([]byte, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leftoverFile := filepath.Join(cacheBaseFolder, "key", "1", "0", "4.png.123.tmp")
+	os.WriteFile(leftoverFile, make([]byte, 10), 0644)
+	os.Chtimes(leftoverFile, time.Now().Add(-2*time.Hour), time.Now().Add(-2*time.Hour))
+
+	// Act
+	err = PruneCache(cacheBaseFolder, 150)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := os.ReadDir(filepath.Join(cacheBaseFolder, "key", "1", "0"))
+	if len(files) != 1 || files[0].Name() != "3.png" {
+		t.Errorf("Expected only the most recently used tile but got %v", files)
+	}
+}
+
+func TestPruneCache_keepsSmallCache(t *testing.T) {
+	cacheBaseFolder := t.TempDir()
+	err := cacheTile("1", "0", "1", "key", formatPng, cacheBaseFolder, make([]byte, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	err = PruneCache(cacheBaseFolder, 100)
+
+	// Assert
+	if err != nil || getTile("1", "0", "1", "key", formatPng, cacheBaseFolder, newLogger("test")) == nil {
+		t.Errorf("Tile should not be removed (%v)", err)
+	}
+	if PruneCache(filepath.Join(cacheBaseFolder, "missing"), 100) != nil {
+		t.Errorf("Missing cache folder should not be an error")
+	}
+}
@@ -5,50 +5,254 @@ import (
 	"errors"
 	"fmt"
 	"github.com/hauke96/sigolo"
-	"golang.org/x/image/webp"
-	_ "golang.org/x/image/webp" // register webp format
-	"image"
-	"image/png"
 	"io"
 	"net/http"
 	"net/url"
 	"path"
 	"strconv"
 	"strings"
+	"time"
 )
 
-const (
-	formatWebp = "webp"
-	formatPng  = "png"
-	formatPbf  = "pbf"
-)
+// StartProxy serves the given mappings. The least recently used tiles are removed from the cache when it exceeds the
+// maximum size in bytes (0 for an unlimited cache).
+func StartProxy(port string, mappings []string, cacheBaseFolder string, maxCacheSize int64, encodingOptions EncodingOptions, remoteTileOptions RemoteTileOptions, localTileOptions LocalTileOptions) {
+	err := encodingOptions.validate()
+	sigolo.FatalCheck(err)
 
-func StartProxy(port string, mappings []string, cacheBaseFolder string) {
 	for _, mapping := range mappings {
 		splitMapping := strings.SplitN(mapping, ":", 2)
 		if len(splitMapping) != 2 {
 			sigolo.Fatal("Invalid URL path mapping: %s", mapping)
 		}
-		startProxyForEndpoint(port, splitMapping[0], splitMapping[1], cacheBaseFolder)
+
+		endpoint, target := splitMapping[0], splitMapping[1]
+		if kind, demFile, isLocal := parseLocalTileTarget(target); isLocal {
+			startLocalTileEndpoint(port, endpoint, kind, demFile, cacheBaseFolder, encodingOptions, remoteTileOptions.forEndpoint(endpoint), localTileOptions)
+		} else {
+			startProxyForEndpoint(port, endpoint, target, cacheBaseFolder, encodingOptions, remoteTileOptions.forEndpoint(endpoint))
+		}
+	}
+
+	if maxCacheSize > 0 {
+		go pruneCachePeriodically(cacheBaseFolder, maxCacheSize)
 	}
 
 	sigolo.Debug("Start listening on port %s", port)
-	err := http.ListenAndServe(":"+port, nil)
+	err = http.ListenAndServe(":"+port, nil)
 	sigolo.FatalCheck(err)
 }
 
-func startProxyForEndpoint(port string, endpoint string, remoteUrlString string, cacheBaseFolder string) {
+var (
+	// Number of retries of requests failing with status 429 (too many requests) or 5xx
+	maxRetries = 3
+	// Delay before the first retry, which is doubled for each further retry
+	initialRetryDelay = time.Second
+	// Longer delays requested by the remote server aren't awaited, the error is returned instead
+	maxRetryDelay = 30 * time.Second
+	// Delay before an outdated tile is revalidated again after the remote server couldn't be reached
+	revalidationRetryDelay = 5 * time.Minute
+)
+
+// RemoteTileOptions configure the requests and caching of remote tiles.
+type RemoteTileOptions struct {
+	// Duration for which tiles that don't exist on the remote server (status 404) are not requested again. Use 0 to
+	// disable caching of missing tiles.
+	NotFoundMaxAge time.Duration
+	// Duration after which cached tiles are revalidated with the remote server. Use 0 to never revalidate them.
+	MaxAge time.Duration
+	// Max-age of specific endpoints, which overrides MaxAge
+	EndpointMaxAges map[string]time.Duration
+}
+
+// forEndpoint returns the options with the max-age of the given endpoint.
+func (o RemoteTileOptions) forEndpoint(endpoint string) RemoteTileOptions {
+	if maxAge, ok := o.EndpointMaxAges[endpoint]; ok {
+		o.MaxAge = maxAge
+	}
+	return o
+}
+
+// upstreamError is the error of an unsuccessful request to a remote server. Its status code is passed to the client.
+type upstreamError struct {
+	statusCode int
+	message    string
+}
+
+func (e *upstreamError) Error() string {
+	return e.message
+}
+
+// remoteTileSource loads the tiles of a remote server and caches them.
+type remoteTileSource struct {
+	urlTemplate     string
+	cacheKey        string
+	cacheBaseFolder string
+	// Format of the file extension of the URL. This is empty for URLs without (known) extension, the format is then
+	// detected when a tile has been loaded.
+	format  string
+	client  http.Client
+	options RemoteTileOptions
+}
+
+func newRemoteTileSource(remoteUrlString string, cacheBaseFolder string, options RemoteTileOptions) *remoteTileSource {
 	remoteUrl, err := url.Parse(remoteUrlString)
 	sigolo.FatalCheck(err)
 
-	remoteTileFormat := strings.Trim(path.Ext(remoteUrl.Path), ".")
-	if remoteTileFormat != formatWebp && remoteTileFormat != formatPbf {
-		sigolo.Fatal("Unsupported remote tile format %s", remoteTileFormat)
+	return &remoteTileSource{
+		urlTemplate:     remoteUrlString,
+		cacheKey:        toCacheKey(remoteUrl),
+		cacheBaseFolder: cacheBaseFolder,
+		format:          normalizeFormat(path.Ext(remoteUrl.Path)),
+		client:          http.Client{},
+		options:         options,
 	}
+}
 
-	sigolo.Info("Start tile proxy on port localhost:%s/%s for remote URL %s", port, endpoint, remoteUrlString)
+// cachedTile is a tile of the remote server found in the cache.
+type cachedTile struct {
+	tileBytes []byte
+	format    string
+	metadata  tileMetadata
+}
+
+// getCachedTile returns the cached tile or nil if it's not cached.
+func (s *remoteTileSource) getCachedTile(z string, x string, y string, log *logger) *cachedTile {
+	cachedFormats := allFormats
+	if s.format != "" {
+		cachedFormats = []string{s.format}
+	}
 
-	client := http.Client{}
+	tileBytes, tileFormat := getCachedTile(z, x, y, s.cacheKey, cachedFormats, s.cacheBaseFolder, log)
+	if tileBytes == nil {
+		return nil
+	}
+
+	return &cachedTile{
+		tileBytes: tileBytes,
+		format:    tileFormat,
+		metadata:  readTileMetadata(z, x, y, s.cacheKey, tileFormat, s.cacheBaseFolder),
+	}
+}
+
+// isExpired returns true when the cached tile is older than the max-age and has to be revalidated. After a failed
+// revalidation, the tile isn't revalidated again for some time, so that not every request waits for an unreachable
+// remote server.
+func (s *remoteTileSource) isExpired(tile *cachedTile) bool {
+	if s.options.MaxAge <= 0 || time.Since(tile.metadata.RevalidationFailedAt) < revalidationRetryDelay {
+		return false
+	}
+	return time.Since(tile.metadata.FetchedAt) >= s.options.MaxAge
+}
+
+// getTile returns the tile and its format from the cache or, if not cached yet or expired, from the remote server.
+func (s *remoteTileSource) getTile(z string, x string, y string, log *logger) ([]byte, string, error) {
+	cached := s.getCachedTile(z, x, y, log)
+	if cached != nil && !s.isExpired(cached) {
+		log.Debug("Found tile in cache")
+		return cached.tileBytes, cached.format, nil
+	}
+
+	if cached == nil && isCachedAsNotFound(z, x, y, s.cacheKey, s.cacheBaseFolder, s.options.NotFoundMaxAge) {
+		return nil, "", &upstreamError{statusCode: http.StatusNotFound, message: fmt.Sprintf("Tile %s/%s/%s does not exist on the remote server (cached)", z, x, y)}
+	}
+
+	return loadTileOnce(z, x, y, s.cacheKey, log, func() ([]byte, string, error) {
+		// A concurrent request might have cached or revalidated the tile in the meantime
+		cached := s.getCachedTile(z, x, y, log)
+		if cached != nil && !s.isExpired(cached) {
+			log.Debug("Found tile in cache")
+			return cached.tileBytes, cached.format, nil
+		}
+
+		if cached == nil {
+			log.Debug("Tile not cached, load it from remote server")
+		} else {
+			log.Debug("Cached tile expired, revalidate it with the remote server")
+		}
+		return s.requestAndCacheTile(z, x, y, cached, log)
+	})
+}
+
+// requestAndCacheTile requests the tile from the remote server and caches it. An expired cached tile is only requested
+// again if it has changed. It's returned when the remote server can't be reached or has a temporary problem (see
+// isTemporaryError), so that tiles are still available when offline. Other errors (e.g. 404) are passed to the client.
+func (s *remoteTileSource) requestAndCacheTile(z string, x string, y string, cached *cachedTile, log *logger) ([]byte, string, error) {
+	var validators *tileMetadata
+	if cached != nil {
+		validators = &cached.metadata
+	}
+
+	response, err := requestOriginalTile(s.urlTemplate, z, x, y, validators, log, s.client)
+	if err != nil && cached != nil && isTemporaryError(err) {
+		log.Log("Use outdated tile %s/%s/%s, it couldn't be revalidated: %s", z, x, y, err.Error())
+		metadata := cached.metadata
+		metadata.RevalidationFailedAt = time.Now()
+		metadataErr := writeTileMetadata(z, x, y, s.cacheKey, cached.format, s.cacheBaseFolder, metadata)
+		if metadataErr != nil {
+			log.Error("Error updating metadata of cached tile: %s", metadataErr.Error())
+		}
+		return cached.tileBytes, cached.format, nil
+	}
+	var upstreamErr *upstreamError
+	if errors.As(err, &upstreamErr) && upstreamErr.statusCode == http.StatusNotFound && cached != nil {
+		log.Debug("Tile has been removed from the remote server, remove it from the cache")
+		removeCachedTile(z, x, y, s.cacheKey, cached.format, s.cacheBaseFolder)
+	}
+	if errors.As(err, &upstreamErr) && upstreamErr.statusCode == http.StatusNotFound && s.options.NotFoundMaxAge > 0 {
+		log.Debug("Remember that tile doesn't exist on the remote server")
+		cacheErr := cacheNotFound(z, x, y, s.cacheKey, s.cacheBaseFolder)
+		if cacheErr != nil {
+			log.Error("Error caching missing tile: %s", cacheErr.Error())
+		}
+	}
+	if err != nil {
+		// Returned unchanged to keep the status code of the remote server
+		return nil, "", err
+	}
+
+	metadata := tileMetadata{FetchedAt: time.Now(), ETag: response.etag, LastModified: response.lastModified}
+
+	if response.notModified {
+		log.Debug("Cached tile is still up to date")
+		// The validators don't have to be sent again in a 304 response
+		if metadata.ETag == "" && metadata.LastModified == "" {
+			metadata.ETag, metadata.LastModified = cached.metadata.ETag, cached.metadata.LastModified
+		}
+		err = writeTileMetadata(z, x, y, s.cacheKey, cached.format, s.cacheBaseFolder, metadata)
+		if err != nil {
+			log.Error("Error updating metadata of cached tile: %s", err.Error())
+		}
+		return cached.tileBytes, cached.format, nil
+	}
+
+	tileFormat, err := detectFormat(response.content, response.contentType, s.format)
+	if err != nil {
+		return nil, "", errors.New(fmt.Sprintf("Error detecting format of original tile %s/%s/%s: %s", z, x, y, err.Error()))
+	}
+	log.Debug("Remote tile has format %s", tileFormat)
+
+	log.Debug("Cache new tile")
+	err = cacheTile(z, x, y, s.cacheKey, tileFormat, s.cacheBaseFolder, response.content)
+	if err == nil {
+		err = writeTileMetadata(z, x, y, s.cacheKey, tileFormat, s.cacheBaseFolder, metadata)
+	}
+	if err != nil {
+		return nil, "", errors.New(fmt.Sprintf("Error caching tile %s/%s/%s.%s: %s", z, x, y, tileFormat, err.Error()))
+	}
+
+	if cached != nil && cached.format != tileFormat {
+		// Otherwise the outdated tile might still be found in the cache
+		removeCachedTile(z, x, y, s.cacheKey, cached.format, s.cacheBaseFolder)
+	}
+
+	return response.content, tileFormat, nil
+}
+
+func startProxyForEndpoint(port string, endpoint string, remoteUrlString string, cacheBaseFolder string, encodingOptions EncodingOptions, options RemoteTileOptions) {
+	remote := newRemoteTileSource(remoteUrlString, cacheBaseFolder, options)
+
+	sigolo.Info("Start tile proxy on port localhost:%s/%s for remote URL %s", port, endpoint, remoteUrlString)
 
 	http.HandleFunc("/"+endpoint+"/", func(w http.ResponseWriter, r *http.Request) {
 		// Use local variable here to ensure each logging has exactly the counter it belongs to. Otherwise, subsequent
@@ -57,113 +261,175 @@ func startProxyForEndpoint(port string, endpoint string, remoteUrlString string,
 
 		log.Debug("Request URL: %s", r.URL)
 
-		requestPath := strings.Trim(r.URL.Path, "/")
-		requestParameterPath := strings.Trim(requestPath, endpoint+"/")
-
-		pathSegmentsAndFormat := strings.Split(requestParameterPath, ".")
-
-		// Separate the "{z}/{x}/{y}" part from the ".png" or whatever extension is used
-		requestedParameters := pathSegmentsAndFormat[0]
-		requestedFormat := pathSegmentsAndFormat[1]
-
-		log.Debug("Requested path  : %s", requestPath)
+		z, x, y, requestedFormat, err := parseTileRequest(r.URL.Path, endpoint)
+		if err != nil {
+			responseWithError(log, w, err.Error(), err)
+			return
+		}
 		log.Debug("Requested format: %s", requestedFormat)
 
-		segments := strings.Split(requestedParameters, "/")
-		if len(segments) != 3 {
-			log.Error("Request to URL %s invalid. Request URL must have form .../{z}/{x}/{y}.{ext}", requestPath)
-			responseWithError(log, w, fmt.Sprintf("Invalid request path %s", requestPath), err)
+		requestedFormat = normalizeFormat(requestedFormat)
+		if requestedFormat == "" {
+			responseWithError(log, w, fmt.Sprintf("Unknown requested format in %s", r.URL.Path), nil)
 			return
 		}
-		z := segments[0]
-		x := segments[1]
-		y := segments[2]
 
-		if requestedFormat != formatPng && requestedFormat != formatPbf && requestedFormat != formatWebp {
-			responseWithError(log, w, fmt.Sprintf("Unknown requested format %s", requestedFormat), err)
+		tileZ, tileX, tileY, err := parseTileCoordinates(z, x, y)
+		if err != nil {
+			responseWithError(log, w, err.Error(), err)
 			return
 		}
+		// Normalized coordinates for the cache (e.g. without leading zeros)
+		z, x, y = strconv.Itoa(tileZ), strconv.Itoa(tileX), strconv.Itoa(tileY)
 
-		cacheKey := toCacheKey(remoteUrl)
-		tileBytes := getTile(z, x, y, cacheKey, remoteTileFormat, cacheBaseFolder, log)
-
-		if tileBytes == nil {
-			log.Debug("Tile not cached, load it from remote server")
-			// Tile not in cache -> Request original tile and cache it
-			tileBytes, err = requestOriginalTile(remoteUrlString, z, x, y, log, client)
-			if err != nil {
-				responseWithError(log, w, fmt.Sprintf("Error requesting original tile %s/%s/%s.%s: %s", z, x, y, remoteTileFormat, err.Error()), err)
-				return
-			}
-
-			log.Debug("Cache new tile")
-			err = cacheTile(z, x, y, cacheKey, remoteTileFormat, cacheBaseFolder, tileBytes)
-			if err != nil {
-				responseWithError(log, w, fmt.Sprintf("Error caching tile %s/%s/%s.%s: %s", z, x, y, remoteTileFormat, err.Error()), err)
-				return
-			}
-		} else {
-			log.Debug("Found tile in cache")
+		tileBytes, tileFormat, err := remote.getTile(z, x, y, log)
+		if err != nil {
+			responseWithError(log, w, err.Error(), err)
+			return
 		}
 
 		// Decode tile from remote format and encode it into the wanted request format.
-		var remoteTile bytes.Buffer
-		if remoteTileFormat == formatWebp {
-			log.Debug("Decode tile as %s", formatWebp)
-			var remoteTileImage image.Image
-			remoteTileImage, err = webp.Decode(bytes.NewReader(tileBytes))
-			if err != nil {
-				responseWithError(log, w, fmt.Sprintf("Error decoding tile %s/%s/%s.%s as %s: %s", z, x, y, remoteTileFormat, requestedFormat, err.Error()), err)
-				return
-			}
-
-			if requestedFormat == formatPng {
-				err = png.Encode(&remoteTile, remoteTileImage)
-				if err != nil {
-					responseWithError(log, w, fmt.Sprintf("Error encoding tile %s/%s/%s.%s as %s: %s", z, x, y, remoteTileFormat, requestedFormat, err.Error()), err)
-				}
-			} else if requestedFormat == formatWebp {
-				_, err = remoteTile.Write(tileBytes)
-				if err != nil {
-					responseWithError(log, w, fmt.Sprintf("Error writing raw bytes for tile %s/%s/%s.%s as %s: %s", z, x, y, remoteTileFormat, requestedFormat, err.Error()), err)
-				}
-			} else {
-				responseWithError(log, w, fmt.Sprintf("Unsupported request format %s for tile %s/%s/%s.%s", requestedFormat, z, x, y, remoteTileFormat), nil)
-			}
-		} else if remoteTileFormat == formatPbf {
-			log.Debug("Remote tile has format PBF, no format conversion performed")
-			remoteTile.Write(tileBytes)
-		}
-		// No else: Remote formats are checked above
-
-		err = writeTileToResponse(w, &remoteTile)
+		if tileFormat != requestedFormat {
+			log.Debug("Convert tile from %s to %s", tileFormat, requestedFormat)
+		}
+		tileBytes, err = convertTile(tileBytes, tileFormat, requestedFormat, encodingOptions)
+		if err != nil {
+			responseWithError(log, w, fmt.Sprintf("Error converting tile %s/%s/%s.%s: %s", z, x, y, tileFormat, err.Error()), err)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentTypeOf(requestedFormat))
+		err = writeTileToResponse(w, bytes.NewBuffer(tileBytes))
 		if err != nil {
-			log.Error("Error returning tile %s/%s/%s.%s: %s", z, x, y, remoteTileFormat, err.Error())
+			log.Error("Error returning tile %s/%s/%s.%s: %s", z, x, y, requestedFormat, err.Error())
 			return
 		}
 		log.Debug("Response written - Done")
 	})
 }
 
-func requestOriginalTile(remoteUrlString string, z string, x string, y string, log *logger, client http.Client) ([]byte, error) {
+// parseTileRequest returns the tile coordinates and the format of a request path of the form
+// "/<endpoint>/{z}/{x}/{y}.{ext}".
+func parseTileRequest(requestPath string, endpoint string) (string, string, string, string, error) {
+	requestParameterPath := strings.TrimPrefix(strings.Trim(requestPath, "/"), endpoint+"/")
+
+	// Separate the "{z}/{x}/{y}" part from the ".png" or whatever extension is used
+	pathSegmentsAndFormat := strings.Split(requestParameterPath, ".")
+	if len(pathSegmentsAndFormat) != 2 {
+		return "", "", "", "", errors.New(fmt.Sprintf("Invalid request path %s. Request URL must have form .../{z}/{x}/{y}.{ext}", requestPath))
+	}
+
+	segments := strings.Split(pathSegmentsAndFormat[0], "/")
+	if len(segments) != 3 {
+		return "", "", "", "", errors.New(fmt.Sprintf("Invalid request path %s. Request URL must have form .../{z}/{x}/{y}.{ext}", requestPath))
+	}
+
+	return segments[0], segments[1], segments[2], pathSegmentsAndFormat[1], nil
+}
+
+// originalTile is the response of the remote server for a tile.
+type originalTile struct {
+	content      []byte
+	contentType  string
+	etag         string
+	lastModified string
+	// True when the tile hasn't changed since it has been cached (status 304)
+	notModified bool
+}
+
+// requestOriginalTile requests the tile from the remote server. With the validators of a cached tile (nil if not
+// cached), the request is conditional and the tile is only sent when it has changed. Requests failing with status 429
+// (too many requests) or 5xx are retried with exponential backoff or after the delay given by the server. Conditional
+// requests aren't retried, since the cached tile can be used instead. Unsuccessful responses result in an upstreamError.
+func requestOriginalTile(remoteUrlString string, z string, x string, y string, validators *tileMetadata, log *logger, client http.Client) (*originalTile, error) {
 	requestUrl := remoteUrlString
 	requestUrl = strings.Replace(requestUrl, "{z}", z, 1)
 	requestUrl = strings.Replace(requestUrl, "{x}", x, 1)
 	requestUrl = strings.Replace(requestUrl, "{y}", y, 1)
 
-	log.Debug("Make GET request to %s", requestUrl)
-
-	resp, err := client.Get(requestUrl)
+	request, err := http.NewRequest(http.MethodGet, requestUrl, nil)
 	if err != nil {
-		log.Error("Error making GET request to %s: %s", requestUrl, err.Error())
+		return nil, errors.New(fmt.Sprintf("Error creating request to %s: %s", requestUrl, err.Error()))
+	}
+	if validators != nil && validators.ETag != "" {
+		request.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators != nil && validators.LastModified != "" {
+		request.Header.Set("If-Modified-Since", validators.LastModified)
 	}
 
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Error reading response body: %s", err.Error()))
+	retries := maxRetries
+	if validators != nil {
+		retries = 0
 	}
 
-	return content, nil
+	for retry := 0; ; retry++ {
+		log.Debug("Make GET request to %s", requestUrl)
+
+		resp, err := client.Do(request)
+		if err != nil {
+			return nil, &upstreamError{statusCode: http.StatusBadGateway, message: fmt.Sprintf("Error making GET request to %s: %s", requestUrl, err.Error())}
+		}
+
+		content, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, &upstreamError{statusCode: http.StatusBadGateway, message: fmt.Sprintf("Error reading response body: %s", err.Error())}
+		}
+
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotModified && validators != nil {
+			return &originalTile{
+				content:      content,
+				contentType:  resp.Header.Get("Content-Type"),
+				etag:         resp.Header.Get("ETag"),
+				lastModified: resp.Header.Get("Last-Modified"),
+				notModified:  resp.StatusCode == http.StatusNotModified,
+			}, nil
+		}
+
+		// Only error codes are passed to the client, other unexpected responses (like redirects that weren't followed)
+		// are an error of the remote server.
+		statusCode := resp.StatusCode
+		if statusCode < 400 {
+			statusCode = http.StatusBadGateway
+		}
+		err = &upstreamError{statusCode: statusCode, message: fmt.Sprintf("Request to %s failed with status %s", requestUrl, resp.Status)}
+
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 || retry >= retries {
+			return nil, err
+		}
+
+		delay := retryDelay(retry, resp.Header.Get("Retry-After"))
+		if delay > maxRetryDelay {
+			log.Debug("Remote server requested a retry in %s, which is too long to wait", delay)
+			return nil, err
+		}
+
+		log.Log("Request to %s failed with status %s, retry in %s", requestUrl, resp.Status, delay)
+		time.Sleep(delay)
+	}
+}
+
+// isTemporaryError returns true for errors of requests to the remote server, which might succeed later on. These are
+// unreachable servers and the status codes 429 (too many requests) and 5xx.
+func isTemporaryError(err error) bool {
+	var upstreamErr *upstreamError
+	if !errors.As(err, &upstreamErr) {
+		return false
+	}
+	return upstreamErr.statusCode == http.StatusTooManyRequests || upstreamErr.statusCode >= 500
+}
+
+// retryDelay returns the delay before the given retry (starting at 0). The value of the Retry-After header is used if
+// given (either in seconds or as date), otherwise the delay is doubled for each retry.
+func retryDelay(retry int, retryAfter string) time.Duration {
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if retryTime, err := http.ParseTime(retryAfter); err == nil {
+		return max(0, time.Until(retryTime))
+	}
+	return initialRetryDelay << retry
 }
 
 func writeTileToResponse(w http.ResponseWriter, responseBuf *bytes.Buffer) error {
@@ -178,12 +444,21 @@ func writeTileToResponse(w http.ResponseWriter, responseBuf *bytes.Buffer) error
 	return nil
 }
 
+// responseWithError writes the message with the status code of the upstreamError in the error chain (e.g. 404 when
+// the remote server doesn't have the tile). All other errors result in status 500.
 func responseWithError(log *logger, w http.ResponseWriter, returnedMessage string, err error) {
 	log.Errorb(1, "%s", returnedMessage)
-	w.WriteHeader(500)
-	w.Header().Set("Content-Type", "application/text")
-	_, err = w.Write([]byte(returnedMessage))
-	if err != nil {
-		log.Error("Error returning error message: %s", log, err.Error())
+
+	statusCode := http.StatusInternalServerError
+	var upstreamErr *upstreamError
+	if errors.As(err, &upstreamErr) {
+		statusCode = upstreamErr.statusCode
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(statusCode)
+	_, writeErr := w.Write([]byte(returnedMessage))
+	if writeErr != nil {
+		log.Error("Error returning error message: %s", writeErr.Error())
 	}
 }
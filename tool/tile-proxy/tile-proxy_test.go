@@ -0,0 +1,289 @@
+package tile_proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startTestServer starts a server answering the requests with the given status codes one after another. The last status
+// code is used for all further requests.
+func startTestServer(t *testing.T, statusCodes ...int) (*httptest.Server, *atomic.Int32) {
+	var numberOfRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := int(numberOfRequests.Add(1))
+		statusCode := statusCodes[min(request, len(statusCodes))-1]
+		if statusCode == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "3600")
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(statusCode)
+		w.Write([]byte{0x1a, 0x02})
+	}))
+	t.Cleanup(server.Close)
+
+	originalDelay := initialRetryDelay
+	initialRetryDelay = time.Millisecond
+	t.Cleanup(func() { initialRetryDelay = originalDelay })
+
+	return server, &numberOfRequests
+}
+
+func statusCodeOf(err error) int {
+	var upstreamErr *upstreamError
+	if errors.As(err, &upstreamErr) {
+		return upstreamErr.statusCode
+	}
+	return 0
+}
+
+func TestRequestOriginalTile_retryServerErrors(t *testing.T) {
+	server, numberOfRequests := startTestServer(t, http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK)
+
+	// Act
+	response, err := requestOriginalTile(server.URL+"/{z}/{x}/{y}", "1", "2", "3", nil, newLogger("test"), http.Client{})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.content) != 2 || response.contentType != "application/x-protobuf" {
+		t.Errorf("Wrong tile %v with content type %s", response.content, response.contentType)
+	}
+	if numberOfRequests.Load() != 3 {
+		t.Errorf("Expected 3 requests but got %d", numberOfRequests.Load())
+	}
+}
+
+func TestRequestOriginalTile_giveUpAfterMaxRetries(t *testing.T) {
+	server, numberOfRequests := startTestServer(t, http.StatusInternalServerError)
+
+	// Act
+	_, err := requestOriginalTile(server.URL+"/{z}/{x}/{y}", "1", "2", "3", nil, newLogger("test"), http.Client{})
+
+	// Assert
+	if statusCodeOf(err) != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 but got %v", err)
+	}
+	if numberOfRequests.Load() != int32(maxRetries+1) {
+		t.Errorf("Expected %d requests but got %d", maxRetries+1, numberOfRequests.Load())
+	}
+}
+
+func TestRequestOriginalTile_noRetryOfClientErrors(t *testing.T) {
+	// The test server requests a retry after one hour for status 429, which is too long to wait
+	for _, statusCode := range []int{http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests} {
+		server, numberOfRequests := startTestServer(t, statusCode)
+
+		// Act
+		_, err := requestOriginalTile(server.URL+"/{z}/{x}/{y}", "1", "2", "3", nil, newLogger("test"), http.Client{})
+
+		// Assert
+		if statusCodeOf(err) != statusCode || numberOfRequests.Load() != 1 {
+			t.Errorf("Expected one request with status %d but got %d requests with error %v", statusCode, numberOfRequests.Load(), err)
+		}
+	}
+}
+
+func TestRequestOriginalTile_unreachableServer(t *testing.T) {
+	server, _ := startTestServer(t, http.StatusOK)
+	server.Close()
+
+	// Act
+	_, err := requestOriginalTile(server.URL+"/{z}/{x}/{y}", "1", "2", "3", nil, newLogger("test"), http.Client{})
+
+	// Assert
+	if statusCodeOf(err) != http.StatusBadGateway {
+		t.Errorf("Expected status 502 but got %v", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if retryDelay(2, "") != 4*initialRetryDelay {
+		t.Errorf("Wrong exponential backoff %s", retryDelay(2, ""))
+	}
+	if retryDelay(2, "5") != 5*time.Second {
+		t.Errorf("Expected delay of Retry-After header in seconds but got %s", retryDelay(2, "5"))
+	}
+	retryTime := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if delay := retryDelay(0, retryTime); delay < 58*time.Second || delay > time.Minute {
+		t.Errorf("Expected delay until date of Retry-After header but got %s", delay)
+	}
+}
+
+func TestRemoteTileSource_notFound(t *testing.T) {
+	server, numberOfRequests := startTestServer(t, http.StatusNotFound, http.StatusOK)
+	remote := newRemoteTileSource(server.URL+"/{z}/{x}/{y}", t.TempDir(), RemoteTileOptions{NotFoundMaxAge: time.Hour})
+
+	// Act
+	_, _, err1 := remote.getTile("1", "2", "3", newLogger("test"))
+	_, _, err2 := remote.getTile("1", "2", "3", newLogger("test"))
+
+	// Assert
+	if statusCodeOf(err1) != http.StatusNotFound || statusCodeOf(err2) != http.StatusNotFound {
+		t.Errorf("Expected status 404 but got %v and %v", err1, err2)
+	}
+	if numberOfRequests.Load() != 1 {
+		t.Errorf("Missing tile should be cached but got %d requests", numberOfRequests.Load())
+	}
+
+	// Expired entry of missing tile
+	remote.options.NotFoundMaxAge = 0
+	tileBytes, _, err := remote.getTile("1", "2", "3", newLogger("test"))
+	if err != nil || len(tileBytes) != 2 {
+		t.Errorf("Expected tile after expiry of missing tile but got %v (%v)", tileBytes, err)
+	}
+}
+
+func TestRemoteTileSource_errorNotCached(t *testing.T) {
+	server, numberOfRequests := startTestServer(t, http.StatusForbidden, http.StatusOK)
+	remote := newRemoteTileSource(server.URL+"/{z}/{x}/{y}", t.TempDir(), RemoteTileOptions{NotFoundMaxAge: time.Hour})
+
+	// Act
+	_, _, err1 := remote.getTile("1", "2", "3", newLogger("test"))
+	tileBytes, _, err2 := remote.getTile("1", "2", "3", newLogger("test"))
+
+	// Assert
+	if statusCodeOf(err1) != http.StatusForbidden {
+		t.Errorf("Expected status 403 but got %v", err1)
+	}
+	if err2 != nil || len(tileBytes) != 2 || numberOfRequests.Load() != 2 {
+		t.Errorf("Error response should not be cached (%d requests, %v)", numberOfRequests.Load(), err2)
+	}
+}
+
+func TestResponseWithError(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	// Act
+	responseWithError(newLogger("test"), recorder, "message", errors.Join(errors.New("wrapped"), &upstreamError{statusCode: http.StatusNotFound}))
+
+	// Assert
+	if recorder.Code != http.StatusNotFound || recorder.Body.String() != "message" {
+		t.Errorf("Wrong response %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestRemoteTileSource_revalidateExpiredTile(t *testing.T) {
+	var numberOfRequests, numberOfNotModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numberOfRequests.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			numberOfNotModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write([]byte{0x1a, 0x02})
+	}))
+	defer server.Close()
+
+	cacheBaseFolder := t.TempDir()
+	remote := newRemoteTileSource(server.URL+"/{z}/{x}/{y}", cacheBaseFolder, RemoteTileOptions{MaxAge: time.Hour})
+	_, _, err := remote.getTile("1", "2", "3", newLogger("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = remote.getTile("1", "2", "3", newLogger("test"))
+	if err != nil || numberOfRequests.Load() != 1 {
+		t.Fatalf("Tile should be cached but got %d requests (%v)", numberOfRequests.Load(), err)
+	}
+
+	// Expire the cached tile
+	metadata := readTileMetadata("1", "2", "3", remote.cacheKey, formatPbf, cacheBaseFolder)
+	metadata.FetchedAt = time.Now().Add(-2 * time.Hour)
+	err = writeTileMetadata("1", "2", "3", remote.cacheKey, formatPbf, cacheBaseFolder, metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	tileBytes, _, err := remote.getTile("1", "2", "3", newLogger("test"))
+
+	// Assert
+	if err != nil || len(tileBytes) != 2 {
+		t.Errorf("Expected cached tile but got %v (%v)", tileBytes, err)
+	}
+	if numberOfRequests.Load() != 2 || numberOfNotModified.Load() != 1 {
+		t.Errorf("Expected one conditional request but got %d requests with %d not modified", numberOfRequests.Load()-1, numberOfNotModified.Load())
+	}
+	metadata = readTileMetadata("1", "2", "3", remote.cacheKey, formatPbf, cacheBaseFolder)
+	if time.Since(metadata.FetchedAt) > time.Minute || metadata.ETag != `"v1"` {
+		t.Errorf("Metadata should be updated after revalidation but was %v", metadata)
+	}
+}
+
+func TestRemoteTileSource_outdatedTileWhenOffline(t *testing.T) {
+	server, _ := startTestServer(t, http.StatusOK)
+	cacheBaseFolder := t.TempDir()
+	remote := newRemoteTileSource(server.URL+"/{z}/{x}/{y}", cacheBaseFolder, RemoteTileOptions{MaxAge: time.Nanosecond})
+	_, _, err := remote.getTile("1", "2", "3", newLogger("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	// Act
+	tileBytes, tileFormat, err := remote.getTile("1", "2", "3", newLogger("test"))
+
+	// Assert
+	if err != nil || len(tileBytes) != 2 || tileFormat != formatPbf {
+		t.Errorf("Expected outdated tile but got %v %s (%v)", tileBytes, tileFormat, err)
+	}
+}
+
+func TestRemoteTileOptions_forEndpoint(t *testing.T) {
+	options := RemoteTileOptions{MaxAge: time.Hour, EndpointMaxAges: map[string]time.Duration{"contours": time.Minute}}
+
+	if options.forEndpoint("contours").MaxAge != time.Minute {
+		t.Errorf("Expected max-age of endpoint")
+	}
+	if options.forEndpoint("hillshade").MaxAge != time.Hour {
+		t.Errorf("Expected default max-age for other endpoints")
+	}
+}
+
+func TestRemoteTileSource_outdatedTileOnServerError(t *testing.T) {
+	server, numberOfRequests := startTestServer(t, http.StatusOK, http.StatusServiceUnavailable)
+	remote := newRemoteTileSource(server.URL+"/{z}/{x}/{y}", t.TempDir(), RemoteTileOptions{MaxAge: time.Nanosecond})
+	_, _, err := remote.getTile("1", "2", "3", newLogger("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	tileBytes, _, err := remote.getTile("1", "2", "3", newLogger("test"))
+	_, _, _ = remote.getTile("1", "2", "3", newLogger("test"))
+
+	// Assert
+	if err != nil || len(tileBytes) != 2 {
+		t.Errorf("Expected outdated tile but got %v (%v)", tileBytes, err)
+	}
+	if numberOfRequests.Load() != 2 {
+		t.Errorf("Expected one revalidation without retries but got %d requests", numberOfRequests.Load()-1)
+	}
+}
+
+func TestRemoteTileSource_removedTile(t *testing.T) {
+	server, _ := startTestServer(t, http.StatusOK, http.StatusNotFound)
+	remote := newRemoteTileSource(server.URL+"/{z}/{x}/{y}", t.TempDir(), RemoteTileOptions{MaxAge: time.Nanosecond, NotFoundMaxAge: time.Hour})
+	_, _, err := remote.getTile("1", "2", "3", newLogger("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	_, _, err = remote.getTile("1", "2", "3", newLogger("test"))
+
+	// Assert
+	if statusCodeOf(err) != http.StatusNotFound {
+		t.Errorf("Expected status 404 but got %v", err)
+	}
+	if remote.getCachedTile("1", "2", "3", newLogger("test")) != nil {
+		t.Errorf("Removed tile should not be cached anymore")
+	}
+}
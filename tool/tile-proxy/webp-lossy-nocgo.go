@@ -0,0 +1,16 @@
+//go:build !cgo
+
+package tile_proxy
+
+import (
+	"errors"
+	"image"
+	"io"
+)
+
+// Lossy WebP uses libwebp, which is only available when building with cgo.
+const lossyWebpSupported = false
+
+func encodeLossyWebp(w io.Writer, img image.Image, quality int) error {
+	return errors.New("Lossy WebP is not supported without cgo")
+}
@@ -0,0 +1,16 @@
+//go:build cgo
+
+package tile_proxy
+
+import (
+	"github.com/chai2010/webp"
+	"image"
+	"io"
+)
+
+// Lossy WebP uses libwebp, which is only available when building with cgo.
+const lossyWebpSupported = true
+
+func encodeLossyWebp(w io.Writer, img image.Image, quality int) error {
+	return webp.Encode(w, img, &webp.Options{Quality: float32(quality)})
+}